@@ -0,0 +1,375 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"errors"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAPMMetricsInterval        = time.Minute
+	defaultAPMMetricsApdexThreshold  = 500 * time.Millisecond
+	defaultAPMMetricsMaxTransactions = 1000
+
+	// apmOtherTransaction is the transaction of the transactions of a service
+	// beyond max_transactions.
+	apmOtherTransaction = "other"
+
+	// apmHistogramAccuracy is the relative accuracy of the response time
+	// percentiles.
+	apmHistogramAccuracy = 0.01
+	// apmHistogramMinMs and apmHistogramMaxMs are the range of response times
+	// told apart by the histogram, shorter and longer ones share its first and
+	// last buckets. This bounds the number of buckets to about 1300.
+	apmHistogramMinMs = 0.001
+	apmHistogramMaxMs = float64(24 * time.Hour / time.Millisecond)
+
+	apmMetricThroughput   = "apm.throughput"
+	apmMetricErrors       = "apm.errors"
+	apmMetricResponseTime = "apm.response_time"
+	apmMetricApdex        = "apm.apdex"
+)
+
+// defaultAPMMetricsPercentiles are the response time percentiles reported
+// when percentiles is empty.
+var defaultAPMMetricsPercentiles = []float64{50, 95, 99}
+
+var (
+	// apmHistogramGamma is the ratio of the bounds of a histogram bucket.
+	apmHistogramGamma    = (1 + apmHistogramAccuracy) / (1 - apmHistogramAccuracy)
+	apmHistogramLogGamma = math.Log(apmHistogramGamma)
+)
+
+// APMMetricsConfig defines the APM metrics derived from the root and server
+// spans of every service and transaction.
+type APMMetricsConfig struct {
+	// Enabled turns the aggregation on.
+	Enabled bool `mapstructure:"enabled"`
+
+	// Interval is the period over which the metrics are aggregated before
+	// they are uploaded. Default is 1m when zero.
+	Interval time.Duration `mapstructure:"interval"`
+
+	// ApdexThreshold is the response time up to which a transaction is
+	// satisfied. Transactions up to four times the threshold are tolerated.
+	// Default is 500ms when zero.
+	ApdexThreshold time.Duration `mapstructure:"apdex_threshold"`
+
+	// Percentiles are the response time percentiles to report, between 0
+	// and 100. Default is 50, 95 and 99 when empty.
+	Percentiles []float64 `mapstructure:"percentiles"`
+
+	// MaxTransactions is the maximum number of service and transaction pairs
+	// aggregated per interval. The transactions seen once the limit is reached
+	// are aggregated per service under the "other" transaction. Default is
+	// 1000 when zero.
+	MaxTransactions int `mapstructure:"max_transactions"`
+}
+
+// Validate checks if the APM metrics configuration is valid.
+func (cfg *APMMetricsConfig) Validate() error {
+	if cfg.Interval < 0 || cfg.ApdexThreshold < 0 || cfg.MaxTransactions < 0 {
+		return errors.New("apm_metrics interval, apdex_threshold and max_transactions must not be negative")
+	}
+	for _, p := range cfg.Percentiles {
+		if p <= 0 || p > 100 {
+			return errors.New("apm_metrics percentiles must be greater than 0 and at most 100")
+		}
+	}
+	return nil
+}
+
+// apmTransaction is a single transaction, i.e. a root or server span.
+type apmTransaction struct {
+	service  string
+	name     string
+	duration time.Duration
+	isError  bool
+}
+
+// isAPMTransaction reports whether the span is the entry point of a
+// transaction of its service.
+func isAPMTransaction(span pdata.Span) bool {
+	return span.Kind() == pdata.SpanKindServer || span.ParentSpanID().IsEmpty()
+}
+
+func newAPMTransaction(service string, span pdata.Span) apmTransaction {
+	return apmTransaction{
+		service:  service,
+		name:     span.Name(),
+		duration: span.EndTimestamp().AsTime().Sub(span.StartTimestamp().AsTime()),
+		isError:  span.Status().Code() == pdata.StatusCodeError,
+	}
+}
+
+type apmSeriesKey struct {
+	service string
+	name    string
+}
+
+// durationHistogram is a sketch of response times in milliseconds with
+// logarithmic buckets, so that its percentiles are within
+// apmHistogramAccuracy of the actual ones whatever the number of
+// transactions. Bucket i counts the durations in (gamma^(i-1), gamma^i].
+type durationHistogram struct {
+	buckets  map[int]uint64
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+func newDurationHistogram() *durationHistogram {
+	return &durationHistogram{buckets: make(map[int]uint64)}
+}
+
+func (h *durationHistogram) add(ms float64) {
+	if h.count == 0 || ms < h.min {
+		h.min = ms
+	}
+	if h.count == 0 || ms > h.max {
+		h.max = ms
+	}
+	h.count++
+	h.sum += ms
+	clamped := math.Max(apmHistogramMinMs, math.Min(apmHistogramMaxMs, ms))
+	h.buckets[int(math.Ceil(math.Log(clamped)/apmHistogramLogGamma))]++
+}
+
+// percentile returns the nearest-rank percentile of the durations, estimated
+// by the middle of its bucket and kept within the observed range. The lowest
+// and highest ranks are the exact minimum and maximum.
+func (h *durationHistogram) percentile(p float64) float64 {
+	rank := uint64(math.Ceil(p / 100 * float64(h.count)))
+	if rank <= 1 {
+		return h.min
+	}
+	if rank >= h.count {
+		return h.max
+	}
+	indexes := make([]int, 0, len(h.buckets))
+	for i := range h.buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var seen uint64
+	for _, i := range indexes {
+		seen += h.buckets[i]
+		if seen >= rank {
+			value := 2 * math.Pow(apmHistogramGamma, float64(i)) / (apmHistogramGamma + 1)
+			return math.Max(h.min, math.Min(h.max, value))
+		}
+	}
+	return h.max
+}
+
+// apmSeries accumulates the transactions of a service and transaction name
+// during an interval.
+type apmSeries struct {
+	errors     uint64
+	satisfied  uint64
+	tolerating uint64
+	durations  *durationHistogram
+}
+
+// apmMetricsAggregator computes throughput, errors, response time percentiles
+// and Apdex per service and transaction over an interval.
+type apmMetricsAggregator struct {
+	mutex       sync.Mutex
+	threshold   time.Duration
+	percentiles []float64
+	maxSeries   int
+	start       time.Time
+	series      map[apmSeriesKey]*apmSeries
+	nowFunc     func() time.Time
+}
+
+func newAPMMetricsAggregator(cfg APMMetricsConfig) *apmMetricsAggregator {
+	threshold := cfg.ApdexThreshold
+	if threshold <= 0 {
+		threshold = defaultAPMMetricsApdexThreshold
+	}
+	percentiles := cfg.Percentiles
+	if len(percentiles) == 0 {
+		percentiles = defaultAPMMetricsPercentiles
+	}
+	maxSeries := cfg.MaxTransactions
+	if maxSeries <= 0 {
+		maxSeries = defaultAPMMetricsMaxTransactions
+	}
+	return &apmMetricsAggregator{
+		threshold:   threshold,
+		percentiles: percentiles,
+		maxSeries:   maxSeries,
+		start:       time.Now(),
+		series:      make(map[apmSeriesKey]*apmSeries),
+		nowFunc:     time.Now,
+	}
+}
+
+// record adds a transaction to the current interval. Failed transactions are
+// counted as frustrated. Once the interval has maxSeries series, the
+// transactions of new series are added to the other transaction of their
+// service.
+func (a *apmMetricsAggregator) record(tx apmTransaction) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	key := apmSeriesKey{service: tx.service, name: tx.name}
+	s, found := a.series[key]
+	if !found && len(a.series) >= a.maxSeries {
+		key.name = apmOtherTransaction
+		s, found = a.series[key]
+	}
+	if !found {
+		s = &apmSeries{durations: newDurationHistogram()}
+		a.series[key] = s
+	}
+	s.durations.add(float64(tx.duration) / float64(time.Millisecond))
+	switch {
+	case tx.isError:
+		s.errors++
+	case tx.duration <= a.threshold:
+		s.satisfied++
+	case tx.duration <= 4*a.threshold:
+		s.tolerating++
+	}
+}
+
+// flush returns the metric records of the current interval and starts a new one.
+func (a *apmMetricsAggregator) flush() []TelemetryMetric {
+	a.mutex.Lock()
+	series, start := a.series, a.start
+	now := a.nowFunc()
+	a.series = make(map[apmSeriesKey]*apmSeries)
+	a.start = now
+	a.mutex.Unlock()
+
+	items := make([]TelemetryMetric, 0, 4*len(series))
+	for key, s := range series {
+		newItem := func(name, metricType, unit string) TelemetryMetric {
+			return TelemetryMetric{
+				Timestamp:   now.UnixNano() / int64(time.Millisecond),
+				S247UID:     "otel-s247exporter",
+				Name:        name,
+				Unit:        unit,
+				Type:        metricType,
+				StartTime:   start.UnixNano() / int64(time.Millisecond),
+				ServiceName: key.service,
+				Dimensions: telemetryAttributes{
+					"service.name": key.service,
+					"transaction":  key.name,
+				},
+			}
+		}
+		count := s.durations.count
+
+		throughput := newItem(apmMetricThroughput, metricTypeSum, "requests")
+		throughput.Temporality = temporalityDelta
+		throughput.IsMonotonic = true
+		throughput.Value = float64(count)
+
+		errs := newItem(apmMetricErrors, metricTypeSum, "errors")
+		errs.Temporality = temporalityDelta
+		errs.IsMonotonic = true
+		errs.Value = float64(s.errors)
+
+		responseTime := newItem(apmMetricResponseTime, metricTypeSummary, "milliseconds")
+		responseTime.Temporality = temporalityDelta
+		responseTime.Count = count
+		responseTime.Sum = s.durations.sum
+		for _, p := range a.percentiles {
+			responseTime.Quantiles = append(responseTime.Quantiles, TelemetryQuantile{
+				Quantile: p / 100,
+				Value:    s.durations.percentile(p),
+			})
+		}
+
+		apdex := newItem(apmMetricApdex, metricTypeGauge, "")
+		apdex.Value = (float64(s.satisfied) + float64(s.tolerating)/2) / float64(count)
+		apdex.Dimensions["apdex_threshold_ms"] = float64(a.threshold) / float64(time.Millisecond)
+
+		items = append(items, throughput, errs, responseTime, apdex)
+	}
+	return items
+}
+
+// recordAPMTransactions adds the transactions of the uploaded spans to the
+// APM metrics. Transactions of spans that will be retried are skipped, they
+// are recorded when their retry is done, so that every span counts once.
+func (e *site24x7exporter) recordAPMTransactions(transactions map[int]apmTransaction, retryable map[int]bool) {
+	if e.apmMetrics == nil {
+		return
+	}
+	for i, tx := range transactions {
+		if !retryable[i] {
+			e.apmMetrics.record(tx)
+		}
+	}
+}
+
+// uploadAPMMetrics uploads the APM metrics of the current interval.
+func (e *site24x7exporter) uploadAPMMetrics(ctx context.Context) {
+	items := e.apmMetrics.flush()
+	if len(items) == 0 {
+		return
+	}
+	records := e.marshalRecords(len(items), logTypeMetrics, func(i int) interface{} { return items[i] })
+	if err := e.uploadRecords(ctx, records, logTypeMetrics).err(); err != nil {
+		// The metrics are not retried, the next interval starts from scratch.
+		e.logger.Error("Failed to upload APM metrics to Site24x7",
+			zap.Int("records", len(items)), zap.Error(err))
+	}
+}
+
+// startAPMMetrics uploads the APM metrics every interval until stopAPMMetrics
+// is called.
+func (e *site24x7exporter) startAPMMetrics() {
+	e.apmStop = make(chan struct{})
+	e.apmStopped = make(chan struct{})
+	go func() {
+		defer close(e.apmStopped)
+		ticker := time.NewTicker(e.apmInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				e.uploadAPMMetrics(context.Background())
+			case <-e.apmStop:
+				return
+			}
+		}
+	}()
+}
+
+// stopAPMMetrics stops the periodic upload and uploads the metrics of the
+// last, partial interval.
+func (e *site24x7exporter) stopAPMMetrics(ctx context.Context) {
+	if e.apmStop == nil {
+		return
+	}
+	close(e.apmStop)
+	<-e.apmStopped
+	e.apmStop = nil
+	e.uploadAPMMetrics(ctx)
+}
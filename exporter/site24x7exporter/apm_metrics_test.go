@@ -0,0 +1,183 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/site24x7exporter/internal/mockserver"
+)
+
+func findMetric(t *testing.T, items []TelemetryMetric, name, transaction string) TelemetryMetric {
+	for _, item := range items {
+		if item.Name == name && item.Dimensions["transaction"] == transaction {
+			return item
+		}
+	}
+	require.Failf(t, "metric not found", "%s of %s", name, transaction)
+	return TelemetryMetric{}
+}
+
+func TestAPMMetricsAggregator(t *testing.T) {
+	a := newAPMMetricsAggregator(APMMetricsConfig{ApdexThreshold: 100 * time.Millisecond, Percentiles: []float64{50, 90}})
+	start := a.start
+	now := start.Add(time.Minute)
+	a.nowFunc = func() time.Time { return now }
+
+	for _, d := range []time.Duration{10, 50, 100, 300, 1000} {
+		a.record(apmTransaction{service: "orders", name: "GET /orders", duration: d * time.Millisecond})
+	}
+	a.record(apmTransaction{service: "orders", name: "GET /orders", duration: 20 * time.Millisecond, isError: true})
+	a.record(apmTransaction{service: "orders", name: "POST /orders", duration: 5 * time.Millisecond})
+
+	items := a.flush()
+	require.Len(t, items, 8)
+
+	throughput := findMetric(t, items, apmMetricThroughput, "GET /orders")
+	assert.Equal(t, metricTypeSum, throughput.Type)
+	assert.Equal(t, temporalityDelta, throughput.Temporality)
+	assert.Equal(t, 6.0, throughput.Value)
+	assert.Equal(t, "orders", throughput.ServiceName)
+	assert.Equal(t, "orders", throughput.Dimensions["service.name"])
+	assert.Equal(t, start.UnixNano()/int64(time.Millisecond), throughput.StartTime)
+	assert.Equal(t, now.UnixNano()/int64(time.Millisecond), throughput.Timestamp)
+
+	assert.Equal(t, 1.0, findMetric(t, items, apmMetricErrors, "GET /orders").Value)
+
+	responseTime := findMetric(t, items, apmMetricResponseTime, "GET /orders")
+	assert.Equal(t, uint64(6), responseTime.Count)
+	assert.Equal(t, 1480.0, responseTime.Sum)
+	require.Len(t, responseTime.Quantiles, 2)
+	assert.Equal(t, 0.5, responseTime.Quantiles[0].Quantile)
+	assert.InEpsilon(t, 50, responseTime.Quantiles[0].Value, apmHistogramAccuracy)
+	assert.Equal(t, 0.9, responseTime.Quantiles[1].Quantile)
+	assert.InEpsilon(t, 1000, responseTime.Quantiles[1].Value, apmHistogramAccuracy)
+
+	// 3 satisfied, 1 tolerating, 1 frustrated and 1 error.
+	apdex := findMetric(t, items, apmMetricApdex, "GET /orders")
+	assert.Equal(t, 3.5/6, apdex.Value)
+	assert.Equal(t, 1.0, findMetric(t, items, apmMetricApdex, "POST /orders").Value)
+
+	// The next interval starts empty.
+	assert.Empty(t, a.flush())
+}
+
+func TestDurationHistogram(t *testing.T) {
+	h := newDurationHistogram()
+	for i := 1; i <= 100000; i++ {
+		h.add(float64(i) / 10)
+	}
+	assert.Equal(t, uint64(100000), h.count)
+	assert.InEpsilon(t, 500005000.0, h.sum, 1e-9)
+	assert.InEpsilon(t, 5000, h.percentile(50), apmHistogramAccuracy)
+	assert.InEpsilon(t, 9900, h.percentile(99), apmHistogramAccuracy)
+	assert.Equal(t, 0.1, h.percentile(0.0001), "the lowest rank is the minimum")
+	assert.Equal(t, 10000.0, h.percentile(100), "the highest rank is the maximum")
+	assert.Less(t, len(h.buckets), 1000)
+
+	// Durations outside of the tracked range share the edge buckets.
+	h = newDurationHistogram()
+	h.add(0)
+	h.add(apmHistogramMaxMs * 10)
+	assert.Len(t, h.buckets, 2)
+	assert.Equal(t, 0.0, h.percentile(50))
+	assert.Equal(t, apmHistogramMaxMs*10, h.percentile(100))
+}
+
+func TestAPMMetricsAggregatorMaxTransactions(t *testing.T) {
+	a := newAPMMetricsAggregator(APMMetricsConfig{MaxTransactions: 2})
+	a.record(apmTransaction{service: "orders", name: "GET /orders/1", duration: time.Millisecond})
+	a.record(apmTransaction{service: "orders", name: "GET /orders/2", duration: time.Millisecond})
+	a.record(apmTransaction{service: "orders", name: "GET /orders/3", duration: time.Millisecond})
+	a.record(apmTransaction{service: "orders", name: "GET /orders/4", duration: time.Millisecond})
+	a.record(apmTransaction{service: "cart", name: "GET /cart", duration: time.Millisecond})
+	// Known transactions are still aggregated on their own.
+	a.record(apmTransaction{service: "orders", name: "GET /orders/1", duration: time.Millisecond})
+
+	items := a.flush()
+	require.Len(t, items, 16)
+	assert.Equal(t, 2.0, findMetric(t, items, apmMetricThroughput, "GET /orders/1").Value)
+	assert.Equal(t, 1.0, findMetric(t, items, apmMetricThroughput, "GET /orders/2").Value)
+	var others []TelemetryMetric
+	for _, item := range items {
+		if item.Name == apmMetricThroughput && item.Dimensions["transaction"] == apmOtherTransaction {
+			others = append(others, item)
+		}
+	}
+	require.Len(t, others, 2)
+	values := map[string]float64{}
+	for _, item := range others {
+		values[item.ServiceName] = item.Value
+	}
+	assert.Equal(t, map[string]float64{"orders": 2, "cart": 1}, values)
+
+	// Every interval starts with the limit available again.
+	a.record(apmTransaction{service: "orders", name: "GET /orders/3", duration: time.Millisecond})
+	assert.Equal(t, 1.0, findMetric(t, a.flush(), apmMetricThroughput, "GET /orders/3").Value)
+}
+
+func TestAPMTransactions(t *testing.T) {
+	span := pdata.NewSpan()
+	assert.True(t, isAPMTransaction(span), "root span")
+	span.SetParentSpanID(pdata.NewSpanID([8]byte{1}))
+	assert.False(t, isAPMTransaction(span))
+	span.SetKind(pdata.SpanKindServer)
+	assert.True(t, isAPMTransaction(span), "server span")
+
+	span.SetName("GET /orders")
+	span.SetStartTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, 0)))
+	span.SetEndTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, int64(250*time.Millisecond))))
+	span.Status().SetCode(pdata.StatusCodeError)
+	assert.Equal(t, apmTransaction{
+		service:  "orders",
+		name:     "GET /orders",
+		duration: 250 * time.Millisecond,
+		isError:  true,
+	}, newAPMTransaction("orders", span))
+}
+
+func TestAPMMetricsUploadedOnShutdown(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.APMMetrics.Enabled = true
+	fe := newTestExporter(t, cfg)
+
+	// The failed upload is retried, its spans must only count once.
+	server.Enqueue(mockserver.Response{StatusCode: http.StatusServiceUnavailable})
+	td := newTestSpan("orders", testTraceID1, "GET /orders", pdata.SpanID{})
+	assert.Error(t, fe.ConsumeTraces(context.Background(), td))
+	assert.NoError(t, fe.ConsumeTraces(context.Background(), td))
+	// Child spans are not transactions.
+	assert.NoError(t, fe.ConsumeTraces(context.Background(), newTestSpan("orders", testTraceID1, "SELECT", pdata.NewSpanID([8]byte{1}))))
+	assert.NoError(t, fe.Shutdown(context.Background()))
+
+	var items []TelemetryMetric
+	for _, record := range server.Records(logTypeMetrics) {
+		var item TelemetryMetric
+		require.NoError(t, json.Unmarshal(record, &item))
+		items = append(items, item)
+	}
+	require.Len(t, items, 4)
+	assert.Equal(t, 1.0, findMetric(t, items, apmMetricThroughput, "GET /orders").Value)
+	assert.Equal(t, 0.0, findMetric(t, items, apmMetricErrors, "GET /orders").Value)
+}
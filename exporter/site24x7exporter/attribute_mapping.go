@@ -0,0 +1,221 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+// AttributeMapping maps span attributes to a field of the Site24x7 span record.
+type AttributeMapping struct {
+	// Field is the JSON name of the Site24x7 span field, e.g. "url" or
+	// "http_status_code".
+	Field string `mapstructure:"field"`
+
+	// Sources are the span attributes the field is read from. They are tried
+	// in order, the first one present wins. A source of the form "a+b"
+	// concatenates the values of the attributes a and b and only applies
+	// when all of them are present.
+	Sources []string `mapstructure:"sources"`
+}
+
+// defaultAttributeMappings covers the older and the newer semantic
+// conventions. Mappings from the configuration replace the default mapping
+// of the same field.
+var defaultAttributeMappings = []AttributeMapping{
+	{Field: "host_ip", Sources: []string{"net.peer.ip", "network.peer.address"}},
+	{Field: "host_name", Sources: []string{"net.peer.name", "server.address"}},
+	{Field: "host_port", Sources: []string{"net.peer.port", "server.port"}},
+	{Field: "thread_id", Sources: []string{"thread.id"}},
+	{Field: "thread_name", Sources: []string{"thread.name"}},
+	{Field: "type", Sources: []string{"db.system"}},
+	{Field: "db_statement", Sources: []string{"db.statement", "db.query.text"}},
+	{Field: "db_name", Sources: []string{"db.name", "db.namespace"}},
+	{Field: "connection_string", Sources: []string{"db.connection_string"}},
+	{Field: "url", Sources: []string{"http.url", "url.full", "http.host+http.target", "server.address+url.path"}},
+	{Field: "http_method", Sources: []string{"http.method", "http.request.method"}},
+	{Field: "http_status_code", Sources: []string{"http.status_code", "http.response.status_code"}},
+}
+
+// spanFieldSetter stores an attribute value in a field of the span record.
+// It reports false if the value cannot be converted to the type of the field.
+type spanFieldSetter func(span *TelemetrySpan, value pdata.AttributeValue) bool
+
+func stringField(set func(span *TelemetrySpan, v string)) spanFieldSetter {
+	return func(span *TelemetrySpan, value pdata.AttributeValue) bool {
+		set(span, value.AsString())
+		return true
+	}
+}
+
+func intField(set func(span *TelemetrySpan, v int64)) spanFieldSetter {
+	return func(span *TelemetrySpan, value pdata.AttributeValue) bool {
+		v, ok := attributeInt(value)
+		if ok {
+			set(span, v)
+		}
+		return ok
+	}
+}
+
+// spanFields are the fields of the span record that can be mapped from span attributes.
+var spanFields = map[string]spanFieldSetter{
+	"host_ip":           stringField(func(s *TelemetrySpan, v string) { s.HostIP = v }),
+	"host_name":         stringField(func(s *TelemetrySpan, v string) { s.HostName = v }),
+	"host_port":         intField(func(s *TelemetrySpan, v int64) { s.HostPort = v }),
+	"thread_id":         intField(func(s *TelemetrySpan, v int64) { s.ThreadId = v }),
+	"thread_name":       stringField(func(s *TelemetrySpan, v string) { s.ThreadName = v }),
+	"type":              stringField(func(s *TelemetrySpan, v string) { s.DbSystem = v }),
+	"db_statement":      stringField(func(s *TelemetrySpan, v string) { s.DbStatement = v }),
+	"db_name":           stringField(func(s *TelemetrySpan, v string) { s.DbName = v }),
+	"connection_string": stringField(func(s *TelemetrySpan, v string) { s.DbConnStr = v }),
+	"url":               stringField(func(s *TelemetrySpan, v string) { s.HttpUrl = v }),
+	"http_method":       stringField(func(s *TelemetrySpan, v string) { s.HttpMethod = v }),
+	"http_status_code":  intField(func(s *TelemetrySpan, v int64) { s.HttpStatusCode = v }),
+}
+
+// attributeInt converts an attribute value to an integer. Strings are parsed,
+// doubles are truncated. Values that cannot be represented are rejected.
+func attributeInt(value pdata.AttributeValue) (int64, bool) {
+	switch value.Type() {
+	case pdata.AttributeValueTypeInt:
+		return value.IntVal(), true
+	case pdata.AttributeValueTypeDouble:
+		v := value.DoubleVal()
+		if math.IsNaN(v) || v >= math.MaxInt64 || v < math.MinInt64 {
+			return 0, false
+		}
+		return int64(v), true
+	case pdata.AttributeValueTypeString:
+		v, err := strconv.ParseInt(strings.TrimSpace(value.StringVal()), 10, 64)
+		return v, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// attributeString converts an attribute value of any type to a string.
+func attributeString(attrs pdata.AttributeMap, key string) string {
+	if value, found := attrs.Get(key); found {
+		return value.AsString()
+	}
+	return ""
+}
+
+// mappingSource is a source of a mapping, split into the attributes it concatenates.
+type mappingSource []string
+
+func (s mappingSource) value(attrs pdata.AttributeMap) (pdata.AttributeValue, bool) {
+	if len(s) == 1 {
+		return attrs.Get(s[0])
+	}
+	var sb strings.Builder
+	for _, key := range s {
+		value, found := attrs.Get(key)
+		if !found {
+			return pdata.AttributeValue{}, false
+		}
+		sb.WriteString(value.AsString())
+	}
+	return pdata.NewAttributeValueString(sb.String()), true
+}
+
+type fieldMapping struct {
+	field   string
+	set     spanFieldSetter
+	sources []mappingSource
+}
+
+// spanAttributeMapper fills the fields of span records from span attributes.
+type spanAttributeMapper struct {
+	fields []fieldMapping
+}
+
+// validateAttributeMappings checks that every mapping targets a known field
+// and has at least one source.
+func validateAttributeMappings(mappings []AttributeMapping) error {
+	for _, m := range mappings {
+		if _, found := spanFields[m.Field]; !found {
+			return fmt.Errorf("unknown span_attribute_mapping field %q", m.Field)
+		}
+		if len(m.Sources) == 0 {
+			return fmt.Errorf("span_attribute_mapping field %q has no sources", m.Field)
+		}
+	}
+	return nil
+}
+
+// newSpanAttributeMapper combines the default mappings with the configured
+// ones, which replace the defaults of the same field. Unknown fields are
+// ignored, they are rejected by Config.Validate.
+func newSpanAttributeMapper(mappings []AttributeMapping) *spanAttributeMapper {
+	sources := make(map[string][]string, len(defaultAttributeMappings))
+	var order []string
+	for _, m := range append(append([]AttributeMapping(nil), defaultAttributeMappings...), mappings...) {
+		if _, found := sources[m.Field]; !found {
+			order = append(order, m.Field)
+		}
+		sources[m.Field] = m.Sources
+	}
+
+	mapper := &spanAttributeMapper{}
+	for _, field := range order {
+		set, found := spanFields[field]
+		if !found {
+			continue
+		}
+		fm := fieldMapping{field: field, set: set}
+		for _, source := range sources[field] {
+			fm.sources = append(fm.sources, strings.Split(source, "+"))
+		}
+		mapper.fields = append(mapper.fields, fm)
+	}
+	return mapper
+}
+
+// apply sets every mapped field from the first source that is present and
+// converts to the type of the field.
+func (m *spanAttributeMapper) apply(attrs pdata.AttributeMap, span *TelemetrySpan) {
+	for _, field := range m.fields {
+		for _, source := range field.sources {
+			if value, found := source.value(attrs); found && field.set(span, value) {
+				break
+			}
+		}
+	}
+}
+
+// sourceKeys returns the attributes the given fields are read from.
+func (m *spanAttributeMapper) sourceKeys(fields ...string) map[string]bool {
+	keys := make(map[string]bool)
+	for _, fm := range m.fields {
+		for _, field := range fields {
+			if fm.field != field {
+				continue
+			}
+			for _, source := range fm.sources {
+				for _, key := range source {
+					keys[key] = true
+				}
+			}
+		}
+	}
+	return keys
+}
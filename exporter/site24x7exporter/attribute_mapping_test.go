@@ -0,0 +1,107 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+func TestAttributeInt(t *testing.T) {
+	tests := []struct {
+		value    pdata.AttributeValue
+		expected int64
+		ok       bool
+	}{
+		{pdata.NewAttributeValueInt(200), 200, true},
+		{pdata.NewAttributeValueString(" 404 "), 404, true},
+		{pdata.NewAttributeValueDouble(503.7), 503, true},
+		{pdata.NewAttributeValueString("OK"), 0, false},
+		{pdata.NewAttributeValueDouble(math.NaN()), 0, false},
+		{pdata.NewAttributeValueDouble(math.Inf(1)), 0, false},
+		{pdata.NewAttributeValueBool(true), 0, false},
+		{pdata.NewAttributeValueArray(), 0, false},
+	}
+	for _, tt := range tests {
+		v, ok := attributeInt(tt.value)
+		assert.Equal(t, tt.ok, ok, tt.value.AsString())
+		assert.Equal(t, tt.expected, v, tt.value.AsString())
+	}
+}
+
+func TestSpanAttributeMapperDefaults(t *testing.T) {
+	attrs := pdata.NewAttributeMap()
+	attrs.InsertString("http.status_code", "500")
+	attrs.InsertString("http.method", "GET")
+	attrs.InsertString("http.host", "example.com")
+	attrs.InsertString("http.target", "/orders?id=1")
+	attrs.InsertString("server.address", "db.example.com")
+	attrs.InsertInt("server.port", 5432)
+	attrs.InsertString("thread.id", "not a number")
+	attrs.InsertBool("thread.name", true)
+
+	var span TelemetrySpan
+	newSpanAttributeMapper(nil).apply(attrs, &span)
+	assert.Equal(t, int64(500), span.HttpStatusCode)
+	assert.Equal(t, "GET", span.HttpMethod)
+	assert.Equal(t, "example.com/orders?id=1", span.HttpUrl)
+	assert.Equal(t, "db.example.com", span.HostName)
+	assert.Equal(t, int64(5432), span.HostPort)
+	assert.Equal(t, int64(0), span.ThreadId)
+	assert.Equal(t, "true", span.ThreadName)
+}
+
+func TestSpanAttributeMapperFallback(t *testing.T) {
+	attrs := pdata.NewAttributeMap()
+	// The first source cannot be converted, the next one is used.
+	attrs.InsertString("http.status_code", "OK")
+	attrs.InsertInt("http.response.status_code", 201)
+	attrs.InsertString("url.full", "https://example.com/new")
+	attrs.InsertString("http.url", "https://example.com/old")
+
+	var span TelemetrySpan
+	newSpanAttributeMapper(nil).apply(attrs, &span)
+	assert.Equal(t, int64(201), span.HttpStatusCode)
+	assert.Equal(t, "https://example.com/old", span.HttpUrl)
+}
+
+func TestSpanAttributeMapperOverride(t *testing.T) {
+	attrs := pdata.NewAttributeMap()
+	attrs.InsertString("http.url", "https://example.com/old")
+	attrs.InsertString("url.full", "https://example.com/new")
+	attrs.InsertString("peer.service", "billing")
+	attrs.InsertString("net.peer.name", "billing.internal")
+
+	var span TelemetrySpan
+	newSpanAttributeMapper([]AttributeMapping{
+		{Field: "url", Sources: []string{"url.full", "http.url"}},
+		{Field: "host_name", Sources: []string{"peer.service"}},
+	}).apply(attrs, &span)
+	assert.Equal(t, "https://example.com/new", span.HttpUrl)
+	assert.Equal(t, "billing", span.HostName)
+}
+
+func TestValidateAttributeMappings(t *testing.T) {
+	assert.NoError(t, validateAttributeMappings(defaultAttributeMappings))
+	assert.EqualError(t,
+		validateAttributeMappings([]AttributeMapping{{Field: "name", Sources: []string{"http.route"}}}),
+		`unknown span_attribute_mapping field "name"`)
+	assert.EqualError(t,
+		validateAttributeMappings([]AttributeMapping{{Field: "url"}}),
+		`span_attribute_mapping field "url" has no sources`)
+}
@@ -16,49 +16,162 @@ package site24x7exporter
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 
 	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
 )
 
-// Config defines configuration for file exporter.
+// Config defines configuration for the Site24x7 exporter.
 type Config struct {
 	config.ExporterSettings `mapstructure:",squash"` // squash ensures fields are correctly decoded in embedded struct
 
-	// TimeoutSettings is the total amount of time spent attempting a request,
-	// including retries, before abandoning and dropping data. Default is 5
-	// seconds.
-	TimeoutSettings exporterhelper.TimeoutSettings `mapstructure:",squash"`
+	// HTTPClientSettings configures the HTTP client used for uploads: the
+	// endpoint, TLS, proxy, custom headers, authentication and the timeout of
+	// a single upload request. The endpoint is optional, by default it is the
+	// AppLogs endpoint of DataCenter.
+	confighttp.HTTPClientSettings `mapstructure:",squash"`
+
+	// DataCenter is the Site24x7 data center the account belongs to, one of
+	// US, EU, IN, AU, CN, JP or CA. When empty it is derived from the prefix
+	// of the device key.
+	DataCenter string `mapstructure:"data_center"`
+
+	// TracesEndpoint overrides the endpoint spans are uploaded to.
+	TracesEndpoint string `mapstructure:"traces_endpoint"`
+
+	// TracesAPI selects how spans are uploaded: "applogs" (default) or the
+	// deprecated "catalyst" API, which requires a traces endpoint.
+	TracesAPI string `mapstructure:"traces_api"`
+
+	// LogsEndpoint overrides the endpoint log records are uploaded to.
+	LogsEndpoint string `mapstructure:"logs_endpoint"`
+
+	// MetricsEndpoint overrides the endpoint metric records are uploaded to.
+	MetricsEndpoint string `mapstructure:"metrics_endpoint"`
+
+	// QueueSettings defines the sending queue in front of the exporter. With the
+	// enable_unstable build tag the queue can be persisted to a storage extension.
+	exporterhelper.QueueSettings `mapstructure:"sending_queue"`
 
 	// RetrySettings defines configuration for retrying batches in case of export failure.
 	// The current supported strategy is exponential backoff.
-	RetrySettings exporterhelper.RetrySettings `mapstructure:"retry"`
+	exporterhelper.RetrySettings `mapstructure:"retry_on_failure"`
 
-	// Path of the file to write instance data, relative to current directory.
-	Path string `mapstructure:"path"`
+	// PayloadDump configures the opt-in debug mode that writes every uploaded
+	// payload to a file.
+	PayloadDump PayloadDumpConfig `mapstructure:"payload_dump"`
 
-	// URL to which the opentelemetry data is pushed to.
-	Url string `mapstructure:"url"`
 	// API Key of site24x7.
 	APIKEY string `mapstructure:"apikey"`
-	// Is url insecure? 
-	Insecure bool `mapstructure:"insecure"`
+
+	// ExportSpanEvents uploads the events of spans. Default is true.
+	ExportSpanEvents bool `mapstructure:"export_span_events"`
+
+	// ExportSpanLinks uploads the links of spans. Default is true.
+	ExportSpanLinks bool `mapstructure:"export_span_links"`
+
+	// SpanAttributeMapping maps span attributes to the fields of the Site24x7
+	// span records. Mappings replace the default mapping of their field.
+	SpanAttributeMapping []AttributeMapping `mapstructure:"span_attribute_mapping"`
+
+	// Redaction configures how sensitive span fields are redacted.
+	Redaction RedactionConfig `mapstructure:"redaction"`
+
+	// RootSpanCache configures the cache resolving the root span of traces
+	// across batches.
+	RootSpanCache RootSpanCacheConfig `mapstructure:"root_span_cache"`
+
+	// LogMessageFields are the fields of structured log bodies the message
+	// is read from, the first one present wins. The whole body is the
+	// message when none is present. Default is msg, message and log when
+	// empty.
+	LogMessageFields []string `mapstructure:"log_message_fields"`
+
+	// APMMetrics derives throughput, error, response time and Apdex metrics
+	// from the spans and uploads them as metric records.
+	APMMetrics APMMetricsConfig `mapstructure:"apm_metrics"`
+
+	// MaxRecordsPerRequest is the maximum number of records in a single
+	// upload request, larger batches are split. Default is 5000.
+	MaxRecordsPerRequest int `mapstructure:"max_records_per_request"`
+
+	// MaxBytesPerRequest is the maximum size of the gzip compressed payload of
+	// a single upload request, larger batches are split. Default is 5 MiB.
+	MaxBytesPerRequest int `mapstructure:"max_bytes_per_request"`
+}
+
+// PayloadDumpConfig defines where uploaded payloads are dumped and how the
+// dump file is rotated.
+type PayloadDumpConfig struct {
+	// Path of the dump file, relative to current directory. Dumping is
+	// disabled when empty.
+	Path string `mapstructure:"path"`
+
+	// MaxSizeMiB is the size in mebibytes at which the dump file is rotated.
+	// Default is 100 when zero.
+	MaxSizeMiB int `mapstructure:"max_size_mib"`
+
+	// MaxBackups is the number of rotated dump files to keep. Default is 3
+	// when zero.
+	MaxBackups int `mapstructure:"max_backups"`
 }
 
 var _ config.Exporter = (*Config)(nil)
 
 // Validate checks if the exporter configuration is valid
 func (cfg *Config) Validate() error {
-	// if cfg.Path == "" {
-	// 	return errors.New("path must be non-empty")
-	// }
-	if cfg.Url == "" {
-		return errors.New("url must be non-empty")
-	}
-
 	if cfg.APIKEY == "" {
 		return errors.New("API Key must be non-empty")
 	}
 
+	if cfg.DataCenter != "" && dataCenterHosts[strings.ToUpper(cfg.DataCenter)] == "" {
+		return fmt.Errorf("unknown data_center %q", cfg.DataCenter)
+	}
+
+	switch cfg.TracesAPI {
+	case tracesAPIAppLogs:
+	case tracesAPICatalyst:
+		if cfg.TracesEndpoint == "" && cfg.Endpoint == "" {
+			return errors.New("traces_api catalyst requires traces_endpoint")
+		}
+	default:
+		return fmt.Errorf("unknown traces_api %q", cfg.TracesAPI)
+	}
+
+	if err := validateAttributeMappings(cfg.SpanAttributeMapping); err != nil {
+		return err
+	}
+
+	if err := cfg.Redaction.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.RootSpanCache.MaxTraces < 0 || cfg.RootSpanCache.TTL < 0 || cfg.RootSpanCache.HoldWindow < 0 || cfg.RootSpanCache.MaxHeldBatches < 0 {
+		return errors.New("root_span_cache max_traces, ttl, hold_window and max_held_batches must not be negative")
+	}
+
+	if cfg.Timeout > 0 && cfg.RootSpanCache.HoldWindow >= cfg.Timeout {
+		return errors.New("root_span_cache hold_window must be shorter than timeout")
+	}
+
+	if err := cfg.APMMetrics.Validate(); err != nil {
+		return err
+	}
+
+	if cfg.MaxRecordsPerRequest <= 0 {
+		return errors.New("max_records_per_request must be positive")
+	}
+
+	if cfg.MaxBytesPerRequest <= 0 {
+		return errors.New("max_bytes_per_request must be positive")
+	}
+
+	if cfg.PayloadDump.MaxSizeMiB < 0 || cfg.PayloadDump.MaxBackups < 0 {
+		return errors.New("payload_dump max_size_mib and max_backups must not be negative")
+	}
+
 	return nil
 }
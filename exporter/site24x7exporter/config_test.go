@@ -17,12 +17,16 @@ package site24x7exporter
 import (
 	"path"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
 	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/config/configtest"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -32,16 +36,133 @@ func TestLoadConfig(t *testing.T) {
 	factory := NewFactory()
 	factories.Exporters[typeStr] = factory
 	cfg, err := configtest.LoadConfigAndValidate(path.Join(".", "testdata", "config.yaml"), factories)
-	require.EqualError(t, err, "exporter \"file\" has invalid configuration: path must be non-empty")
+	require.NoError(t, err)
 	require.NotNil(t, cfg)
 
 	e0 := cfg.Exporters[config.NewID(typeStr)]
-	assert.Equal(t, e0, factory.CreateDefaultConfig())
+	defaultCfg := factory.CreateDefaultConfig().(*Config)
+	defaultCfg.Endpoint = "https://logu.site24x7.com/upload/site24x7postservlet"
+	defaultCfg.APIKEY = "ab_123"
+	assert.Equal(t, defaultCfg, e0)
 
 	e1 := cfg.Exporters[config.NewIDWithName(typeStr, "2")]
-	assert.Equal(t, e1,
+	assert.Equal(t,
 		&Config{
 			ExporterSettings: config.NewExporterSettings(config.NewIDWithName(typeStr, "2")),
-			Path:             "./filename.json",
-		})
+			HTTPClientSettings: confighttp.HTTPClientSettings{
+				Endpoint: "https://logu.site24x7.com/upload/site24x7postservlet",
+				TLSSetting: configtls.TLSClientSetting{
+					TLSSetting: configtls.TLSSetting{
+						CAFile: "/var/lib/ca.crt",
+					},
+					InsecureSkipVerify: true,
+				},
+				Timeout: 10 * time.Second,
+				Headers: map[string]string{
+					"X-Custom-Header": "value",
+				},
+			},
+			QueueSettings: exporterhelper.QueueSettings{
+				Enabled:      true,
+				NumConsumers: 2,
+				QueueSize:    10,
+			},
+			RetrySettings: exporterhelper.RetrySettings{
+				Enabled:         true,
+				InitialInterval: 10 * time.Second,
+				MaxInterval:     1 * time.Minute,
+				MaxElapsedTime:  10 * time.Minute,
+			},
+			PayloadDump: PayloadDumpConfig{
+				Path:       "./payloads.json",
+				MaxSizeMiB: 10,
+			},
+			APIKEY:               "ab_123",
+			TracesAPI:            tracesAPIAppLogs,
+			ExportSpanEvents:     true,
+			ExportSpanLinks:      true,
+			MaxRecordsPerRequest: 1000,
+			MaxBytesPerRequest:   1048576,
+		}, e1)
+
+	e2 := cfg.Exporters[config.NewIDWithName(typeStr, "3")].(*Config)
+	assert.Equal(t, "EU", e2.DataCenter)
+	assert.Equal(t, "https://catalyst.example.com/traces", e2.TracesEndpoint)
+	assert.Equal(t, tracesAPICatalyst, e2.TracesAPI)
+	assert.True(t, e2.ExportSpanEvents)
+	assert.False(t, e2.ExportSpanLinks)
+	assert.Equal(t, []AttributeMapping{{Field: "url", Sources: []string{"url.full", "http.url"}}}, e2.SpanAttributeMapping)
+	assert.Equal(t, []string{"message"}, e2.LogMessageFields)
+	assert.Equal(t, APMMetricsConfig{
+		Enabled:         true,
+		Interval:        30 * time.Second,
+		ApdexThreshold:  200 * time.Millisecond,
+		Percentiles:     []float64{90, 99.9},
+		MaxTransactions: 500,
+	}, e2.APMMetrics)
+	assert.Equal(t, RedactionConfig{
+		DeniedCustomParams:  []string{`^http\.request\.header\.`},
+		MaxStackTraceLength: 1024,
+	}, e2.Redaction)
+	assert.Equal(t, signalEndpoints{
+		traces:  "https://catalyst.example.com/traces",
+		logs:    "https://logu.site24x7.eu/upload/site24x7postservlet",
+		metrics: "https://metrics.example.com/upload",
+	}, e2.resolveEndpoints())
+}
+
+func TestValidateConfig(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	assert.EqualError(t, cfg.Validate(), "API Key must be non-empty")
+
+	cfg.APIKEY = "ab_123"
+	assert.NoError(t, cfg.Validate(), "the endpoint is derived from the device key")
+
+	cfg.DataCenter = "mars"
+	assert.EqualError(t, cfg.Validate(), `unknown data_center "mars"`)
+
+	cfg.DataCenter = "eu"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TracesAPI = tracesAPICatalyst
+	assert.EqualError(t, cfg.Validate(), "traces_api catalyst requires traces_endpoint")
+
+	cfg.TracesEndpoint = "https://catalyst.example.com/traces"
+	assert.NoError(t, cfg.Validate())
+
+	cfg.TracesAPI = "grpc"
+	assert.EqualError(t, cfg.Validate(), `unknown traces_api "grpc"`)
+
+	cfg.TracesAPI = tracesAPIAppLogs
+
+	cfg.RootSpanCache.HoldWindow = cfg.Timeout
+	assert.EqualError(t, cfg.Validate(), "root_span_cache hold_window must be shorter than timeout")
+
+	cfg.RootSpanCache.HoldWindow = time.Second
+	assert.NoError(t, cfg.Validate())
+
+	cfg.RootSpanCache.MaxHeldBatches = -1
+	assert.EqualError(t, cfg.Validate(), "root_span_cache max_traces, ttl, hold_window and max_held_batches must not be negative")
+	cfg.RootSpanCache.MaxHeldBatches = 0
+
+	cfg.APMMetrics.Percentiles = []float64{50, 101}
+	assert.EqualError(t, cfg.Validate(), "apm_metrics percentiles must be greater than 0 and at most 100")
+
+	cfg.APMMetrics.Percentiles = nil
+
+	cfg.APMMetrics.MaxTransactions = -1
+	assert.EqualError(t, cfg.Validate(), "apm_metrics interval, apdex_threshold and max_transactions must not be negative")
+
+	cfg.APMMetrics.MaxTransactions = 0
+
+	cfg.MaxRecordsPerRequest = 0
+	assert.EqualError(t, cfg.Validate(), "max_records_per_request must be positive")
+
+	cfg.MaxRecordsPerRequest = defaultMaxRecordsPerRequest
+	cfg.MaxBytesPerRequest = 0
+	assert.EqualError(t, cfg.Validate(), "max_bytes_per_request must be positive")
+
+	cfg.MaxBytesPerRequest = defaultMaxBytesPerRequest
+	cfg.PayloadDump.MaxBackups = -1
+	assert.Error(t, cfg.Validate())
 }
@@ -0,0 +1,98 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"strings"
+)
+
+const (
+	defaultDataCenter = "US"
+	appLogsPath       = "/upload/site24x7postservlet"
+)
+
+// dataCenterHosts maps the Site24x7 data centers to their upload hosts.
+var dataCenterHosts = map[string]string{
+	"US": "logu.site24x7.com",
+	"EU": "logu.site24x7.eu",
+	"IN": "logu.site24x7.in",
+	"AU": "logu.site24x7.net.au",
+	"CN": "logu.site24x7.cn",
+	"JP": "logu.site24x7.jp",
+	"CA": "logu.site24x7.ca",
+}
+
+// dataCenterFromKey derives the data center from the prefix of a device key,
+// e.g. "eu_1234" belongs to the EU data center. Keys without a known prefix
+// belong to the US data center.
+func dataCenterFromKey(apikey string) string {
+	if i := strings.Index(apikey, "_"); i > 0 {
+		if dc := strings.ToUpper(apikey[:i]); dataCenterHosts[dc] != "" {
+			return dc
+		}
+	}
+	return defaultDataCenter
+}
+
+// dataCenterEndpoint returns the AppLogs upload endpoint of the data center.
+func dataCenterEndpoint(dc string) string {
+	return "https://" + dataCenterHosts[strings.ToUpper(dc)] + appLogsPath
+}
+
+// signalEndpoints holds the upload endpoint of every signal.
+type signalEndpoints struct {
+	traces  string
+	logs    string
+	metrics string
+}
+
+// resolveEndpoints determines the upload endpoint of every signal. A signal
+// specific endpoint takes precedence over endpoint, which takes precedence
+// over the endpoint of the configured data center. Without a data center it
+// is derived from the device key.
+func (cfg *Config) resolveEndpoints() signalEndpoints {
+	base := cfg.Endpoint
+	if base == "" {
+		dc := cfg.DataCenter
+		if dc == "" {
+			dc = dataCenterFromKey(cfg.APIKEY)
+		}
+		base = dataCenterEndpoint(dc)
+	}
+
+	endpoints := signalEndpoints{traces: base, logs: base, metrics: base}
+	if cfg.TracesEndpoint != "" {
+		endpoints.traces = cfg.TracesEndpoint
+	}
+	if cfg.LogsEndpoint != "" {
+		endpoints.logs = cfg.LogsEndpoint
+	}
+	if cfg.MetricsEndpoint != "" {
+		endpoints.metrics = cfg.MetricsEndpoint
+	}
+	return endpoints
+}
+
+// forLogType returns the endpoint records of the given log type are uploaded to.
+func (s signalEndpoints) forLogType(logType string) string {
+	switch logType {
+	case logTypeTraces:
+		return s.traces
+	case logTypeMetrics:
+		return s.metrics
+	default:
+		return s.logs
+	}
+}
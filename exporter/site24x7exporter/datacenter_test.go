@@ -0,0 +1,53 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDataCenterFromKey(t *testing.T) {
+	assert.Equal(t, "EU", dataCenterFromKey("eu_1234"))
+	assert.Equal(t, "IN", dataCenterFromKey("in_1234"))
+	assert.Equal(t, "AU", dataCenterFromKey("au_1234"))
+	assert.Equal(t, "US", dataCenterFromKey("us_1234"))
+	assert.Equal(t, "US", dataCenterFromKey("1234"))
+	assert.Equal(t, "US", dataCenterFromKey("ab_1234"))
+	assert.Equal(t, "US", dataCenterFromKey("_1234"))
+}
+
+func TestResolveEndpoints(t *testing.T) {
+	cfg := createDefaultConfig().(*Config)
+	cfg.APIKEY = "jp_1234"
+	assert.Equal(t, signalEndpoints{
+		traces:  "https://logu.site24x7.jp/upload/site24x7postservlet",
+		logs:    "https://logu.site24x7.jp/upload/site24x7postservlet",
+		metrics: "https://logu.site24x7.jp/upload/site24x7postservlet",
+	}, cfg.resolveEndpoints())
+
+	// An explicit data center wins over the device key.
+	cfg.DataCenter = "au"
+	assert.Equal(t, "https://logu.site24x7.net.au/upload/site24x7postservlet", cfg.resolveEndpoints().logs)
+
+	// An explicit endpoint wins over the data center.
+	cfg.Endpoint = "https://proxy.example.com/upload"
+	cfg.LogsEndpoint = "https://logs.example.com/upload"
+	endpoints := cfg.resolveEndpoints()
+	assert.Equal(t, "https://proxy.example.com/upload", endpoints.forLogType(logTypeTraces))
+	assert.Equal(t, "https://proxy.example.com/upload", endpoints.forLogType(logTypeMetrics))
+	assert.Equal(t, "https://logs.example.com/upload", endpoints.forLogType(logTypeLogs))
+}
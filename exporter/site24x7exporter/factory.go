@@ -17,8 +17,10 @@ package site24x7exporter
 import (
 	"context"
 
+	"go.opencensus.io/stats/view"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/exporter/exporterhelper"
 
 	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/sharedcomponent"
@@ -27,10 +29,18 @@ import (
 const (
 	// The value of "type" key in configuration.
 	typeStr = "site24x7"
+
+	defaultMaxRecordsPerRequest = 5000
+	defaultMaxBytesPerRequest   = 5 * 1024 * 1024
+
+	defaultPayloadDumpMaxSizeMiB = 100
+	defaultPayloadDumpMaxBackups = 3
 )
 
 // NewFactory creates a factory for OTLP exporter.
 func NewFactory() component.ExporterFactory {
+	_ = view.Register(MetricViews()...)
+
 	return exporterhelper.NewFactory(
 		typeStr,
 		createDefaultConfig,
@@ -42,8 +52,17 @@ func NewFactory() component.ExporterFactory {
 func createDefaultConfig() config.Exporter {
 	return &Config{
 		ExporterSettings: config.NewExporterSettings(config.NewID(typeStr)),
-		TimeoutSettings:  exporterhelper.DefaultTimeoutSettings(),
-		RetrySettings:    exporterhelper.DefaultRetrySettings(),
+		HTTPClientSettings: confighttp.HTTPClientSettings{
+			Timeout: exporterhelper.DefaultTimeoutSettings().Timeout,
+			Headers: map[string]string{},
+		},
+		TracesAPI:            tracesAPIAppLogs,
+		ExportSpanEvents:     true,
+		ExportSpanLinks:      true,
+		QueueSettings:        exporterhelper.DefaultQueueSettings(),
+		RetrySettings:        exporterhelper.DefaultRetrySettings(),
+		MaxRecordsPerRequest: defaultMaxRecordsPerRequest,
+		MaxBytesPerRequest:   defaultMaxBytesPerRequest,
 	}
 }
 
@@ -52,18 +71,17 @@ func createTracesExporter(
 	set component.ExporterCreateSettings,
 	cfg config.Exporter,
 ) (component.TracesExporter, error) {
+	eCfg := cfg.(*Config)
 	fe := exporters.GetOrAdd(cfg, func() component.Component {
-		return &site24x7exporter{
-			path: cfg.(*Config).Path,
-			url:  cfg.(*Config).Url,
-			apikey: cfg.(*Config).APIKEY,
-			insecure: cfg.(*Config).Insecure,
-		}
+		return newSite24x7Exporter(eCfg, set.Logger)
 	})
 	return exporterhelper.NewTracesExporter(
 		cfg,
 		set,
 		fe.Unwrap().(*site24x7exporter).ConsumeTraces,
+		exporterhelper.WithTimeout(exporterhelper.TimeoutSettings{Timeout: eCfg.Timeout}),
+		exporterhelper.WithQueue(eCfg.QueueSettings),
+		exporterhelper.WithRetry(eCfg.RetrySettings),
 		exporterhelper.WithStart(fe.Start),
 		exporterhelper.WithShutdown(fe.Shutdown),
 	)
@@ -74,18 +92,17 @@ func createMetricsExporter(
 	set component.ExporterCreateSettings,
 	cfg config.Exporter,
 ) (component.MetricsExporter, error) {
+	eCfg := cfg.(*Config)
 	fe := exporters.GetOrAdd(cfg, func() component.Component {
-		return &site24x7exporter{
-			path: cfg.(*Config).Path,
-			url:  cfg.(*Config).Url,
-			apikey: cfg.(*Config).APIKEY,
-			insecure: cfg.(*Config).Insecure,
-		}
+		return newSite24x7Exporter(eCfg, set.Logger)
 	})
 	return exporterhelper.NewMetricsExporter(
 		cfg,
 		set,
 		fe.Unwrap().(*site24x7exporter).ConsumeMetrics,
+		exporterhelper.WithTimeout(exporterhelper.TimeoutSettings{Timeout: eCfg.Timeout}),
+		exporterhelper.WithQueue(eCfg.QueueSettings),
+		exporterhelper.WithRetry(eCfg.RetrySettings),
 		exporterhelper.WithStart(fe.Start),
 		exporterhelper.WithShutdown(fe.Shutdown),
 	)
@@ -96,18 +113,17 @@ func createLogsExporter(
 	set component.ExporterCreateSettings,
 	cfg config.Exporter,
 ) (component.LogsExporter, error) {
+	eCfg := cfg.(*Config)
 	fe := exporters.GetOrAdd(cfg, func() component.Component {
-		return &site24x7exporter{
-			path: cfg.(*Config).Path,
-			url:  cfg.(*Config).Url,
-			apikey: cfg.(*Config).APIKEY,
-			insecure: cfg.(*Config).Insecure,
-		}
+		return newSite24x7Exporter(eCfg, set.Logger)
 	})
 	return exporterhelper.NewLogsExporter(
 		cfg,
 		set,
 		fe.Unwrap().(*site24x7exporter).ConsumeLogs,
+		exporterhelper.WithTimeout(exporterhelper.TimeoutSettings{Timeout: eCfg.Timeout}),
+		exporterhelper.WithQueue(eCfg.QueueSettings),
+		exporterhelper.WithRetry(eCfg.RetrySettings),
 		exporterhelper.WithStart(fe.Start),
 		exporterhelper.WithShutdown(fe.Shutdown),
 	)
@@ -0,0 +1,122 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// Run "go test -run Golden -update" to regenerate the golden files after an
+// intended change of the record mapping.
+var updateGolden = flag.Bool("update", false, "update the golden files in testdata/golden")
+
+// assertGolden compares the indented JSON encoding of v with the golden file.
+func assertGolden(t *testing.T, name string, v interface{}) {
+	actual, err := json.MarshalIndent(v, "", "  ")
+	require.NoError(t, err)
+	actual = append(actual, '\n')
+
+	path := filepath.Join("testdata", "golden", name)
+	if *updateGolden {
+		require.NoError(t, ioutil.WriteFile(path, actual, 0600))
+	}
+	expected, err := ioutil.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, string(expected), string(actual))
+}
+
+func goldenResource() map[string]interface{} {
+	return map[string]interface{}{
+		"service.name":           "orders",
+		"telemetry.sdk.language": "go",
+		"telemetry.sdk.name":     "opentelemetry",
+	}
+}
+
+func TestGoldenTelemetrySpans(t *testing.T) {
+	fe := newSite24x7Exporter(newTestConfig(""), zap.NewNop())
+
+	server := newSpanWithDetails()
+	server.SetKind(pdata.SpanKindServer)
+	server.SetStartTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, 0)))
+	server.SetEndTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, 250000000)))
+	server.Attributes().InsertString("http.method", "GET")
+	server.Attributes().InsertString("http.host", "shop.example.com")
+	server.Attributes().InsertString("http.target", "/orders?id=42&token=secret")
+	server.Attributes().InsertString("http.status_code", "404")
+	server.Attributes().InsertInt("thread.id", 7)
+
+	client := pdata.NewSpan()
+	client.SetTraceID(testTraceID1)
+	client.SetSpanID(pdata.NewSpanID([8]byte{2}))
+	client.SetParentSpanID(pdata.NewSpanID([8]byte{1}))
+	client.SetName("SELECT orders")
+	client.SetKind(pdata.SpanKindClient)
+	client.SetStartTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, 100000000)))
+	client.SetEndTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, 150000000)))
+	client.Attributes().InsertString("db.system", "postgresql")
+	client.Attributes().InsertString("db.name", "shop")
+	client.Attributes().InsertString("db.statement", "SELECT * FROM orders WHERE id = 42 AND owner = 'bob'")
+	client.Attributes().InsertString("db.connection_string", "postgres://app:s3cret@db:5432/shop")
+	client.Attributes().InsertString("server.address", "db")
+	client.Attributes().InsertInt("server.port", 5432)
+
+	spans := []TelemetrySpan{
+		fe.CreateTelemetrySpan(server, goldenResource(), "orders", "net/http", "1.0.0", "go", "opentelemetry", "GET /orders"),
+		fe.CreateTelemetrySpan(client, goldenResource(), "orders", "database/sql", "1.0.0", "go", "opentelemetry", "GET /orders"),
+	}
+	assertGolden(t, "spans.json", spans)
+}
+
+func TestGoldenTelemetryLogs(t *testing.T) {
+	fe := newSite24x7Exporter(newTestConfig(""), zap.NewNop())
+
+	text := pdata.NewLogRecord()
+	text.SetName("access")
+	text.SetTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000000, 0)))
+	text.SetSeverityText("INFO")
+	text.SetSeverityNumber(pdata.SeverityNumberINFO)
+	text.SetTraceID(testTraceID1)
+	text.SetSpanID(pdata.NewSpanID([8]byte{1}))
+	text.Body().SetStringVal("GET /orders 200")
+	text.Attributes().InsertString("http.method", "GET")
+
+	structured := pdata.NewLogRecord()
+	structured.SetTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000001, 0)))
+	structured.SetSeverityText("ERROR")
+	structured.SetSeverityNumber(pdata.SeverityNumberERROR)
+	body := pdata.NewAttributeValueMap()
+	body.MapVal().InsertString("msg", "order not found")
+	body.MapVal().InsertString("trace_id", "0102030405060708090a0b0c0d0e0f10")
+	body.MapVal().InsertString("span_id", "0102030405060708")
+	body.MapVal().InsertInt("order_id", 42)
+	body.CopyTo(structured.Body())
+
+	logs := []TelemetryLog{
+		fe.CreateLogItem(text, goldenResource()),
+		fe.CreateLogItem(structured, goldenResource()),
+	}
+	assertGolden(t, "logs.json", logs)
+}
@@ -0,0 +1,274 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package mockserver provides an in-process Site24x7 ingestion server for
+// tests. It accepts uploads to the AppLogs and the legacy Catalyst endpoints,
+// records their decoded payloads and can inject error and slow responses.
+package mockserver
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// AppLogsPath is the path of the AppLogs upload endpoint.
+	AppLogsPath = "/upload/site24x7postservlet"
+	// CatalystPath is the path of the legacy Catalyst traces endpoint.
+	CatalystPath = "/catalyst/traces"
+)
+
+// Upload is a request received by the server.
+type Upload struct {
+	// Path is the request path, either AppLogsPath or CatalystPath.
+	Path string
+	// Query holds the query parameters, the Catalyst endpoint receives the
+	// device key as license.key.
+	Query url.Values
+	// Header holds the request headers.
+	Header http.Header
+	// Payload is the uncompressed body of the request.
+	Payload []byte
+	// Records are the elements of the JSON array in Payload.
+	Records []json.RawMessage
+}
+
+// LogType returns the X-LogType header of an AppLogs upload.
+func (u Upload) LogType() string {
+	return u.Header.Get("X-LogType")
+}
+
+// Decode unmarshals the payload of the upload into v.
+func (u Upload) Decode(v interface{}) error {
+	return json.Unmarshal(u.Payload, v)
+}
+
+// Response is the answer to an upload. The zero value accepts the upload.
+type Response struct {
+	// StatusCode of the response, 200 when zero.
+	StatusCode int
+	// RetryAfter is sent in the Retry-After header when not empty.
+	RetryAfter string
+	// Delay is how long the server waits before it answers.
+	Delay time.Duration
+}
+
+// Responder decides how an upload is answered. It is called for every valid
+// upload without a queued response.
+type Responder func(u Upload) Response
+
+// Server is an in-process Site24x7 ingestion server.
+type Server struct {
+	*httptest.Server
+
+	mutex     sync.Mutex
+	uploads   []Upload
+	queued    []Response
+	responder Responder
+	requests  int
+}
+
+// New starts a server, it must be closed by the caller.
+func New() *Server {
+	s := &Server{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(AppLogsPath, s.handleAppLogs)
+	mux.HandleFunc(CatalystPath, s.handleCatalyst)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// AppLogsURL returns the URL of the AppLogs upload endpoint.
+func (s *Server) AppLogsURL() string {
+	return s.URL + AppLogsPath
+}
+
+// CatalystURL returns the URL of the legacy Catalyst traces endpoint.
+func (s *Server) CatalystURL() string {
+	return s.URL + CatalystPath
+}
+
+// Enqueue answers the next uploads with the given responses, in order.
+// Queued responses take precedence over the responder.
+func (s *Server) Enqueue(responses ...Response) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.queued = append(s.queued, responses...)
+}
+
+// SetResponder answers uploads with the responses returned by r, once the
+// queued responses are used up.
+func (s *Server) SetResponder(r Responder) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.responder = r
+}
+
+// Uploads returns the uploads accepted by the server, in the order they were received.
+func (s *Server) Uploads() []Upload {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Upload(nil), s.uploads...)
+}
+
+// Records returns the records of all accepted uploads of the given log type.
+func (s *Server) Records(logType string) []json.RawMessage {
+	var records []json.RawMessage
+	for _, u := range s.Uploads() {
+		if u.LogType() == logType {
+			records = append(records, u.Records...)
+		}
+	}
+	return records
+}
+
+// Requests returns the number of requests received, including rejected ones.
+func (s *Server) Requests() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.requests
+}
+
+// Reset forgets the received uploads.
+func (s *Server) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.uploads = nil
+	s.requests = 0
+}
+
+func (s *Server) handleAppLogs(w http.ResponseWriter, r *http.Request) {
+	if err := checkHeaders(r.Header); err != nil {
+		s.reject(w, err)
+		return
+	}
+	gz, err := gzip.NewReader(r.Body)
+	if err != nil {
+		s.reject(w, fmt.Errorf("body is not gzip compressed: %w", err))
+		return
+	}
+	payload, err := ioutil.ReadAll(gz)
+	if err != nil {
+		s.reject(w, fmt.Errorf("failed to decompress body: %w", err))
+		return
+	}
+	u, err := newUpload(r, payload)
+	if err != nil {
+		s.reject(w, err)
+		return
+	}
+	if size := r.Header.Get("Log-Size"); size != strconv.Itoa(len(u.Records)) {
+		s.reject(w, fmt.Errorf("log size %q does not match the %d records", size, len(u.Records)))
+		return
+	}
+	w.Header().Set("x-uploadid", fmt.Sprintf("upload-%d", s.Requests()+1))
+	s.respond(w, r, u)
+}
+
+func (s *Server) handleCatalyst(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Query().Get("license.key") == "" {
+		s.reject(w, errors.New("license.key is missing"))
+		return
+	}
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		s.reject(w, err)
+		return
+	}
+	u, err := newUpload(r, payload)
+	if err != nil {
+		s.reject(w, err)
+		return
+	}
+	s.respond(w, r, u)
+}
+
+func checkHeaders(h http.Header) error {
+	for _, name := range []string{"X-DeviceKey", "X-LogType", "Log-Size"} {
+		if h.Get(name) == "" {
+			return fmt.Errorf("header %s is missing", name)
+		}
+	}
+	if h.Get("Content-Encoding") != "gzip" {
+		return errors.New("content encoding must be gzip")
+	}
+	return nil
+}
+
+func newUpload(r *http.Request, payload []byte) (Upload, error) {
+	u := Upload{
+		Path:    r.URL.Path,
+		Query:   r.URL.Query(),
+		Header:  r.Header.Clone(),
+		Payload: payload,
+	}
+	if err := json.NewDecoder(bytes.NewReader(payload)).Decode(&u.Records); err != nil {
+		return u, fmt.Errorf("payload is not a JSON array: %w", err)
+	}
+	return u, nil
+}
+
+// reject answers an invalid request with 400 Bad Request.
+func (s *Server) reject(w http.ResponseWriter, err error) {
+	s.mutex.Lock()
+	s.requests++
+	s.mutex.Unlock()
+	http.Error(w, err.Error(), http.StatusBadRequest)
+}
+
+func (s *Server) respond(w http.ResponseWriter, r *http.Request, u Upload) {
+	s.mutex.Lock()
+	s.requests++
+	var resp Response
+	responder := s.responder
+	queued := len(s.queued) > 0
+	if queued {
+		resp = s.queued[0]
+		s.queued = s.queued[1:]
+	}
+	s.mutex.Unlock()
+
+	if !queued && responder != nil {
+		resp = responder(u)
+	}
+	if resp.Delay > 0 {
+		select {
+		case <-time.After(resp.Delay):
+		case <-r.Context().Done():
+			// The client gave up, the upload is not accepted.
+			return
+		}
+	}
+	if resp.StatusCode == 0 || resp.StatusCode/100 == 2 {
+		s.mutex.Lock()
+		s.uploads = append(s.uploads, u)
+		s.mutex.Unlock()
+	}
+	if resp.RetryAfter != "" {
+		w.Header().Set("Retry-After", resp.RetryAfter)
+	}
+	if resp.StatusCode != 0 {
+		w.WriteHeader(resp.StatusCode)
+	}
+}
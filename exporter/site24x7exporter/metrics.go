@@ -0,0 +1,65 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"go.opencensus.io/stats"
+	"go.opencensus.io/stats/view"
+	"go.opencensus.io/tag"
+)
+
+var (
+	tagLogType, _ = tag.NewKey("log_type")
+	tagSuccess, _ = tag.NewKey("success")
+
+	mUploads         = stats.Int64("site24x7_uploads", "Number of upload requests sent to Site24x7", stats.UnitDimensionless)
+	mUploadedRecords = stats.Int64("site24x7_uploaded_records", "Number of records accepted by Site24x7", stats.UnitDimensionless)
+	mUploadedBytes   = stats.Int64("site24x7_uploaded_bytes", "Number of compressed payload bytes accepted by Site24x7", stats.UnitBytes)
+
+	mSkippedDataPoints = stats.Int64("site24x7_skipped_data_points", "Number of metric data points not uploaded because of a NaN or infinite value", stats.UnitDimensionless)
+)
+
+// MetricViews return the metrics views according to given telemetry level.
+func MetricViews() []*view.View {
+	return []*view.View{
+		{
+			Name:        mUploads.Name(),
+			Measure:     mUploads,
+			Description: mUploads.Description(),
+			Aggregation: view.Count(),
+			TagKeys:     []tag.Key{tagLogType, tagSuccess},
+		},
+		{
+			Name:        mUploadedRecords.Name(),
+			Measure:     mUploadedRecords,
+			Description: mUploadedRecords.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagLogType},
+		},
+		{
+			Name:        mUploadedBytes.Name(),
+			Measure:     mUploadedBytes,
+			Description: mUploadedBytes.Description(),
+			Aggregation: view.Sum(),
+			TagKeys:     []tag.Key{tagLogType},
+		},
+		{
+			Name:        mSkippedDataPoints.Name(),
+			Measure:     mSkippedDataPoints,
+			Description: mSkippedDataPoints.Description(),
+			Aggregation: view.Sum(),
+		},
+	}
+}
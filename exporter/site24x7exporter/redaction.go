@@ -0,0 +1,279 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	defaultMaxStackTraceLength = 4096
+	redacted                   = "REDACTED"
+	truncatedSuffix            = "..."
+)
+
+var (
+	// userInfoPattern matches the password of the user info of a URL.
+	userInfoPattern = regexp.MustCompile(`(://[^:/@\s]*):[^@/\s]*@`)
+	// credentialParamPattern matches the value of credential parameters in
+	// query strings and key-value connection strings.
+	credentialParamPattern = regexp.MustCompile(`(?i)((?:^|[;&?\s])[\w.-]*(?:password|passwd|pwd|secret|token|api[_-]?key|access[_-]?key|auth|signature|credential)[\w.-]*\s*=\s*)[^;&\s#]*`)
+)
+
+// RedactionConfig defines how sensitive span fields are redacted before they
+// are uploaded. Obfuscation is enabled by default.
+type RedactionConfig struct {
+	// DisableSQLObfuscation uploads database statements as is, instead of
+	// replacing their literals with "?".
+	DisableSQLObfuscation bool `mapstructure:"disable_sql_obfuscation"`
+
+	// DisableCredentialStripping uploads connection strings and URLs as is,
+	// instead of redacting passwords, tokens and keys.
+	DisableCredentialStripping bool `mapstructure:"disable_credential_stripping"`
+
+	// AllowedCustomParams are regular expressions matching the span attributes
+	// uploaded as custom parameters. All attributes are uploaded when empty.
+	AllowedCustomParams []string `mapstructure:"allowed_custom_params"`
+
+	// DeniedCustomParams are regular expressions matching the span attributes
+	// never uploaded as custom parameters. They take precedence over
+	// AllowedCustomParams.
+	DeniedCustomParams []string `mapstructure:"denied_custom_params"`
+
+	// MaxStackTraceLength is the maximum length in bytes of an exception stack
+	// trace, longer ones are truncated. Default is 4096 when zero.
+	MaxStackTraceLength int `mapstructure:"max_stack_trace_length"`
+}
+
+func compilePatterns(patterns []string) ([]*regexp.Regexp, error) {
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid custom param pattern %q: %w", p, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return compiled, nil
+}
+
+// Validate checks if the redaction configuration is valid.
+func (cfg *RedactionConfig) Validate() error {
+	if _, err := compilePatterns(cfg.AllowedCustomParams); err != nil {
+		return err
+	}
+	if _, err := compilePatterns(cfg.DeniedCustomParams); err != nil {
+		return err
+	}
+	if cfg.MaxStackTraceLength < 0 {
+		return errors.New("max_stack_trace_length must not be negative")
+	}
+	return nil
+}
+
+// spanRedactor removes sensitive data from span records.
+type spanRedactor struct {
+	obfuscateSQL        bool
+	stripCredentials    bool
+	allowed             []*regexp.Regexp
+	denied              []*regexp.Regexp
+	maxStackTraceLength int
+	// sqlKeys and credentialKeys are the span attributes holding database
+	// statements and connection strings or URLs, their custom parameters are
+	// redacted like the mapped fields.
+	sqlKeys        map[string]bool
+	credentialKeys map[string]bool
+}
+
+// newSpanRedactor creates a redactor for the configuration, which must have
+// been validated.
+func newSpanRedactor(cfg RedactionConfig, mapper *spanAttributeMapper) *spanRedactor {
+	allowed, _ := compilePatterns(cfg.AllowedCustomParams)
+	denied, _ := compilePatterns(cfg.DeniedCustomParams)
+	maxStackTraceLength := cfg.MaxStackTraceLength
+	if maxStackTraceLength == 0 {
+		maxStackTraceLength = defaultMaxStackTraceLength
+	}
+	return &spanRedactor{
+		obfuscateSQL:        !cfg.DisableSQLObfuscation,
+		stripCredentials:    !cfg.DisableCredentialStripping,
+		allowed:             allowed,
+		denied:              denied,
+		maxStackTraceLength: maxStackTraceLength,
+		sqlKeys:             mapper.sourceKeys("db_statement"),
+		credentialKeys:      mapper.sourceKeys("connection_string", "url"),
+	}
+}
+
+// redact obfuscates, strips and truncates the sensitive fields of the span
+// record and drops the custom parameters that must not be uploaded.
+func (r *spanRedactor) redact(span *TelemetrySpan) {
+	if r.obfuscateSQL {
+		span.DbStatement = obfuscateSQL(span.DbStatement, span.DbSystem)
+	}
+	if r.stripCredentials {
+		span.DbConnStr = stripCredentials(span.DbConnStr)
+		span.HttpUrl = stripCredentials(span.HttpUrl)
+	}
+	for i, st := range span.ExceptionStackTrace {
+		span.ExceptionStackTrace[i] = truncate(st, r.maxStackTraceLength)
+	}
+	for _, event := range span.Events {
+		if st, ok := event.EventAttributes["exception.stacktrace"].(string); ok {
+			event.EventAttributes["exception.stacktrace"] = truncate(st, r.maxStackTraceLength)
+		}
+	}
+
+	params := span.CustomParams[:0]
+	for _, param := range span.CustomParams {
+		if !r.customParamAllowed(param.Key) {
+			continue
+		}
+		if s, ok := param.Value.(string); ok {
+			switch {
+			case r.obfuscateSQL && r.sqlKeys[param.Key]:
+				param.Value = obfuscateSQL(s, span.DbSystem)
+			case r.stripCredentials && r.credentialKeys[param.Key]:
+				param.Value = stripCredentials(s)
+			}
+		}
+		params = append(params, param)
+	}
+	span.CustomParams = params
+}
+
+func (r *spanRedactor) customParamAllowed(key string) bool {
+	for _, re := range r.denied {
+		if re.MatchString(key) {
+			return false
+		}
+	}
+	if len(r.allowed) == 0 {
+		return true
+	}
+	for _, re := range r.allowed {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c >= utf8.RuneSelf
+}
+
+// doubleQuotedStringSystems are the database systems, as given by db.system,
+// where a double quoted token is a string literal rather than an identifier.
+var doubleQuotedStringSystems = map[string]bool{
+	"mysql":   true,
+	"mariadb": true,
+}
+
+// skipString returns the index following the string literal opened by the
+// quote at stmt[i]. Backslash escapes and doubled quotes are skipped.
+func skipString(stmt string, i int) int {
+	quote := stmt[i]
+	i++
+	for i < len(stmt) {
+		if stmt[i] == '\\' {
+			i += 2
+			continue
+		}
+		if stmt[i] == quote {
+			// A doubled quote is an escaped quote.
+			if i+1 < len(stmt) && stmt[i+1] == quote {
+				i += 2
+				continue
+			}
+			return i + 1
+		}
+		i++
+	}
+	return i
+}
+
+// obfuscateSQL replaces the string and numeric literals of a SQL statement
+// with "?". Quoted identifiers, placeholders and the digits of identifiers
+// are kept. Double quotes delimit identifiers, except for the database
+// systems where they delimit strings, such as MySQL.
+func obfuscateSQL(stmt string, dbSystem string) string {
+	doubleQuotedStrings := doubleQuotedStringSystems[strings.ToLower(dbSystem)]
+	var sb strings.Builder
+	sb.Grow(len(stmt))
+	for i := 0; i < len(stmt); {
+		c := stmt[i]
+		switch {
+		case c == '\'' || c == '"' && doubleQuotedStrings:
+			i = skipString(stmt, i)
+			sb.WriteByte('?')
+		case c == '"' || c == '`':
+			end := strings.IndexByte(stmt[i+1:], c)
+			if end < 0 {
+				sb.WriteString(stmt[i:])
+				return sb.String()
+			}
+			sb.WriteString(stmt[i : i+end+2])
+			i += end + 2
+		case c >= '0' && c <= '9':
+			// Numbers including decimals, exponents and hex literals.
+			for i < len(stmt) && (isIdentChar(stmt[i]) || stmt[i] == '.') {
+				i++
+			}
+			sb.WriteByte('?')
+		case isIdentChar(c):
+			start := i
+			for i < len(stmt) && isIdentChar(stmt[i]) {
+				i++
+			}
+			sb.WriteString(stmt[start:i])
+		default:
+			sb.WriteByte(c)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// stripCredentials redacts the password of the user info and the values of
+// credential parameters such as password, token or api_key of a URL or a
+// connection string.
+func stripCredentials(s string) string {
+	if s == "" {
+		return s
+	}
+	s = userInfoPattern.ReplaceAllString(s, "${1}:"+redacted+"@")
+	return credentialParamPattern.ReplaceAllString(s, "${1}"+redacted)
+}
+
+// truncate shortens s to at most max bytes without splitting a UTF-8
+// encoded character.
+func truncate(s string, max int) string {
+	if len(s) <= max {
+		return s
+	}
+	cut := max - len(truncatedSuffix)
+	if cut < 0 {
+		cut = 0
+	}
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+	return s[:cut] + truncatedSuffix
+}
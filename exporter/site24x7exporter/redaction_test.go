@@ -0,0 +1,153 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestObfuscateSQL(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE name = 'bob' AND age > 42":    "SELECT * FROM users WHERE name = ? AND age > ?",
+		"SELECT * FROM t1 WHERE id IN (1, 2.5, -3, 0x1F)":        "SELECT * FROM t1 WHERE id IN (?, ?, -?, ?)",
+		"UPDATE \"table2\" SET note = 'it''s' WHERE `col3` = $1": "UPDATE \"table2\" SET note = ? WHERE `col3` = $1",
+		"INSERT INTO logs VALUES ('a\\'b', 1e10)":                "INSERT INTO logs VALUES (?, ?)",
+		"SELECT name FROM users WHERE email = 'unterminated":     "SELECT name FROM users WHERE email = ?",
+		"SELECT \"unterminated":                                  "SELECT \"unterminated",
+		"":                                                       "",
+	}
+	for stmt, expected := range tests {
+		assert.Equal(t, expected, obfuscateSQL(stmt, "postgresql"), stmt)
+	}
+}
+
+func TestObfuscateSQLDoubleQuotedStrings(t *testing.T) {
+	tests := map[string]string{
+		"SELECT * FROM users WHERE password = \"hunter2\"":          "SELECT * FROM users WHERE password = ?",
+		"UPDATE `users` SET note = \"say \"\"hi\"\"\" WHERE id = 1": "UPDATE `users` SET note = ? WHERE id = ?",
+		"INSERT INTO logs VALUES (\"a\\\"b\", 'c')":                 "INSERT INTO logs VALUES (?, ?)",
+		"SELECT name FROM users WHERE email = \"unterminated":       "SELECT name FROM users WHERE email = ?",
+	}
+	for _, dbSystem := range []string{"mysql", "mariadb", "MySQL"} {
+		for stmt, expected := range tests {
+			assert.Equal(t, expected, obfuscateSQL(stmt, dbSystem), stmt)
+		}
+	}
+	// Other systems quote identifiers with double quotes.
+	assert.Equal(t, "SELECT \"password\" FROM users WHERE id = ?", obfuscateSQL("SELECT \"password\" FROM users WHERE id = 1", ""))
+}
+
+func TestStripCredentials(t *testing.T) {
+	tests := map[string]string{
+		"postgres://admin:s3cret@db:5432/orders":                        "postgres://admin:REDACTED@db:5432/orders",
+		"Server=db;User Id=sa;Password=s3cret;Database=orders":          "Server=db;User Id=sa;Password=REDACTED;Database=orders",
+		"https://example.com/cb?code=1&access_token=abc&api_key=k#frag": "https://example.com/cb?code=1&access_token=REDACTED&api_key=REDACTED#frag",
+		"jdbc:mysql://db/orders?user=app&password=s3cret":               "jdbc:mysql://db/orders?user=app&password=REDACTED",
+		"https://example.com/orders?id=1":                               "https://example.com/orders?id=1",
+	}
+	for s, expected := range tests {
+		assert.Equal(t, expected, stripCredentials(s), s)
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	assert.Equal(t, "short", truncate("short", 10))
+	assert.Equal(t, "abcdefg...", truncate(strings.Repeat("abcdefghij", 2), 10))
+	// The multi-byte character is not split.
+	assert.Equal(t, "abcdef...", truncate("abcdefé€xyz", 10))
+}
+
+func TestSpanRedactor(t *testing.T) {
+	r := newSpanRedactor(RedactionConfig{
+		DeniedCustomParams:  []string{`^http\.request\.header\.`},
+		MaxStackTraceLength: 10,
+	}, newSpanAttributeMapper(nil))
+
+	span := TelemetrySpan{
+		DbStatement:         "SELECT * FROM users WHERE id = 7",
+		DbConnStr:           "mysql://app:pw@db/users",
+		HttpUrl:             "https://example.com/?token=abc",
+		ExceptionStackTrace: []string{strings.Repeat("x", 20)},
+		CustomParams: []TelemetryCustomParam{
+			{Key: "db.statement", Value: "SELECT * FROM users WHERE id = 7"},
+			{Key: "http.url", Value: "https://example.com/?token=abc"},
+			{Key: "http.request.header.authorization", Value: "Bearer abc"},
+			{Key: "http.status_code", Value: int64(200)},
+		},
+	}
+	r.redact(&span)
+	assert.Equal(t, "SELECT * FROM users WHERE id = ?", span.DbStatement)
+	assert.Equal(t, "mysql://app:REDACTED@db/users", span.DbConnStr)
+	assert.Equal(t, "https://example.com/?token=REDACTED", span.HttpUrl)
+	assert.Equal(t, []string{"xxxxxxx..."}, span.ExceptionStackTrace)
+	assert.Equal(t, []TelemetryCustomParam{
+		{Key: "db.statement", Value: "SELECT * FROM users WHERE id = ?"},
+		{Key: "http.url", Value: "https://example.com/?token=REDACTED"},
+		{Key: "http.status_code", Value: int64(200)},
+	}, span.CustomParams)
+}
+
+func TestSpanRedactorMySQL(t *testing.T) {
+	r := newSpanRedactor(RedactionConfig{}, newSpanAttributeMapper(nil))
+	span := TelemetrySpan{
+		DbSystem:    "mysql",
+		DbStatement: "SELECT * FROM users WHERE password = \"hunter2\"",
+		CustomParams: []TelemetryCustomParam{
+			{Key: "db.statement", Value: "SELECT * FROM users WHERE password = \"hunter2\""},
+		},
+	}
+	r.redact(&span)
+	assert.Equal(t, "SELECT * FROM users WHERE password = ?", span.DbStatement)
+	assert.Equal(t, []TelemetryCustomParam{
+		{Key: "db.statement", Value: "SELECT * FROM users WHERE password = ?"},
+	}, span.CustomParams)
+}
+
+func TestSpanRedactorAllowList(t *testing.T) {
+	r := newSpanRedactor(RedactionConfig{
+		DisableSQLObfuscation:      true,
+		DisableCredentialStripping: true,
+		AllowedCustomParams:        []string{`^http\.`, `^db\.statement$`},
+		DeniedCustomParams:         []string{`^http\.url$`},
+	}, newSpanAttributeMapper(nil))
+
+	span := TelemetrySpan{
+		DbStatement: "SELECT 1",
+		HttpUrl:     "https://example.com/?token=abc",
+		CustomParams: []TelemetryCustomParam{
+			{Key: "db.statement", Value: "SELECT 1"},
+			{Key: "http.url", Value: "https://example.com/?token=abc"},
+			{Key: "http.method", Value: "GET"},
+			{Key: "enduser.id", Value: "bob"},
+		},
+	}
+	r.redact(&span)
+	assert.Equal(t, "SELECT 1", span.DbStatement)
+	assert.Equal(t, "https://example.com/?token=abc", span.HttpUrl)
+	assert.Equal(t, []TelemetryCustomParam{
+		{Key: "db.statement", Value: "SELECT 1"},
+		{Key: "http.method", Value: "GET"},
+	}, span.CustomParams)
+}
+
+func TestRedactionConfigValidate(t *testing.T) {
+	assert.NoError(t, (&RedactionConfig{}).Validate())
+	assert.Error(t, (&RedactionConfig{AllowedCustomParams: []string{"("}}).Validate())
+	assert.Error(t, (&RedactionConfig{DeniedCustomParams: []string{"["}}).Validate())
+	assert.Error(t, (&RedactionConfig{MaxStackTraceLength: -1}).Validate())
+}
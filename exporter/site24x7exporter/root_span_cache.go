@@ -0,0 +1,201 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+const (
+	defaultRootSpanCacheMaxTraces      = 10000
+	defaultRootSpanCacheTTL            = 5 * time.Minute
+	defaultRootSpanCacheMaxHeldBatches = 2
+)
+
+// RootSpanCacheConfig defines the cache remembering the root span of every
+// trace across batches, so that spans arriving in a different batch than
+// their root span are still uploaded with its name.
+type RootSpanCacheConfig struct {
+	// Enabled turns the cache on. When disabled, only root spans of the same
+	// batch are resolved.
+	Enabled bool `mapstructure:"enabled"`
+
+	// MaxTraces is the maximum number of traces in the cache, the least
+	// recently used traces are evicted. Default is 10000 when zero.
+	MaxTraces int `mapstructure:"max_traces"`
+
+	// TTL is how long the root span of a trace is remembered. Default is 5m
+	// when zero.
+	TTL time.Duration `mapstructure:"ttl"`
+
+	// HoldWindow is how long a batch containing spans with an unknown root
+	// span waits for the root span to arrive in another batch before it is
+	// uploaded. The wait counts against the timeout and only helps when the
+	// sending queue has more than one consumer. Disabled when zero.
+	HoldWindow time.Duration `mapstructure:"hold_window"`
+
+	// MaxHeldBatches is the maximum number of batches waiting for root spans
+	// at once, other batches are uploaded right away. Default is 2 when zero.
+	MaxHeldBatches int `mapstructure:"max_held_batches"`
+}
+
+// rootSpan is what is known about the root span of a trace.
+type rootSpan struct {
+	name    string
+	service string
+}
+
+type rootSpanEntry struct {
+	rootSpan
+	expires time.Time
+}
+
+// rootSpanCache is a bounded LRU cache of the root spans of traces with a TTL.
+// Waiters are notified whenever root spans are added.
+type rootSpanCache struct {
+	mutex   sync.Mutex
+	lru     *simplelru.LRU
+	ttl     time.Duration
+	added   chan struct{}
+	held    chan struct{} // a slot for every batch that may wait at once
+	nowFunc func() time.Time
+}
+
+func newRootSpanCache(cfg RootSpanCacheConfig) *rootSpanCache {
+	maxTraces := cfg.MaxTraces
+	if maxTraces <= 0 {
+		maxTraces = defaultRootSpanCacheMaxTraces
+	}
+	ttl := cfg.TTL
+	if ttl <= 0 {
+		ttl = defaultRootSpanCacheTTL
+	}
+	maxHeldBatches := cfg.MaxHeldBatches
+	if maxHeldBatches <= 0 {
+		maxHeldBatches = defaultRootSpanCacheMaxHeldBatches
+	}
+	// NewLRU only fails for a non-positive size.
+	lru, _ := simplelru.NewLRU(maxTraces, nil)
+	return &rootSpanCache{
+		lru:     lru,
+		ttl:     ttl,
+		added:   make(chan struct{}),
+		held:    make(chan struct{}, maxHeldBatches),
+		nowFunc: time.Now,
+	}
+}
+
+// add remembers the root spans and wakes up the waiters.
+func (c *rootSpanCache) add(roots map[pdata.TraceID]rootSpan) {
+	if len(roots) == 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	expires := c.nowFunc().Add(c.ttl)
+	for traceID, root := range roots {
+		c.lru.Add(traceID, rootSpanEntry{rootSpan: root, expires: expires})
+	}
+	close(c.added)
+	c.added = make(chan struct{})
+}
+
+// get returns the root span of the trace, if it is known and not expired.
+func (c *rootSpanCache) get(traceID pdata.TraceID) (rootSpan, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	value, found := c.lru.Get(traceID)
+	if !found {
+		return rootSpan{}, false
+	}
+	entry := value.(rootSpanEntry)
+	if c.nowFunc().After(entry.expires) {
+		c.lru.Remove(traceID)
+		return rootSpan{}, false
+	}
+	return entry.rootSpan, true
+}
+
+// changed returns a channel that is closed when root spans are added next.
+func (c *rootSpanCache) changed() <-chan struct{} {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.added
+}
+
+// resolve looks up the root spans of the pending traces and removes the
+// resolved ones from pending.
+func (c *rootSpanCache) resolve(pending map[pdata.TraceID][]int, resolved func(index int, root rootSpan)) {
+	for traceID, indexes := range pending {
+		root, found := c.get(traceID)
+		if !found {
+			continue
+		}
+		for _, i := range indexes {
+			resolved(i, root)
+		}
+		delete(pending, traceID)
+	}
+}
+
+// wait resolves pending traces as their root spans arrive, until all of them
+// are resolved, the hold window has passed or the context is done. The batch
+// doesn't wait when as many batches as there are slots already do, and the
+// wait ends halfway to the deadline of the context at the latest, so that
+// the upload has time left.
+func (c *rootSpanCache) wait(ctx context.Context, holdWindow time.Duration, pending map[pdata.TraceID][]int, resolved func(index int, root rootSpan)) {
+	c.resolve(pending, resolved)
+	if len(pending) == 0 || ctx.Err() != nil {
+		return
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		if half := time.Until(deadline) / 2; half < holdWindow {
+			holdWindow = half
+		}
+	}
+	if holdWindow <= 0 {
+		return
+	}
+	select {
+	case c.held <- struct{}{}:
+		defer func() { <-c.held }()
+	default:
+		return
+	}
+
+	timer := time.NewTimer(holdWindow)
+	defer timer.Stop()
+	for len(pending) > 0 {
+		changed := c.changed()
+		c.resolve(pending, resolved)
+		if len(pending) == 0 {
+			return
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
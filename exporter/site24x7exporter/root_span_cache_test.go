@@ -0,0 +1,179 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+var (
+	testTraceID1 = pdata.NewTraceID([16]byte{1})
+	testTraceID2 = pdata.NewTraceID([16]byte{2})
+)
+
+// newTestSpan returns a batch with a single span, parentID is empty for root spans.
+func newTestSpan(service string, traceID pdata.TraceID, name string, parentID pdata.SpanID) pdata.Traces {
+	td := pdata.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().InsertString("service.name", service)
+	span := rs.InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID(traceID)
+	span.SetSpanID(pdata.NewSpanID([8]byte{2}))
+	span.SetParentSpanID(parentID)
+	span.SetName(name)
+	return td
+}
+
+func TestRootSpanCacheTTLAndEviction(t *testing.T) {
+	c := newRootSpanCache(RootSpanCacheConfig{MaxTraces: 1, TTL: time.Minute})
+	now := time.Unix(1600000000, 0)
+	c.nowFunc = func() time.Time { return now }
+
+	c.add(map[pdata.TraceID]rootSpan{testTraceID1: {name: "GET /", service: "frontend"}})
+	root, found := c.get(testTraceID1)
+	require.True(t, found)
+	assert.Equal(t, rootSpan{name: "GET /", service: "frontend"}, root)
+
+	now = now.Add(2 * time.Minute)
+	_, found = c.get(testTraceID1)
+	assert.False(t, found, "expired")
+
+	c.add(map[pdata.TraceID]rootSpan{testTraceID1: {name: "GET /"}})
+	c.add(map[pdata.TraceID]rootSpan{testTraceID2: {name: "POST /"}})
+	_, found = c.get(testTraceID1)
+	assert.False(t, found, "evicted")
+	_, found = c.get(testTraceID2)
+	assert.True(t, found)
+}
+
+func TestRootSpanCacheWait(t *testing.T) {
+	c := newRootSpanCache(RootSpanCacheConfig{})
+	pending := map[pdata.TraceID][]int{testTraceID1: {0, 2}, testTraceID2: {1}}
+	resolved := make(map[int]string)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		c.add(map[pdata.TraceID]rootSpan{testTraceID1: {name: "GET /"}})
+	}()
+	start := time.Now()
+	c.wait(context.Background(), 200*time.Millisecond, pending, func(i int, root rootSpan) {
+		resolved[i] = root.name
+	})
+	assert.GreaterOrEqual(t, int64(time.Since(start)), int64(200*time.Millisecond), "trace 2 is never resolved")
+	assert.Equal(t, map[int]string{0: "GET /", 2: "GET /"}, resolved)
+	assert.Equal(t, map[pdata.TraceID][]int{testTraceID2: {1}}, pending)
+}
+
+func TestRootSpanCacheWaitEndsBeforeDeadline(t *testing.T) {
+	c := newRootSpanCache(RootSpanCacheConfig{})
+	pending := map[pdata.TraceID][]int{testTraceID1: {0}}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	c.wait(ctx, time.Minute, pending, func(int, rootSpan) {})
+	elapsed := time.Since(start)
+	assert.GreaterOrEqual(t, int64(elapsed), int64(50*time.Millisecond))
+	assert.Less(t, int64(elapsed), int64(150*time.Millisecond), "half of the time left is kept for the upload")
+	require.NoError(t, ctx.Err())
+}
+
+func TestRootSpanCacheWaitCancelled(t *testing.T) {
+	c := newRootSpanCache(RootSpanCacheConfig{})
+	pending := map[pdata.TraceID][]int{testTraceID1: {0}}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+	start := time.Now()
+	c.wait(ctx, time.Minute, pending, func(int, rootSpan) {})
+	assert.Less(t, int64(time.Since(start)), int64(time.Second))
+
+	start = time.Now()
+	c.wait(ctx, time.Minute, pending, func(int, rootSpan) {})
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Millisecond), "cancelled before waiting")
+}
+
+func TestRootSpanCacheWaitMaxHeldBatches(t *testing.T) {
+	c := newRootSpanCache(RootSpanCacheConfig{MaxHeldBatches: 1})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	held := make(chan struct{})
+	go func() {
+		defer close(held)
+		c.wait(ctx, time.Minute, map[pdata.TraceID][]int{testTraceID1: {0}}, func(int, rootSpan) {})
+	}()
+	require.Eventually(t, func() bool { return len(c.held) == 1 }, time.Second, time.Millisecond)
+
+	start := time.Now()
+	c.wait(ctx, time.Minute, map[pdata.TraceID][]int{testTraceID2: {0}}, func(int, rootSpan) {})
+	assert.Less(t, int64(time.Since(start)), int64(10*time.Millisecond), "no slot left")
+
+	c.add(map[pdata.TraceID]rootSpan{testTraceID1: {name: "GET /"}})
+	<-held
+	assert.Len(t, c.held, 0)
+}
+
+func TestConsumeTracesResolvesRootAcrossBatches(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.RootSpanCache.Enabled = true
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	require.NoError(t, fe.ConsumeTraces(context.Background(), newTestSpan("frontend", testTraceID1, "GET /", pdata.SpanID{})))
+	require.NoError(t, fe.ConsumeTraces(context.Background(), newTestSpan("backend", testTraceID1, "SELECT", pdata.NewSpanID([8]byte{1}))))
+
+	var records []TelemetrySpan
+	require.NoError(t, lastUpload(t, server).Decode(&records))
+	require.Len(t, records, 1)
+	assert.Equal(t, "GET /", records[0].RootSpanId)
+	assert.Equal(t, "frontend", records[0].RootServiceName)
+}
+
+func TestConsumeTracesHoldsSpansForLateRoot(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.RootSpanCache.Enabled = true
+	cfg.RootSpanCache.HoldWindow = time.Second
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		assert.NoError(t, fe.ConsumeTraces(context.Background(), newTestSpan("backend", testTraceID1, "SELECT", pdata.NewSpanID([8]byte{1}))))
+	}()
+	time.Sleep(10 * time.Millisecond)
+	fe.rootSpans.add(batchRootSpans(newTestSpan("frontend", testTraceID1, "GET /", pdata.SpanID{})))
+	wg.Wait()
+
+	var records []TelemetrySpan
+	require.NoError(t, lastUpload(t, server).Decode(&records))
+	require.Len(t, records, 1)
+	assert.Equal(t, "SELECT", records[0].Name)
+	assert.Equal(t, "GET /", records[0].RootSpanId)
+}
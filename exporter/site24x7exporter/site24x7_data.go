@@ -30,21 +30,26 @@ type TelemetryCustomParam struct {
 }
 
 type TelemetrySpan struct {
-	Timestamp    int64	 `json:"_zl_timestamp"`
-	S247UID      string	 `json:"s247agentuid"`
-	TraceId      string  `json:"trace_id,omitempty"`
-	SpanId       string  `json:"span_id,omitempty"`
-	ParentSpanId string  `json:"parent_id,omitempty"`
-	RootSpanId	 string  `json:"origin_name,omitempty"`
-	Name         string  `json:"name,omitempty"`
-	Kind         string  `json:"span_kind,omitempty"`
-	StartTime    int64   `json:"start_time,omitempty"`
-	EndTime      int64   `json:"end_time,omitempty"`
-	Duration     float64 `json:"duration,omitempty"`
+	Timestamp    int64  `json:"_zl_timestamp"`
+	S247UID      string `json:"s247agentuid"`
+	TraceId      string `json:"trace_id,omitempty"`
+	SpanId       string `json:"span_id,omitempty"`
+	ParentSpanId string `json:"parent_id,omitempty"`
+	RootSpanId   string `json:"origin_name,omitempty"`
+	// service.name of the resource of the root span.
+	RootServiceName string  `json:"origin_service,omitempty"`
+	Name            string  `json:"name,omitempty"`
+	Kind            string  `json:"span_kind,omitempty"`
+	StartTime       int64   `json:"start_time,omitempty"`
+	EndTime         int64   `json:"end_time,omitempty"`
+	Duration        float64 `json:"duration,omitempty"`
 
 	// resource->attributes[]->key('service.name')
 	ServiceName string `json:"service_name,omitempty"`
 
+	// Events[]->timestamp of the exception events, in milliseconds. The
+	// exception fields hold one entry per exception event.
+	ExceptionTimestamp []int64 `json:"exception_time,omitempty"`
 	// Events[]->eventAttributes->exception.message
 	ExceptionMessage []string `json:"exception_message,omitempty"`
 	// Events[]->eventAttributes->exception.stacktrace
@@ -96,28 +101,79 @@ type TelemetrySpan struct {
 	// cusom_param
 	CustomParams []TelemetryCustomParam `json:"custom_param,omitempty"`
 
-	resourceAttributes     telemetryAttributes  //`json:"ResourceAttributes"`
-	spanAttributes         telemetryAttributes  //`json:"SpanAttributes"`
-	traceState             string               //`json:"TraceState"`
-	spanEvents             []TelemetrySpanEvent //`json:"Events"`
-	spanLinks              []TelemetrySpanLink  //`json:"Links"`
-	statusCode             string               //`json:"status.code"`
-	statusMsg              string               //`json:"status.msg"`
-	droppedAttributesCount uint32               //`json:"DroppedAttributesCount"`
-	droppedLinksCount      uint32               //`json:"DroppedLinksCount"`
-	droppedEventsCount     uint32               //`json:"DroppedEventsCount"`
+	// spans->events[], unless export_span_events is disabled.
+	Events []TelemetrySpanEvent `json:"events,omitempty"`
+	// spans->links[], unless export_span_links is disabled.
+	Links []TelemetrySpanLink `json:"links,omitempty"`
+	// spans->status->code
+	StatusCode string `json:"status_code,omitempty"`
+	// spans->status->message
+	StatusMessage string `json:"status_message,omitempty"`
+	// spans->traceState
+	TraceState string `json:"trace_state,omitempty"`
+	// spans->droppedAttributesCount
+	DroppedAttributesCount uint32 `json:"dropped_attributes_count,omitempty"`
+	// spans->droppedEventsCount
+	DroppedEventsCount uint32 `json:"dropped_events_count,omitempty"`
+	// spans->droppedLinksCount
+	DroppedLinksCount uint32 `json:"dropped_links_count,omitempty"`
+
+	resourceAttributes telemetryAttributes //`json:"ResourceAttributes"`
+	spanAttributes     telemetryAttributes //`json:"SpanAttributes"`
 }
 
 type TelemetryLog struct {
-	TraceId                string              `json:"TraceId"`
-	SpanId                 string              `json:"SpanId"`
-	Timestamp              int64               `json:"_zl_timestamp"`
-	S247UID                string              `json:"s247agentuid"`
-	Name                   string              `json:"name"`
-	LogLevel               string              `json:"LogLevel"`
-	Message                string              `json:"Message"`
-	LogAttributes          telemetryAttributes `json:"attributes"`
+	TraceId        string              `json:"TraceId"`
+	SpanId         string              `json:"SpanId"`
+	Timestamp      int64               `json:"_zl_timestamp"`
+	S247UID        string              `json:"s247agentuid"`
+	Name           string              `json:"name"`
+	LogLevel       string              `json:"LogLevel"`
+	SeverityNumber int32               `json:"SeverityNumber,omitempty"`
+	Message        string              `json:"Message"`
+	LogAttributes  telemetryAttributes `json:"attributes"`
+	// Fields of a structured body, nested fields are flattened into dotted keys.
+	Body                   telemetryAttributes `json:"body,omitempty"`
 	ResourceAttributes     telemetryAttributes `json:"ResourceAttributes"`
 	DroppedAttributesCount uint32              `json:"DroppedAttributesCount"`
 	TraceFlag              uint32              `json:"TraceFlag"`
 }
+
+type TelemetryQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type TelemetryMetric struct {
+	Timestamp   int64  `json:"_zl_timestamp"`
+	S247UID     string `json:"s247agentuid"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// metrics->unit, mapped from UCUM to the Site24x7 unit names.
+	Unit string `json:"unit,omitempty"`
+	// gauge, sum, histogram or summary.
+	Type string `json:"metric_type"`
+	// delta or cumulative. Monotonic cumulative sums and histograms are converted to delta.
+	Temporality string `json:"temporality,omitempty"`
+	IsMonotonic bool   `json:"monotonic,omitempty"`
+	StartTime   int64  `json:"start_time,omitempty"`
+
+	// resource->attributes[]->key('service.name')
+	ServiceName string `json:"service_name,omitempty"`
+	// instrumentationLibraryMetrics[]->instrumentationLibrary->name
+	InstrumentationLibrary string `json:"instrumentation_name,omitempty"`
+	// instrumentationLibraryMetrics[]->instrumentationLibrary->version
+	InstrumentationLibraryVersion string `json:"instrumentation_version,omitempty"`
+
+	// Value of gauge and sum data points.
+	Value float64 `json:"value"`
+	// Count and sum of histogram and summary data points.
+	Count          uint64              `json:"count,omitempty"`
+	Sum            float64             `json:"sum,omitempty"`
+	BucketCounts   []uint64            `json:"bucket_counts,omitempty"`
+	ExplicitBounds []float64           `json:"explicit_bounds,omitempty"`
+	Quantiles      []TelemetryQuantile `json:"quantiles,omitempty"`
+
+	// Resource attributes merged with the data point attributes.
+	Dimensions telemetryAttributes `json:"dimensions,omitempty"`
+}
@@ -21,92 +21,245 @@ import (
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
+	"strconv"
 	"sync"
+	"time"
 
-	//"github.com/open-telemetry/opentelemetry-proto/gen/go/common/v1"
-
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
 	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config/confighttp"
 	"go.opentelemetry.io/collector/consumer"
-	"go.opentelemetry.io/collector/model/otlp"
-	"go.opentelemetry.io/collector/model/pdata"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/exporter/exporterhelper"
+	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Values of the X-LogType header, identifying the kind of records in an AppLogs upload.
+const (
+	logTypeTraces  = "s247apmopentelemetrytracing"
+	logTypeLogs    = "otellogs"
+	logTypeMetrics = "s247apmopentelemetrymetrics"
 )
 
-// Marshaler configuration used for marhsaling Protobuf to JSON.
-//var tracesMarshaler = otlp.NewJSONTracesMarshaler()
-var metricsMarshaler = otlp.NewJSONMetricsMarshaler()
-//var logsMarshaler = otlp.NewJSONLogsMarshaler()
+// Values of the traces_api setting.
+const (
+	tracesAPIAppLogs  = "applogs"
+	tracesAPICatalyst = "catalyst"
+)
 
-// site24x7exporter is the implementation of file exporter that writes telemetry data to a file
-// in Protobuf-JSON format.
+// site24x7exporter translates telemetry into Site24x7 records and uploads them.
 type site24x7exporter struct {
-	path  string
-	url   string
-	apikey string
-	insecure bool
-	file  io.WriteCloser
-	mutex sync.Mutex
+	endpoints signalEndpoints
+	// catalyst uploads spans through the deprecated Catalyst API.
+	catalyst bool
+	apikey   string
+	logger   *zap.Logger
+	// clientSettings is used to build a dedicated HTTP client in Start.
+	clientSettings confighttp.HTTPClientSettings
+	client         *http.Client
+	// maxRecords and maxBytes limit the size of a single upload request.
+	maxRecords int
+	maxBytes   int
+	// dumpSettings configures the optional payload dump, dump is nil when it is disabled.
+	dumpSettings PayloadDumpConfig
+	dump         io.WriteCloser
+	metrics      *metricsTranslator
+	// metricsMutex serializes the metrics uploads, see ConsumeMetrics.
+	metricsMutex sync.Mutex
+	spanMapper   *spanAttributeMapper
+	redactor     *spanRedactor
+	// exportSpanEvents and exportSpanLinks include the events and links in span records.
+	exportSpanEvents bool
+	exportSpanLinks  bool
+	logMessageFields []string
+	// rootSpans is nil when the root span cache is disabled.
+	rootSpans  *rootSpanCache
+	holdWindow time.Duration
+	// apmMetrics is nil when the APM metrics are disabled. apmStop stops
+	// their periodic upload, which closes apmStopped when it is done.
+	apmMetrics  *apmMetricsAggregator
+	apmInterval time.Duration
+	apmStop     chan struct{}
+	apmStopped  chan struct{}
+}
+
+func newSite24x7Exporter(cfg *Config, logger *zap.Logger) *site24x7exporter {
+	spanMapper := newSpanAttributeMapper(cfg.SpanAttributeMapping)
+	var rootSpans *rootSpanCache
+	if cfg.RootSpanCache.Enabled {
+		rootSpans = newRootSpanCache(cfg.RootSpanCache)
+	}
+	var apmMetrics *apmMetricsAggregator
+	if cfg.APMMetrics.Enabled {
+		apmMetrics = newAPMMetricsAggregator(cfg.APMMetrics)
+	}
+	apmInterval := cfg.APMMetrics.Interval
+	if apmInterval <= 0 {
+		apmInterval = defaultAPMMetricsInterval
+	}
+	logMessageFields := cfg.LogMessageFields
+	if len(logMessageFields) == 0 {
+		logMessageFields = defaultLogMessageFields
+	}
+	return &site24x7exporter{
+		endpoints:        cfg.resolveEndpoints(),
+		catalyst:         cfg.TracesAPI == tracesAPICatalyst,
+		apikey:           cfg.APIKEY,
+		logger:           logger,
+		clientSettings:   cfg.HTTPClientSettings,
+		maxRecords:       cfg.MaxRecordsPerRequest,
+		maxBytes:         cfg.MaxBytesPerRequest,
+		dumpSettings:     cfg.PayloadDump,
+		metrics:          newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL),
+		spanMapper:       spanMapper,
+		redactor:         newSpanRedactor(cfg.Redaction, spanMapper),
+		exportSpanEvents: cfg.ExportSpanEvents,
+		exportSpanLinks:  cfg.ExportSpanLinks,
+		logMessageFields: logMessageFields,
+		rootSpans:        rootSpans,
+		holdWindow:       cfg.RootSpanCache.HoldWindow,
+		apmMetrics:       apmMetrics,
+		apmInterval:      apmInterval,
+	}
 }
 
 func (e *site24x7exporter) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: false}
 }
 
-func (e *site24x7exporter) ConsumeMetrics(_ context.Context, md pdata.Metrics) error {
-	buf, err := metricsMarshaler.MarshalMetrics(md)
-	if err != nil {
-		return err
+// dumpPayload writes the uncompressed payload as a single line to the dump
+// file, if the payload dump is enabled.
+func (e *site24x7exporter) dumpPayload(buf []byte) {
+	if e.dump == nil {
+		return
+	}
+	line := make([]byte, 0, len(buf)+1)
+	line = append(append(line, buf...), '\n')
+	if _, err := e.dump.Write(line); err != nil {
+		e.logger.Warn("Failed to dump payload", zap.String("path", e.dumpSettings.Path), zap.Error(err))
 	}
-	return exportMessageAsLine(e, buf)
 }
 
-func exportMessageAsLine(e *site24x7exporter, buf []byte) error {
-	// Ensure only one write operation happens at a time.
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
-	var urlBuf bytes.Buffer
-	//if _, err := e.file.Write(buf); err != nil {
-	//	return err
-	//}
-	if _, err := io.WriteString(e.file, "\n"); err != nil {
+// postAppLogs uploads a gzip compressed JSON array of recordCount records to
+// the AppLogs endpoint. logType tells Site24x7 how the records should be parsed.
+func (e *site24x7exporter) postAppLogs(ctx context.Context, compressed []byte, recordCount int, logType string) error {
+	compressedSize := len(compressed)
+	req, err := http.NewRequestWithContext(ctx, "POST", e.endpoints.forLogType(logType), bytes.NewReader(compressed))
+	if err != nil {
+		return consumererror.Permanent(err)
+	}
+
+	req.Header = http.Header{
+		"X-DeviceKey":      []string{e.apikey},
+		"Content-Type":     []string{"application/json"},
+		"X-LogType":        []string{logType},
+		"X-StreamMode":     []string{"1"},
+		"Log-Size":         []string{strconv.Itoa(recordCount)},
+		"Content-Encoding": []string{"gzip"},
+		"User-Agent":       []string{"site24x7exporter"},
+	}
+	res, err := e.client.Do(req)
+	if err != nil {
+		recordUpload(logType, false, 0, 0)
 		return err
 	}
+	defer res.Body.Close()
+	// Drain the body so that the connection can be reused.
+	io.Copy(ioutil.Discard, res.Body)
 
-	responseBody := bytes.NewBuffer(buf)
+	err = checkResponse(res)
+	recordUpload(logType, err == nil, recordCount, compressedSize)
+	e.logger.Debug("Uploaded records to Site24x7",
+		zap.String("log_type", logType),
+		zap.Strings("upload_id", res.Header.Values("x-uploadid")),
+		zap.Int("status", res.StatusCode),
+		zap.Int("records", recordCount),
+		zap.Int("bytes", compressedSize))
+	return err
+}
 
-	//urlBuf.WriteString(e.url);
-	//urlBuf.WriteString("?");
-	//urlBuf.WriteString(e.apikey);
-	fmt.Fprint(&urlBuf, e.url, "?license.key=",e.apikey);
+// recordUpload records the self-observability metrics of an upload request.
+func recordUpload(logType string, success bool, records int, size int) {
+	ctx, _ := tag.New(context.Background(),
+		tag.Upsert(tagLogType, logType),
+		tag.Upsert(tagSuccess, strconv.FormatBool(success)))
+	stats.Record(ctx, mUploads.M(1))
+	if success {
+		stats.Record(ctx, mUploadedRecords.M(int64(records)), mUploadedBytes.M(int64(size)))
+	}
+}
 
-	resp, err := http.Post(urlBuf.String(), "application/json", responseBody)
-	io.WriteString(e.file, "\nPosting telemetry data to url. \n")
-	if err != nil {
-		io.WriteString(e.file, "\nError in posting data to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
+// checkResponse turns an unsuccessful upload response into an error. Client
+// errors are permanent since resending the same payload cannot succeed,
+// throttling and server errors are retried, honoring Retry-After if present.
+func checkResponse(res *http.Response) error {
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return nil
 	}
-	defer resp.Body.Close()
-	//Read the response body
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
+
+	err := fmt.Errorf("site24x7 upload failed with status %q", res.Status)
+	switch {
+	case res.StatusCode == http.StatusTooManyRequests || res.StatusCode == http.StatusServiceUnavailable:
+		if delay := retryAfter(res); delay > 0 {
+			return exporterhelper.NewThrottleRetry(err, delay)
+		}
 		return err
-	}
-	if _, err := e.file.Write(body); err != nil {
+	case res.StatusCode >= 500:
 		return err
+	default:
+		return consumererror.Permanent(err)
 	}
+}
 
-	return nil
+// retryAfter parses the Retry-After header, given either in seconds or as an HTTP date.
+func retryAfter(res *http.Response) time.Duration {
+	header := res.Header.Get("Retry-After")
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil {
+		return time.Duration(seconds) * time.Second
+	}
+	if date, err := http.ParseTime(header); err == nil {
+		return time.Until(date)
+	}
+	return 0
 }
 
-func (e *site24x7exporter) Start(context.Context, component.Host) error {
-	var err error
-	e.file, err = os.OpenFile(e.path, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0600)
-	return err
+func (e *site24x7exporter) Start(_ context.Context, host component.Host) error {
+	client, err := e.clientSettings.ToClient(host.GetExtensions())
+	if err != nil {
+		return err
+	}
+	e.client = client
+
+	if e.dumpSettings.Path != "" {
+		dump := &lumberjack.Logger{
+			Filename:   e.dumpSettings.Path,
+			MaxSize:    e.dumpSettings.MaxSizeMiB,
+			MaxBackups: e.dumpSettings.MaxBackups,
+		}
+		if dump.MaxSize == 0 {
+			dump.MaxSize = defaultPayloadDumpMaxSizeMiB
+		}
+		if dump.MaxBackups == 0 {
+			dump.MaxBackups = defaultPayloadDumpMaxBackups
+		}
+		e.dump = dump
+	}
+	if e.apmMetrics != nil {
+		e.startAPMMetrics()
+	}
+	return nil
 }
 
 // Shutdown stops the exporter and is invoked during shutdown.
-func (e *site24x7exporter) Shutdown(context.Context) error {
-	return e.file.Close()
+func (e *site24x7exporter) Shutdown(ctx context.Context) error {
+	e.stopAPMMetrics(ctx)
+	if e.dump != nil {
+		return e.dump.Close()
+	}
+	return nil
 }
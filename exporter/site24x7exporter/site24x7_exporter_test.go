@@ -4,7 +4,7 @@
 // you may not use this file except in compliance with the License.
 // You may obtain a copy of the License at
 //
-//       http://www.apache.org/licenses/LICENSE-2.0
+//	http://www.apache.org/licenses/LICENSE-2.0
 //
 // Unless required by applicable law or agreed to in writing, software
 // distributed under the License is distributed on an "AS IS" BASIS,
@@ -15,121 +15,284 @@ package site24x7exporter
 
 import (
 	"context"
-	"errors"
+	"encoding/json"
 	"io/ioutil"
-	"os"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"go.opentelemetry.io/collector/component/componenttest"
-	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/config/configtls"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.uber.org/zap"
 
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/site24x7exporter/internal/mockserver"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/testdata"
 )
 
-func TestFileTracesExporter(t *testing.T) {
-	fe := &site24x7exporter{path: tempFileName(t)}
+func newMockServer(t *testing.T) *mockserver.Server {
+	server := mockserver.New()
+	t.Cleanup(server.Close)
+	return server
+}
+
+// lastUpload returns the last upload accepted by the server.
+func lastUpload(t *testing.T, server *mockserver.Server) mockserver.Upload {
+	uploads := server.Uploads()
+	require.NotEmpty(t, uploads)
+	return uploads[len(uploads)-1]
+}
+
+func newTestConfig(endpoint string) *Config {
+	cfg := createDefaultConfig().(*Config)
+	cfg.Endpoint = endpoint
+	cfg.APIKEY = "ab_123"
+	return cfg
+}
+
+// unreachableEndpoint returns the URL of a server that is no longer listening.
+func unreachableEndpoint() string {
+	server := httptest.NewServer(http.NotFoundHandler())
+	server.Close()
+	return server.URL
+}
+
+func newTestExporter(t *testing.T, cfg *Config) *site24x7exporter {
+	fe := newSite24x7Exporter(cfg, zap.NewNop())
 	require.NotNil(t, fe)
+	require.NoError(t, fe.Start(context.Background(), componenttest.NewNopHost()))
+	return fe
+}
+
+func TestFileTracesExporter(t *testing.T) {
+	server := newMockServer(t)
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
 
 	td := testdata.GenerateTracesTwoSpansSameResource()
-	assert.NoError(t, fe.Start(context.Background(), componenttest.NewNopHost()))
 	assert.NoError(t, fe.ConsumeTraces(context.Background(), td))
 	assert.NoError(t, fe.Shutdown(context.Background()))
 
-	unmarshaler := otlp.NewJSONTracesUnmarshaler()
-	buf, err := ioutil.ReadFile(fe.path)
-	assert.NoError(t, err)
-	got, err := unmarshaler.UnmarshalTraces(buf)
-	assert.NoError(t, err)
-	assert.EqualValues(t, td, got)
+	var records []TelemetrySpan
+	upload := lastUpload(t, server)
+	require.NoError(t, upload.Decode(&records))
+	assert.Equal(t, logTypeTraces, upload.LogType())
+	assert.Equal(t, "ab_123", upload.Header.Get("X-DeviceKey"))
+	assert.Equal(t, "2", upload.Header.Get("Log-Size"))
+	require.Len(t, records, 2)
+	assert.Equal(t, "operationA", records[0].Name)
+	assert.Equal(t, "operationB", records[1].Name)
 }
 
 func TestFileTracesExporterError(t *testing.T) {
-	mf := &errorWriter{}
-	fe := &site24x7exporter{file: mf}
-	require.NotNil(t, fe)
+	fe := newTestExporter(t, newTestConfig(unreachableEndpoint()))
 
 	td := testdata.GenerateTracesTwoSpansSameResource()
-	// Cannot call Start since we inject directly the WriterCloser.
 	assert.Error(t, fe.ConsumeTraces(context.Background(), td))
 	assert.NoError(t, fe.Shutdown(context.Background()))
 }
 
 func TestFileMetricsExporter(t *testing.T) {
-	fe := &site24x7exporter{path: tempFileName(t)}
-	require.NotNil(t, fe)
+	server := newMockServer(t)
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
 
-	md := testdata.GenerateMetricsTwoMetrics()
-	assert.NoError(t, fe.Start(context.Background(), componenttest.NewNopHost()))
+	md := testdata.GenerateMetricsOneCounterOneSummaryMetrics()
 	assert.NoError(t, fe.ConsumeMetrics(context.Background(), md))
 	assert.NoError(t, fe.Shutdown(context.Background()))
 
-	unmarshaler := otlp.NewJSONMetricsUnmarshaler()
-	buf, err := ioutil.ReadFile(fe.path)
-	assert.NoError(t, err)
-	got, err := unmarshaler.UnmarshalMetrics(buf)
-	assert.NoError(t, err)
-	assert.EqualValues(t, md, got)
+	// The cumulative counter only establishes its baseline, the summary is exported as is.
+	var records []TelemetryMetric
+	upload := lastUpload(t, server)
+	require.NoError(t, upload.Decode(&records))
+	assert.Equal(t, logTypeMetrics, upload.LogType())
+	assert.Equal(t, "2", upload.Header.Get("Log-Size"))
+	require.Len(t, records, 2)
+	assert.Equal(t, metricTypeSummary, records[0].Type)
+	assert.Equal(t, testdata.TestDoubleSummaryMetricName, records[0].Name)
 }
 
 func TestFileMetricsExporterError(t *testing.T) {
-	mf := &errorWriter{}
-	fe := &site24x7exporter{file: mf}
-	require.NotNil(t, fe)
+	fe := newTestExporter(t, newTestConfig(unreachableEndpoint()))
 
-	md := testdata.GenerateMetricsTwoMetrics()
-	// Cannot call Start since we inject directly the WriterCloser.
+	md := testdata.GenerateMetricsOneCounterOneSummaryMetrics()
 	assert.Error(t, fe.ConsumeMetrics(context.Background(), md))
 	assert.NoError(t, fe.Shutdown(context.Background()))
 }
 
 func TestFileLogsExporter(t *testing.T) {
-	fe := &site24x7exporter{path: tempFileName(t)}
-	require.NotNil(t, fe)
+	server := newMockServer(t)
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
 
 	ld := testdata.GenerateLogsTwoLogRecordsSameResource()
-	assert.NoError(t, fe.Start(context.Background(), componenttest.NewNopHost()))
 	assert.NoError(t, fe.ConsumeLogs(context.Background(), ld))
 	assert.NoError(t, fe.Shutdown(context.Background()))
 
-	unmarshaler := otlp.NewJSONLogsUnmarshaler()
-	buf, err := ioutil.ReadFile(fe.path)
-	assert.NoError(t, err)
-	got, err := unmarshaler.UnmarshalLogs(buf)
-	assert.NoError(t, err)
-	assert.EqualValues(t, ld, got)
+	var records []TelemetryLog
+	upload := lastUpload(t, server)
+	require.NoError(t, upload.Decode(&records))
+	assert.Equal(t, logTypeLogs, upload.LogType())
+	assert.Equal(t, "2", upload.Header.Get("Log-Size"))
+	assert.Len(t, records, 2)
 }
 
 func TestFileLogsExporterErrors(t *testing.T) {
-	mf := &errorWriter{}
-	fe := &site24x7exporter{file: mf}
-	require.NotNil(t, fe)
+	fe := newTestExporter(t, newTestConfig(unreachableEndpoint()))
 
 	ld := testdata.GenerateLogsTwoLogRecordsSameResource()
-	// Cannot call Start since we inject directly the WriterCloser.
 	assert.Error(t, fe.ConsumeLogs(context.Background(), ld))
 	assert.NoError(t, fe.Shutdown(context.Background()))
 }
 
-// tempFileName provides a temporary file name for testing.
-func tempFileName(t *testing.T) string {
-	tmpfile, err := ioutil.TempFile("", "*.json")
+func TestCheckResponse(t *testing.T) {
+	newResponse := func(code int, header http.Header) *http.Response {
+		if header == nil {
+			header = http.Header{}
+		}
+		return &http.Response{StatusCode: code, Status: http.StatusText(code), Header: header}
+	}
+
+	assert.NoError(t, checkResponse(newResponse(http.StatusOK, nil)))
+
+	err := checkResponse(newResponse(http.StatusBadRequest, nil))
+	assert.True(t, consumererror.IsPermanent(err))
+	err = checkResponse(newResponse(http.StatusUnauthorized, nil))
+	assert.True(t, consumererror.IsPermanent(err))
+
+	err = checkResponse(newResponse(http.StatusInternalServerError, nil))
+	assert.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+
+	err = checkResponse(newResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}}))
+	assert.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+	assert.Equal(t, 30*time.Second, retryAfter(newResponse(http.StatusTooManyRequests, http.Header{"Retry-After": []string{"30"}})))
+}
+
+func TestSendAppLogsHonorsContext(t *testing.T) {
+	server := newMockServer(t)
+	server.Enqueue(mockserver.Response{Delay: 200 * time.Millisecond})
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
+	defer fe.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	err := fe.uploadRecords(ctx, []json.RawMessage{[]byte("{}")}, logTypeLogs).err()
+	assert.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+}
+
+func TestInsecureSkipVerifyDoesNotLeakIntoDefaultTransport(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defaultTLSConfig := http.DefaultTransport.(*http.Transport).TLSClientConfig
+
+	cfg := newTestConfig(server.URL)
+	cfg.TLSSetting = configtls.TLSClientSetting{InsecureSkipVerify: true}
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	assert.NoError(t, fe.uploadRecords(context.Background(), []json.RawMessage{[]byte("{}")}, logTypeLogs).err())
+	assert.Equal(t, defaultTLSConfig, http.DefaultTransport.(*http.Transport).TLSClientConfig)
+}
+
+func TestPayloadDump(t *testing.T) {
+	server := newMockServer(t)
+	dumpPath := filepath.Join(t.TempDir(), "payloads.json")
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.PayloadDump = PayloadDumpConfig{Path: dumpPath, MaxSizeMiB: 1, MaxBackups: 1}
+	fe := newTestExporter(t, cfg)
+
+	assert.NoError(t, fe.ConsumeLogs(context.Background(), testdata.GenerateLogsTwoLogRecordsSameResource()))
+	assert.NoError(t, fe.ConsumeTraces(context.Background(), testdata.GenerateTracesTwoSpansSameResource()))
+	assert.NoError(t, fe.Shutdown(context.Background()))
+
+	dump, err := ioutil.ReadFile(dumpPath)
 	require.NoError(t, err)
-	require.NoError(t, tmpfile.Close())
-	socket := tmpfile.Name()
-	require.NoError(t, os.Remove(socket))
-	return socket
+	lines := strings.Split(strings.TrimSpace(string(dump)), "\n")
+	require.Len(t, lines, 2)
+	var logs []TelemetryLog
+	assert.NoError(t, json.Unmarshal([]byte(lines[0]), &logs))
+	assert.Len(t, logs, 2)
+	var spans []TelemetrySpan
+	assert.NoError(t, json.Unmarshal([]byte(lines[1]), &spans))
+	assert.Len(t, spans, 2)
+}
+
+func TestNoPayloadDumpByDefault(t *testing.T) {
+	fe := newTestExporter(t, newTestConfig(""))
+	assert.Nil(t, fe.dump)
+	assert.NoError(t, fe.Shutdown(context.Background()))
 }
 
-// errorWriter is an io.Writer that will return an error all ways
-type errorWriter struct {
+func TestSignalEndpoints(t *testing.T) {
+	traces := newMockServer(t)
+	logs := newMockServer(t)
+	cfg := newTestConfig(unreachableEndpoint())
+	cfg.TracesEndpoint = traces.AppLogsURL()
+	cfg.LogsEndpoint = logs.AppLogsURL()
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	assert.NoError(t, fe.ConsumeTraces(context.Background(), testdata.GenerateTracesTwoSpansSameResource()))
+	assert.NoError(t, fe.ConsumeLogs(context.Background(), testdata.GenerateLogsTwoLogRecordsSameResource()))
+	assert.Error(t, fe.ConsumeMetrics(context.Background(), testdata.GenerateMetricsOneCounterOneSummaryMetrics()))
+	assert.Len(t, traces.Records(logTypeTraces), 2)
+	assert.Len(t, logs.Records(logTypeLogs), 2)
 }
 
-func (e errorWriter) Write([]byte) (n int, err error) {
-	return 0, errors.New("all ways return error")
+func TestCatalystTracesAPI(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(unreachableEndpoint())
+	cfg.TracesEndpoint = server.CatalystURL()
+	cfg.TracesAPI = tracesAPICatalyst
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	assert.NoError(t, fe.ConsumeTraces(context.Background(), testdata.GenerateTracesTwoSpansSameResource()))
+	upload := lastUpload(t, server)
+	assert.Equal(t, mockserver.CatalystPath, upload.Path)
+	assert.Equal(t, "ab_123", upload.Query.Get("license.key"))
+	assert.Len(t, upload.Records, 2)
 }
 
-func (e *errorWriter) Close() error {
-	return nil
+func TestThrottledUploadIsRetryable(t *testing.T) {
+	server := newMockServer(t)
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
+	defer fe.Shutdown(context.Background())
+
+	server.Enqueue(mockserver.Response{StatusCode: http.StatusTooManyRequests, RetryAfter: "1"})
+	err := fe.ConsumeLogs(context.Background(), testdata.GenerateLogsTwoLogRecordsSameResource())
+	assert.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+
+	server.Enqueue(mockserver.Response{StatusCode: http.StatusBadGateway})
+	err = fe.ConsumeLogs(context.Background(), testdata.GenerateLogsTwoLogRecordsSameResource())
+	assert.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+	assert.Empty(t, server.Uploads())
+}
+
+func TestExporterRetriesFailedUploads(t *testing.T) {
+	server := newMockServer(t)
+	server.Enqueue(
+		mockserver.Response{StatusCode: http.StatusServiceUnavailable},
+		mockserver.Response{StatusCode: http.StatusInternalServerError},
+	)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.QueueSettings.Enabled = false
+	cfg.RetrySettings.InitialInterval = time.Millisecond
+	cfg.RetrySettings.MaxInterval = time.Millisecond
+
+	exp, err := NewFactory().CreateLogsExporter(context.Background(), componenttest.NewNopExporterCreateSettings(), cfg)
+	require.NoError(t, err)
+	require.NoError(t, exp.Start(context.Background(), componenttest.NewNopHost()))
+	defer exp.Shutdown(context.Background())
+
+	assert.NoError(t, exp.ConsumeLogs(context.Background(), testdata.GenerateLogsTwoLogRecordsSameResource()))
+	assert.Equal(t, 3, server.Requests())
+	assert.Len(t, server.Records(logTypeLogs), 2)
 }
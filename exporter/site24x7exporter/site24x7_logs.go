@@ -15,75 +15,123 @@
 package site24x7exporter
 
 import (
-	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/tls"
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
-	"strconv"
-	"strings"
 	"time"
 
 	"go.opentelemetry.io/collector/model/pdata"
 )
 
+// defaultLogMessageFields are the body fields the message of structured logs
+// is read from when log_message_fields is empty.
+var defaultLogMessageFields = []string{"msg", "message", "log"}
+
+// severityLevel returns the level of the log record, which is the severity
+// text or, when the text is empty, the name of the severity number range, see
+// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/logs/data-model.md#field-severitynumber
+func severityLevel(logrecord pdata.LogRecord) string {
+	if text := logrecord.SeverityText(); text != "" {
+		return text
+	}
+	switch n := logrecord.SeverityNumber(); {
+	case n >= pdata.SeverityNumberFATAL:
+		return "FATAL"
+	case n >= pdata.SeverityNumberERROR:
+		return "ERROR"
+	case n >= pdata.SeverityNumberWARN:
+		return "WARN"
+	case n >= pdata.SeverityNumberINFO:
+		return "INFO"
+	case n >= pdata.SeverityNumberDEBUG:
+		return "DEBUG"
+	case n >= pdata.SeverityNumberTRACE:
+		return "TRACE"
+	default:
+		return ""
+	}
+}
+
+// flattenBody adds the fields of a structured body to fields. Nested maps are
+// flattened into dotted keys, e.g. {"http": {"method": "GET"}} becomes
+// "http.method", other values are added as is.
+func flattenBody(prefix string, body pdata.AttributeMap, fields telemetryAttributes) {
+	body.Range(func(k string, v pdata.AttributeValue) bool {
+		key := k
+		if prefix != "" {
+			key = prefix + "." + k
+		}
+		switch v.Type() {
+		case pdata.AttributeValueTypeMap:
+			flattenBody(key, v.MapVal(), fields)
+		case pdata.AttributeValueTypeString:
+			fields[key] = v.StringVal()
+		case pdata.AttributeValueTypeInt:
+			fields[key] = v.IntVal()
+		case pdata.AttributeValueTypeDouble:
+			fields[key] = v.DoubleVal()
+		case pdata.AttributeValueTypeBool:
+			fields[key] = v.BoolVal()
+		case pdata.AttributeValueTypeEmpty:
+			fields[key] = nil
+		default:
+			// Arrays are serialized as JSON and bytes as base64.
+			fields[key] = v.AsString()
+		}
+		return true
+	})
+}
+
 func (e *site24x7exporter) CreateLogItem(logrecord pdata.LogRecord, resourceAttr map[string]interface{}) TelemetryLog {
 	startTime := (logrecord.Timestamp().AsTime().UnixNano() / int64(time.Millisecond))
-	tlogBodyType := logrecord.Body().Type()
 	tlogMsg := logrecord.Name()
 	tlogTraceId := logrecord.TraceID().HexString()
 	tlogSpanId := logrecord.SpanID().HexString()
-	switch tlogBodyType {
-	case pdata.AttributeValueTypeString:
-		tlogMsg = logrecord.Body().AsString()
-		io.WriteString(e.file, "\nLog Message from Body: \t"+tlogMsg)
+	var tlogBody telemetryAttributes
 
+	body := logrecord.Body()
+	switch body.Type() {
+	case pdata.AttributeValueTypeEmpty:
 	case pdata.AttributeValueTypeMap:
-		tlogKvList := logrecord.Body().MapVal().AsRaw()
-		// if kvlist gives "msg":"<logmsg>"
-		if attrVal, found := tlogKvList["msg"]; found {
-			//tLogValue := v1.KeyValueList(tlogKvList).GetValues()
-			tlogMsg = attrVal.(string)
-		} else {
-			tlogMsg = logrecord.Body().AsString()
-		}
+		bodyMap := body.MapVal()
+		tlogBody = make(telemetryAttributes, bodyMap.Len())
+		flattenBody("", bodyMap, tlogBody)
 
-		if tlogKvSpanId, found := tlogKvList["span_id"]; found {
-			tlogSpanId = tlogKvSpanId.(string)
+		tlogMsg = body.AsString()
+		for _, field := range e.logMessageFields {
+			if msg, found := bodyMap.Get(field); found {
+				tlogMsg = msg.AsString()
+				break
+			}
 		}
 
-		if tlogKvTraceId, found := tlogKvList["trace_id"]; found {
-			tlogTraceId = tlogKvTraceId.(string)
+		// Structured logs of some libraries carry the trace context in the body.
+		if tlogTraceId == "" {
+			tlogTraceId = attributeString(bodyMap, "trace_id")
+		}
+		if tlogSpanId == "" {
+			tlogSpanId = attributeString(bodyMap, "span_id")
 		}
+	default:
+		tlogMsg = body.AsString()
 	}
 
 	tlog := TelemetryLog{
 		Timestamp:          startTime,
 		S247UID:            "otel-s247exporter",
-		LogLevel:           logrecord.SeverityText(),
+		LogLevel:           severityLevel(logrecord),
+		SeverityNumber:     int32(logrecord.SeverityNumber()),
 		TraceId:            tlogTraceId,
 		SpanId:             tlogSpanId,
 		TraceFlag:          logrecord.Flags(),
 		ResourceAttributes: resourceAttr,
 		LogAttributes:      logrecord.Attributes().AsRaw(),
+		Body:               tlogBody,
 		Name:               logrecord.Name(),
 		Message:            tlogMsg,
 	}
 	return tlog
 }
 
-func (e *site24x7exporter) ConsumeLogs(_ context.Context, ld pdata.Logs) error {
-	/*buf, err := logsMarshaler.MarshalLogs(ld)
-	if err != nil {
-		return err
-	}
-	return exportMessageAsLine(e, buf)*/
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
-
+func (e *site24x7exporter) ConsumeLogs(ctx context.Context, ld pdata.Logs) error {
 	logCount := ld.LogRecordCount()
 	logList := make([]TelemetryLog, 0, logCount)
 	for i := 0; i < ld.ResourceLogs().Len(); i++ {
@@ -102,89 +150,6 @@ func (e *site24x7exporter) ConsumeLogs(_ context.Context, ld pdata.Logs) error {
 		}
 	}
 
-	io.WriteString(e.file, "\nTransformed telemetry logs to site24x7 format. \n")
-	buf, err := json.Marshal(logList)
-	if err != nil {
-		io.WriteString(e.file, "\nError in converting telemetry logs. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-	
-	/*
-	var urlBuf bytes.Buffer
-	responseBody := bytes.NewBuffer(buf)
-	fmt.Fprint(&urlBuf, e.url, "?license.key=", e.apikey)
-	fmt.Println("Sending to Site24x7: ", responseBody)
-	resp, err := http.Post(urlBuf.String(), "application/json", responseBody)
-	defer resp.Body.Close()
-	body, err := ioutil.ReadAll(resp.Body)
-	if err != nil {
-		return err
-	}
-	if _, err := e.file.Write(body); err != nil {
-		return err
-	}
-	*/
-	/*
-		var gzipbuf bytes.Buffer
-		gzipRespBody := gzip.NewWriter(&gzipbuf)
-		if _, err := gzipRespBody.Write(&gzipbuf); err != nil {
-			io.WriteString(e.file, "\n Compressing to GZIP failed. \n")
-			return err
-		}
-		if err := g.close(); err != nil {
-			io.WriteString(e.file, "\n Closing GZIP buffere failed\n")
-			return err
-		}
-		resp, err := http.Post(urlBuf.String(), "application/json", &gzipbuf)
-	*/
-
-	client := http.Client{}
-
-	var gzbuf bytes.Buffer
-	g := gzip.NewWriter(&gzbuf)
-	g.Write(buf)
-	g.Close()
-	req , err := http.NewRequest("POST", e.url, &gzbuf)
-	if err != nil {
-		//Handle Error
-		fmt.Println("Error initializing Url: ", err)
-		io.WriteString(e.file, "\nError in posting logs to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-
-	req.Header = http.Header{
-		"X-DeviceKey": []string{e.apikey},
-		"Content-Type": []string{"application/json"},
-		"X-LogType": []string{"otellogs"},
-		"X-StreamMode": []string{"1"},
-		"Log-Size": []string{strconv.Itoa(len(logList))},
-		"Content-Encoding": []string{"gzip"},
-		"User-Agent": []string{"site24x7exporter"},
-	}
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: e.insecure}
-	res , err := client.Do(req)
-	if err != nil {
-		//Handle Error
-		fmt.Println("Error initializing Url: ", err)
-		io.WriteString(e.file, "\nError in posting logs to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-	io.WriteString(e.file, "\nPosting telemetry logs to url. \n")
-	uploadid := res.Header.Values("x-uploadid")
-	io.WriteString(e.file, "Upload ID: " + strings.Join(uploadid," "))
-	fmt.Println("Uploaded logs information: ", res.Header)
-	if err != nil {
-		io.WriteString(e.file, "\nError in posting logs to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-	
-	return err
+	records := e.marshalRecords(len(logList), logTypeLogs, func(i int) interface{} { return logList[i] })
+	return e.logsError(ld, e.uploadRecords(ctx, records, logTypeLogs))
 }
@@ -0,0 +1,143 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestSeverityLevel(t *testing.T) {
+	tests := []struct {
+		number pdata.SeverityNumber
+		text   string
+		want   string
+	}{
+		{number: pdata.SeverityNumberUNDEFINED, want: ""},
+		{number: pdata.SeverityNumberTRACE, want: "TRACE"},
+		{number: pdata.SeverityNumberDEBUG4, want: "DEBUG"},
+		{number: pdata.SeverityNumberINFO2, want: "INFO"},
+		{number: pdata.SeverityNumberWARN, want: "WARN"},
+		{number: pdata.SeverityNumberERROR3, want: "ERROR"},
+		{number: pdata.SeverityNumberFATAL4, want: "FATAL"},
+		{number: pdata.SeverityNumberERROR, text: "Critical", want: "Critical"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.number.String()+tt.text, func(t *testing.T) {
+			lr := pdata.NewLogRecord()
+			lr.SetSeverityNumber(tt.number)
+			lr.SetSeverityText(tt.text)
+			assert.Equal(t, tt.want, severityLevel(lr))
+		})
+	}
+}
+
+func TestCreateLogItemStructuredBody(t *testing.T) {
+	fe := newSite24x7Exporter(newTestConfig(""), zap.NewNop())
+
+	lr := pdata.NewLogRecord()
+	lr.SetSeverityNumber(pdata.SeverityNumberWARN)
+	body := pdata.NewAttributeValueMap()
+	bodyMap := body.MapVal()
+	bodyMap.InsertString("message", "slow query")
+	bodyMap.InsertInt("duration_ms", 1500)
+	bodyMap.InsertBool("cached", false)
+	bodyMap.InsertDouble("ratio", 0.5)
+	bodyMap.InsertNull("user")
+	bodyMap.InsertInt("trace_id", 42)
+	http := pdata.NewAttributeValueMap()
+	http.MapVal().InsertString("method", "GET")
+	headers := pdata.NewAttributeValueMap()
+	headers.MapVal().InsertString("accept", "*/*")
+	http.MapVal().Insert("headers", headers)
+	bodyMap.Insert("http", http)
+	tags := pdata.NewAttributeValueArray()
+	tags.ArrayVal().AppendEmpty().SetStringVal("db")
+	bodyMap.Insert("tags", tags)
+	bodyMap.Insert("raw", pdata.NewAttributeValueBytes([]byte("raw")))
+	body.CopyTo(lr.Body())
+
+	tlog := fe.CreateLogItem(lr, nil)
+
+	assert.Equal(t, "WARN", tlog.LogLevel)
+	assert.Equal(t, int32(pdata.SeverityNumberWARN), tlog.SeverityNumber)
+	assert.Equal(t, "slow query", tlog.Message)
+	// Non-string trace IDs must not panic.
+	assert.Equal(t, "42", tlog.TraceId)
+	assert.Equal(t, telemetryAttributes{
+		"message":             "slow query",
+		"duration_ms":         int64(1500),
+		"cached":              false,
+		"ratio":               0.5,
+		"user":                nil,
+		"trace_id":            int64(42),
+		"http.method":         "GET",
+		"http.headers.accept": "*/*",
+		"tags":                `["db"]`,
+		"raw":                 "cmF3",
+	}, tlog.Body)
+}
+
+func TestCreateLogItemMessageFields(t *testing.T) {
+	cfg := newTestConfig("")
+	cfg.LogMessageFields = []string{"log", "msg"}
+	fe := newSite24x7Exporter(cfg, zap.NewNop())
+
+	lr := pdata.NewLogRecord()
+	lr.SetTraceID(testTraceID1)
+	pdata.NewAttributeValueMap().CopyTo(lr.Body())
+	lr.Body().MapVal().InsertString("msg", "second")
+	lr.Body().MapVal().InsertString("log", "first")
+	lr.Body().MapVal().InsertString("trace_id", "ignored")
+
+	tlog := fe.CreateLogItem(lr, nil)
+	assert.Equal(t, "first", tlog.Message)
+	// The trace context of the record takes precedence over the body.
+	assert.Equal(t, testTraceID1.HexString(), tlog.TraceId)
+
+	// Without a message field the whole body is the message.
+	lr.Body().MapVal().Delete("msg")
+	lr.Body().MapVal().Delete("log")
+	assert.Equal(t, `{"trace_id":"ignored"}`, fe.CreateLogItem(lr, nil).Message)
+}
+
+func TestCreateLogItemScalarBodies(t *testing.T) {
+	fe := newSite24x7Exporter(newTestConfig(""), zap.NewNop())
+	tests := []struct {
+		name string
+		body pdata.AttributeValue
+		want string
+	}{
+		{name: "empty", body: pdata.NewAttributeValueEmpty(), want: "record name"},
+		{name: "string", body: pdata.NewAttributeValueString("started"), want: "started"},
+		{name: "int", body: pdata.NewAttributeValueInt(7), want: "7"},
+		{name: "double", body: pdata.NewAttributeValueDouble(1.5), want: "1.5"},
+		{name: "bool", body: pdata.NewAttributeValueBool(true), want: "true"},
+		{name: "bytes", body: pdata.NewAttributeValueBytes([]byte("raw")), want: "cmF3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lr := pdata.NewLogRecord()
+			lr.SetName("record name")
+			tt.body.CopyTo(lr.Body())
+			tlog := fe.CreateLogItem(lr, nil)
+			assert.Equal(t, tt.want, tlog.Message)
+			assert.Nil(t, tlog.Body)
+		})
+	}
+}
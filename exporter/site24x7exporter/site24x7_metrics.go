@@ -0,0 +1,561 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"encoding/json"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/hashicorp/golang-lru/simplelru"
+	"go.opencensus.io/stats"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+const (
+	metricTypeGauge     = "gauge"
+	metricTypeSum       = "sum"
+	metricTypeHistogram = "histogram"
+	metricTypeSummary   = "summary"
+
+	temporalityDelta      = "delta"
+	temporalityCumulative = "cumulative"
+
+	// maxCumulativeSeries is the maximum number of cumulative series
+	// remembered, the least recently seen series are forgotten first.
+	maxCumulativeSeries = 100000
+	// cumulativeSeriesTTL is how long a cumulative series that is no longer
+	// seen, e.g. of a restarted pod, is remembered.
+	cumulativeSeriesTTL = time.Hour
+)
+
+// unitMapping translates the UCUM units recommended by the OpenTelemetry
+// specification into the unit names understood by Site24x7.
+var unitMapping = map[string]string{
+	"1":     "",
+	"%":     "percent",
+	"ns":    "nanoseconds",
+	"us":    "microseconds",
+	"ms":    "milliseconds",
+	"s":     "seconds",
+	"min":   "minutes",
+	"h":     "hours",
+	"d":     "days",
+	"By":    "bytes",
+	"KBy":   "kilobytes",
+	"MBy":   "megabytes",
+	"GBy":   "gigabytes",
+	"TBy":   "terabytes",
+	"KiBy":  "kibibytes",
+	"MiBy":  "mebibytes",
+	"GiBy":  "gibibytes",
+	"TiBy":  "tebibytes",
+	"bit":   "bits",
+	"By/s":  "bytes/second",
+	"bit/s": "bits/second",
+	"Hz":    "hertz",
+	"Cel":   "celsius",
+}
+
+// mapUnit returns the Site24x7 unit name for the given UCUM unit. Annotations
+// such as "{requests}" are reduced to their content, unknown units are
+// passed through unchanged.
+func mapUnit(unit string) string {
+	if mapped, found := unitMapping[unit]; found {
+		return mapped
+	}
+	if strings.HasPrefix(unit, "{") && strings.HasSuffix(unit, "}") {
+		return strings.TrimSuffix(strings.TrimPrefix(unit, "{"), "}")
+	}
+	return unit
+}
+
+// cumulativePoint is the last uploaded state of a cumulative series.
+type cumulativePoint struct {
+	startTime    pdata.Timestamp
+	timestamp    pdata.Timestamp
+	value        float64
+	count        uint64
+	bucketCounts []uint64
+}
+
+// metricItem is a Site24x7 metric record along with what is needed to retry
+// it or to remember the state of its cumulative series once it is uploaded.
+type metricItem struct {
+	TelemetryMetric
+	// dataPoint is the index of the data point of the record in its metric.
+	dataPoint int
+	// key identifies the cumulative series of the record, it is empty for
+	// records of other series.
+	key string
+	// baseline is the state of the cumulative series to remember once the
+	// record is uploaded.
+	baseline cumulativePoint
+}
+
+// cumulativeEntry is a remembered cumulative series, forgotten once it expires.
+type cumulativeEntry struct {
+	point   cumulativePoint
+	expires time.Time
+}
+
+// metricsTranslator flattens pdata metrics into Site24x7 metric records. It
+// remembers the last uploaded value of the cumulative monotonic series so
+// that sums and histograms are always reported to Site24x7 as deltas. A
+// forgotten series starts over from a new baseline when it is seen again.
+type metricsTranslator struct {
+	mutex   sync.Mutex
+	prev    *simplelru.LRU
+	ttl     time.Duration
+	nowFunc func() time.Time
+}
+
+func newMetricsTranslator(maxSeries int, ttl time.Duration) *metricsTranslator {
+	// NewLRU only fails for a non-positive size.
+	prev, _ := simplelru.NewLRU(maxSeries, nil)
+	return &metricsTranslator{
+		prev:    prev,
+		ttl:     ttl,
+		nowFunc: time.Now,
+	}
+}
+
+// get returns the remembered state of the series, if it has not expired.
+// It must be called with the mutex held.
+func (t *metricsTranslator) get(key string) (cumulativePoint, bool) {
+	value, found := t.prev.Get(key)
+	if !found {
+		return cumulativePoint{}, false
+	}
+	entry := value.(*cumulativeEntry)
+	now := t.nowFunc()
+	if now.After(entry.expires) {
+		t.prev.Remove(key)
+		return cumulativePoint{}, false
+	}
+	entry.expires = now.Add(t.ttl)
+	return entry.point, true
+}
+
+// set remembers the state of the series. It must be called with the mutex held.
+func (t *metricsTranslator) set(key string, point cumulativePoint) {
+	t.prev.Add(key, &cumulativeEntry{point: point, expires: t.nowFunc().Add(t.ttl)})
+}
+
+// seriesKey identifies a time series by its metric name and dimensions.
+func seriesKey(name string, dims telemetryAttributes) string {
+	keys := make([]string, 0, len(dims))
+	for k := range dims {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var sb strings.Builder
+	sb.WriteString(name)
+	for _, k := range keys {
+		sb.WriteString("\x00")
+		sb.WriteString(k)
+		sb.WriteString("=")
+		b, _ := json.Marshal(dims[k])
+		sb.Write(b)
+	}
+	return sb.String()
+}
+
+// baseline returns the last uploaded state of the series. The first
+// observation of a series is remembered right away, as there is nothing to
+// upload for it, and ok is false. So is it for observations older than the
+// last uploaded one, e.g. retried after a more recent batch was uploaded,
+// whose delta was already accounted.
+func (t *metricsTranslator) baseline(key string, point cumulativePoint) (prev cumulativePoint, ok bool) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	prev, found := t.get(key)
+	if !found {
+		t.set(key, point)
+		return cumulativePoint{}, false
+	}
+	if point.startTime == prev.startTime && point.timestamp <= prev.timestamp {
+		return cumulativePoint{}, false
+	}
+	return prev, true
+}
+
+// commit remembers the state of the cumulative series of the uploaded records,
+// so that their next deltas are computed from it.
+func (t *metricsTranslator) commit(items []metricItem) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+
+	for _, item := range items {
+		if item.key == "" {
+			continue
+		}
+		if prev, found := t.get(item.key); found && item.baseline.startTime == prev.startTime && item.baseline.timestamp <= prev.timestamp {
+			continue
+		}
+		t.set(item.key, item.baseline)
+	}
+}
+
+// deltaSum converts a cumulative sum value into the delta since the last
+// uploaded observation. The first observation of a series is only recorded,
+// ok is false.
+func (t *metricsTranslator) deltaSum(key string, point cumulativePoint) (delta float64, ok bool) {
+	prev, ok := t.baseline(key, point)
+	if !ok {
+		return 0, false
+	}
+	if point.startTime != prev.startTime || point.value < prev.value {
+		// The series restarted, everything accumulated since the new start
+		// time is the delta.
+		return point.value, true
+	}
+	return point.value - prev.value, true
+}
+
+// deltaHistogram converts a cumulative histogram data point into the deltas
+// since the last uploaded observation, following the same rules as deltaSum.
+func (t *metricsTranslator) deltaHistogram(key string, dp pdata.HistogramDataPoint, point cumulativePoint) (count uint64, sum float64, buckets []uint64, ok bool) {
+	prev, ok := t.baseline(key, point)
+	if !ok {
+		return 0, 0, nil, false
+	}
+	curBuckets := dp.BucketCounts()
+	if dp.StartTimestamp() != prev.startTime || dp.Count() < prev.count || len(curBuckets) != len(prev.bucketCounts) {
+		return dp.Count(), dp.Sum(), curBuckets, true
+	}
+
+	buckets = make([]uint64, len(curBuckets))
+	for i := range curBuckets {
+		if curBuckets[i] < prev.bucketCounts[i] {
+			return dp.Count(), dp.Sum(), curBuckets, true
+		}
+		buckets[i] = curBuckets[i] - prev.bucketCounts[i]
+	}
+	return dp.Count() - prev.count, dp.Sum() - prev.value, buckets, true
+}
+
+// mergeDimensions returns the union of the resource and data point attributes.
+// Data point attributes take precedence over resource attributes.
+func mergeDimensions(resourceAttr telemetryAttributes, pointAttr pdata.AttributeMap) telemetryAttributes {
+	dims := make(telemetryAttributes, len(resourceAttr)+pointAttr.Len())
+	for k, v := range resourceAttr {
+		dims[k] = v
+	}
+	for k, v := range pointAttr.AsRaw() {
+		dims[k] = v
+	}
+	return dims
+}
+
+func numberValue(dp pdata.NumberDataPoint) float64 {
+	if dp.Type() == pdata.MetricValueTypeInt {
+		return float64(dp.IntVal())
+	}
+	return dp.DoubleVal()
+}
+
+// isFinite returns whether none of the values is NaN or infinite, which JSON
+// cannot represent.
+func isFinite(values ...float64) bool {
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return false
+		}
+	}
+	return true
+}
+
+func timestampMs(ts pdata.Timestamp) int64 {
+	return ts.AsTime().UnixNano() / int64(time.Millisecond)
+}
+
+// CreateMetricItems flattens all data points of the metric into Site24x7 metric
+// records. The deltas of cumulative series are computed from their last
+// uploaded state, which only moves once the records are committed. Data points
+// with a NaN or infinite value are skipped and counted.
+func (t *metricsTranslator) CreateMetricItems(metric pdata.Metric,
+	resourceAttr map[string]interface{},
+	serviceName string,
+	instLibrary string,
+	instLibraryVersion string) []metricItem {
+
+	newItem := func(metricType string, index int, ts, start pdata.Timestamp, dims telemetryAttributes) metricItem {
+		return metricItem{dataPoint: index, TelemetryMetric: TelemetryMetric{
+			Timestamp:                     timestampMs(ts),
+			S247UID:                       "otel-s247exporter",
+			Name:                          metric.Name(),
+			Description:                   metric.Description(),
+			Unit:                          mapUnit(metric.Unit()),
+			Type:                          metricType,
+			StartTime:                     timestampMs(start),
+			ServiceName:                   serviceName,
+			InstrumentationLibrary:        instLibrary,
+			InstrumentationLibraryVersion: instLibraryVersion,
+			Dimensions:                    dims,
+		}}
+	}
+
+	var items []metricItem
+	var skipped int64
+	switch metric.DataType() {
+	case pdata.MetricDataTypeGauge:
+		dps := metric.Gauge().DataPoints()
+		items = make([]metricItem, 0, dps.Len())
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			if !isFinite(numberValue(dp)) {
+				skipped++
+				continue
+			}
+			item := newItem(metricTypeGauge, i, dp.Timestamp(), dp.StartTimestamp(), mergeDimensions(resourceAttr, dp.Attributes()))
+			item.Value = numberValue(dp)
+			items = append(items, item)
+		}
+
+	case pdata.MetricDataTypeSum:
+		sum := metric.Sum()
+		dps := sum.DataPoints()
+		items = make([]metricItem, 0, dps.Len())
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			value := numberValue(dp)
+			if !isFinite(value) {
+				skipped++
+				continue
+			}
+			dims := mergeDimensions(resourceAttr, dp.Attributes())
+			item := newItem(metricTypeSum, i, dp.Timestamp(), dp.StartTimestamp(), dims)
+			item.IsMonotonic = sum.IsMonotonic()
+			switch {
+			case sum.AggregationTemporality() == pdata.AggregationTemporalityCumulative && sum.IsMonotonic():
+				item.key = seriesKey(metric.Name(), dims)
+				item.baseline = cumulativePoint{startTime: dp.StartTimestamp(), timestamp: dp.Timestamp(), value: value}
+				delta, ok := t.deltaSum(item.key, item.baseline)
+				if !ok {
+					continue
+				}
+				item.Temporality = temporalityDelta
+				item.Value = delta
+			case sum.AggregationTemporality() == pdata.AggregationTemporalityCumulative:
+				// A non-monotonic cumulative sum (e.g. an up-down counter) is
+				// the current value of the series and is reported as is.
+				item.Temporality = temporalityCumulative
+				item.Value = value
+			default:
+				item.Temporality = temporalityDelta
+				item.Value = value
+			}
+			items = append(items, item)
+		}
+
+	case pdata.MetricDataTypeHistogram:
+		histogram := metric.Histogram()
+		dps := histogram.DataPoints()
+		items = make([]metricItem, 0, dps.Len())
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			if !isFinite(dp.Sum()) {
+				skipped++
+				continue
+			}
+			dims := mergeDimensions(resourceAttr, dp.Attributes())
+			item := newItem(metricTypeHistogram, i, dp.Timestamp(), dp.StartTimestamp(), dims)
+			item.Temporality = temporalityDelta
+			item.ExplicitBounds = dp.ExplicitBounds()
+			if histogram.AggregationTemporality() == pdata.AggregationTemporalityCumulative {
+				item.key = seriesKey(metric.Name(), dims)
+				item.baseline = cumulativePoint{
+					startTime:    dp.StartTimestamp(),
+					timestamp:    dp.Timestamp(),
+					value:        dp.Sum(),
+					count:        dp.Count(),
+					bucketCounts: append([]uint64(nil), dp.BucketCounts()...),
+				}
+				count, sum, buckets, ok := t.deltaHistogram(item.key, dp, item.baseline)
+				if !ok {
+					continue
+				}
+				item.Count, item.Sum, item.BucketCounts = count, sum, buckets
+			} else {
+				item.Count, item.Sum, item.BucketCounts = dp.Count(), dp.Sum(), dp.BucketCounts()
+			}
+			items = append(items, item)
+		}
+
+	case pdata.MetricDataTypeSummary:
+		dps := metric.Summary().DataPoints()
+		items = make([]metricItem, 0, dps.Len())
+		for i := 0; i < dps.Len(); i++ {
+			dp := dps.At(i)
+			qvs := dp.QuantileValues()
+			values := []float64{dp.Sum()}
+			for j := 0; j < qvs.Len(); j++ {
+				values = append(values, qvs.At(j).Quantile(), qvs.At(j).Value())
+			}
+			if !isFinite(values...) {
+				skipped++
+				continue
+			}
+			item := newItem(metricTypeSummary, i, dp.Timestamp(), dp.StartTimestamp(), mergeDimensions(resourceAttr, dp.Attributes()))
+			item.Temporality = temporalityCumulative
+			item.Count = dp.Count()
+			item.Sum = dp.Sum()
+			item.Quantiles = make([]TelemetryQuantile, 0, qvs.Len())
+			for j := 0; j < qvs.Len(); j++ {
+				item.Quantiles = append(item.Quantiles, TelemetryQuantile{
+					Quantile: qvs.At(j).Quantile(),
+					Value:    qvs.At(j).Value(),
+				})
+			}
+			items = append(items, item)
+		}
+	}
+	if skipped > 0 {
+		stats.Record(context.Background(), mSkippedDataPoints.M(skipped))
+	}
+	return items
+}
+
+func (e *site24x7exporter) ConsumeMetrics(ctx context.Context, md pdata.Metrics) error {
+	// The deltas of cumulative series depend on the previous batch being
+	// uploaded, the batches are uploaded one at a time.
+	e.metricsMutex.Lock()
+	defer e.metricsMutex.Unlock()
+
+	var metricList []metricItem
+	// dataPoints holds the index of the data point of every record among all
+	// data points of the batch.
+	var dataPoints []int
+	offset := 0
+	rmetrics := md.ResourceMetrics()
+	for i := 0; i < rmetrics.Len(); i++ {
+		rmetric := rmetrics.At(i)
+		resourceAttr := rmetric.Resource().Attributes().AsRaw()
+
+		var serviceName string
+		if val, found := resourceAttr["service.name"]; found {
+			serviceName, _ = val.(string)
+		}
+
+		instMetrics := rmetric.InstrumentationLibraryMetrics()
+		for j := 0; j < instMetrics.Len(); j++ {
+			imetrics := instMetrics.At(j)
+			instLibName := imetrics.InstrumentationLibrary().Name()
+			instLibVer := imetrics.InstrumentationLibrary().Version()
+			metrics := imetrics.Metrics()
+			for k := 0; k < metrics.Len(); k++ {
+				items := e.metrics.CreateMetricItems(metrics.At(k), resourceAttr, serviceName, instLibName, instLibVer)
+				for _, item := range items {
+					dataPoints = append(dataPoints, offset+item.dataPoint)
+				}
+				metricList = append(metricList, items...)
+				offset += dataPointCount(metrics.At(k))
+			}
+		}
+	}
+
+	if len(metricList) == 0 {
+		return nil
+	}
+
+	records := e.marshalRecords(len(metricList), logTypeMetrics, func(i int) interface{} { return metricList[i].TelemetryMetric })
+	result := e.uploadRecords(ctx, records, logTypeMetrics)
+
+	// The records dropped by Site24x7 are committed too, so that their
+	// deltas are not reported again with the next batch.
+	uploaded := make([]metricItem, 0, len(metricList))
+	for i, item := range metricList {
+		if !result.retryable[i] {
+			uploaded = append(uploaded, item)
+		}
+	}
+	e.metrics.commit(uploaded)
+	return e.metricsError(md, result, dataPoints)
+}
+
+func dataPointCount(metric pdata.Metric) int {
+	switch metric.DataType() {
+	case pdata.MetricDataTypeGauge:
+		return metric.Gauge().DataPoints().Len()
+	case pdata.MetricDataTypeSum:
+		return metric.Sum().DataPoints().Len()
+	case pdata.MetricDataTypeHistogram:
+		return metric.Histogram().DataPoints().Len()
+	case pdata.MetricDataTypeSummary:
+		return metric.Summary().DataPoints().Len()
+	}
+	return 0
+}
+
+// metricsError reports the data points of the chunks that failed with a
+// retryable error back to the exporterhelper, so that only those are retried.
+// Their cumulative series were not committed, the retry computes their deltas
+// from the same state. Otherwise it reports the dropped data points with their
+// permanent error.
+func (e *site24x7exporter) metricsError(md pdata.Metrics, result uploadResult, dataPoints []int) error {
+	if result.retryErr == nil {
+		if result.permanentErr == nil {
+			return nil
+		}
+		return consumererror.NewMetrics(result.permanentErr, selectDataPoints(md, result.dropped, dataPoints))
+	}
+	e.logDropped(result, logTypeMetrics)
+	return consumererror.NewMetrics(result.retryErr, selectDataPoints(md, result.retryable, dataPoints))
+}
+
+// selectDataPoints returns a copy of the metrics with the data points of the
+// given records, dataPoints mapping the records to their data point.
+func selectDataPoints(md pdata.Metrics, records map[int]bool, dataPoints []int) pdata.Metrics {
+	indexes := make(map[int]bool, len(records))
+	for i := range records {
+		indexes[dataPoints[i]] = true
+	}
+
+	selected := md.Clone()
+	index := 0
+	keep := func() bool {
+		keep := indexes[index]
+		index++
+		return keep
+	}
+	selected.ResourceMetrics().RemoveIf(func(rm pdata.ResourceMetrics) bool {
+		rm.InstrumentationLibraryMetrics().RemoveIf(func(ilm pdata.InstrumentationLibraryMetrics) bool {
+			ilm.Metrics().RemoveIf(func(metric pdata.Metric) bool {
+				switch metric.DataType() {
+				case pdata.MetricDataTypeGauge:
+					metric.Gauge().DataPoints().RemoveIf(func(pdata.NumberDataPoint) bool { return !keep() })
+				case pdata.MetricDataTypeSum:
+					metric.Sum().DataPoints().RemoveIf(func(pdata.NumberDataPoint) bool { return !keep() })
+				case pdata.MetricDataTypeHistogram:
+					metric.Histogram().DataPoints().RemoveIf(func(pdata.HistogramDataPoint) bool { return !keep() })
+				case pdata.MetricDataTypeSummary:
+					metric.Summary().DataPoints().RemoveIf(func(pdata.SummaryDataPoint) bool { return !keep() })
+				}
+				return dataPointCount(metric) == 0
+			})
+			return ilm.Metrics().Len() == 0
+		})
+		return rm.InstrumentationLibraryMetrics().Len() == 0
+	})
+	return selected
+}
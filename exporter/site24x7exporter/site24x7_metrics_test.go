@@ -0,0 +1,280 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opencensus.io/stats/view"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+var (
+	testStartTime = pdata.NewTimestampFromTime(time.Unix(1600000000, 0))
+	testTime1     = pdata.NewTimestampFromTime(time.Unix(1600000010, 0))
+	testTime2     = pdata.NewTimestampFromTime(time.Unix(1600000020, 0))
+	testTime3     = pdata.NewTimestampFromTime(time.Unix(1600000030, 0))
+)
+
+func newSumMetric(temporality pdata.AggregationTemporality, monotonic bool, ts pdata.Timestamp, value int64) pdata.Metric {
+	m := pdata.NewMetric()
+	m.SetName("requests")
+	m.SetUnit("{requests}")
+	m.SetDataType(pdata.MetricDataTypeSum)
+	m.Sum().SetAggregationTemporality(temporality)
+	m.Sum().SetIsMonotonic(monotonic)
+	dp := m.Sum().DataPoints().AppendEmpty()
+	dp.SetStartTimestamp(testStartTime)
+	dp.SetTimestamp(ts)
+	dp.SetIntVal(value)
+	dp.Attributes().InsertString("http.method", "GET")
+	return m
+}
+
+func TestMapUnit(t *testing.T) {
+	assert.Equal(t, "milliseconds", mapUnit("ms"))
+	assert.Equal(t, "bytes", mapUnit("By"))
+	assert.Equal(t, "", mapUnit("1"))
+	assert.Equal(t, "requests", mapUnit("{requests}"))
+	assert.Equal(t, "widgets", mapUnit("widgets"))
+}
+
+func TestCreateMetricItemsGauge(t *testing.T) {
+	m := pdata.NewMetric()
+	m.SetName("cpu.utilization")
+	m.SetUnit("%")
+	m.SetDataType(pdata.MetricDataTypeGauge)
+	dp := m.Gauge().DataPoints().AppendEmpty()
+	dp.SetTimestamp(testTime1)
+	dp.SetDoubleVal(42.5)
+	dp.Attributes().InsertString("cpu", "0")
+	dp.Attributes().InsertString("host.name", "point-host")
+
+	resourceAttr := map[string]interface{}{"service.name": "svc", "host.name": "resource-host"}
+	items := newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL).CreateMetricItems(m, resourceAttr, "svc", "lib", "1.0")
+	require.Len(t, items, 1)
+	item := items[0]
+	assert.Equal(t, metricTypeGauge, item.Type)
+	assert.Equal(t, "percent", item.Unit)
+	assert.Equal(t, 42.5, item.Value)
+	assert.Equal(t, int64(1600000010000), item.Timestamp)
+	assert.Equal(t, "svc", item.ServiceName)
+	assert.Equal(t, "lib", item.InstrumentationLibrary)
+	assert.Equal(t, telemetryAttributes{
+		"service.name": "svc",
+		"host.name":    "point-host",
+		"cpu":          "0",
+	}, item.Dimensions)
+}
+
+func TestCreateMetricItemsCumulativeSum(t *testing.T) {
+	tr := newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL)
+
+	items := tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityCumulative, true, testTime1, 10), nil, "", "", "")
+	assert.Empty(t, items, "first point of a cumulative series is only used as baseline")
+
+	items = tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityCumulative, true, testTime2, 25), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, temporalityDelta, items[0].Temporality)
+	assert.Equal(t, float64(15), items[0].Value)
+	assert.True(t, items[0].IsMonotonic)
+	assert.Equal(t, "requests", items[0].Unit)
+
+	// Until the record is uploaded, the deltas are computed from the first point.
+	items = tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityCumulative, true, testTime2, 25), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, float64(15), items[0].Value)
+	tr.commit(items)
+
+	// A lower value means the counter was reset.
+	items = tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityCumulative, true, testTime3, 5), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, float64(5), items[0].Value)
+
+	// A point older than the uploaded one was already accounted.
+	assert.Empty(t, tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityCumulative, true, testTime1, 10), nil, "", "", ""))
+}
+
+func TestCumulativeSeriesAreForgotten(t *testing.T) {
+	newSeries := func(method string, ts pdata.Timestamp, value int64) pdata.Metric {
+		m := newSumMetric(pdata.AggregationTemporalityCumulative, true, ts, value)
+		m.Sum().DataPoints().At(0).Attributes().UpdateString("http.method", method)
+		return m
+	}
+	tr := newMetricsTranslator(1, time.Minute)
+	now := time.Unix(1600000000, 0)
+	tr.nowFunc = func() time.Time { return now }
+
+	assert.Empty(t, tr.CreateMetricItems(newSeries("GET", testTime1, 10), nil, "", "", ""))
+	assert.Empty(t, tr.CreateMetricItems(newSeries("POST", testTime1, 10), nil, "", "", ""))
+	assert.Equal(t, 1, tr.prev.Len())
+	assert.Empty(t, tr.CreateMetricItems(newSeries("GET", testTime2, 20), nil, "", "", ""), "the least recently seen series is evicted")
+
+	// Seeing a series keeps it from expiring.
+	now = now.Add(50 * time.Second)
+	items := tr.CreateMetricItems(newSeries("GET", testTime3, 25), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, float64(5), items[0].Value)
+
+	now = now.Add(2 * time.Minute)
+	assert.Empty(t, tr.CreateMetricItems(newSeries("GET", testTime3, 30), nil, "", "", ""), "expired series start over from a new baseline")
+}
+
+func TestCreateMetricItemsNonMonotonicAndDeltaSum(t *testing.T) {
+	tr := newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL)
+
+	items := tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityCumulative, false, testTime1, 10), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, temporalityCumulative, items[0].Temporality)
+	assert.Equal(t, float64(10), items[0].Value)
+
+	items = tr.CreateMetricItems(newSumMetric(pdata.AggregationTemporalityDelta, true, testTime1, 7), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, temporalityDelta, items[0].Temporality)
+	assert.Equal(t, float64(7), items[0].Value)
+}
+
+func TestCreateMetricItemsHistogram(t *testing.T) {
+	newHistogram := func(ts pdata.Timestamp, count uint64, sum float64, buckets []uint64) pdata.Metric {
+		m := pdata.NewMetric()
+		m.SetName("latency")
+		m.SetUnit("ms")
+		m.SetDataType(pdata.MetricDataTypeHistogram)
+		m.Histogram().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+		dp := m.Histogram().DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(testStartTime)
+		dp.SetTimestamp(ts)
+		dp.SetCount(count)
+		dp.SetSum(sum)
+		dp.SetBucketCounts(buckets)
+		dp.SetExplicitBounds([]float64{10, 100})
+		return m
+	}
+
+	tr := newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL)
+	assert.Empty(t, tr.CreateMetricItems(newHistogram(testTime1, 3, 30, []uint64{1, 1, 1}), nil, "", "", ""))
+
+	items := tr.CreateMetricItems(newHistogram(testTime2, 5, 250, []uint64{2, 2, 1}), nil, "", "", "")
+	require.Len(t, items, 1)
+	item := items[0]
+	assert.Equal(t, metricTypeHistogram, item.Type)
+	assert.Equal(t, "milliseconds", item.Unit)
+	assert.Equal(t, uint64(2), item.Count)
+	assert.Equal(t, float64(220), item.Sum)
+	assert.Equal(t, []uint64{1, 1, 0}, item.BucketCounts)
+	assert.Equal(t, []float64{10, 100}, item.ExplicitBounds)
+}
+
+func TestCreateMetricItemsSummary(t *testing.T) {
+	m := pdata.NewMetric()
+	m.SetName("rpc.duration")
+	m.SetDataType(pdata.MetricDataTypeSummary)
+	dp := m.Summary().DataPoints().AppendEmpty()
+	dp.SetTimestamp(testTime1)
+	dp.SetCount(4)
+	dp.SetSum(12)
+	qv := dp.QuantileValues().AppendEmpty()
+	qv.SetQuantile(0.99)
+	qv.SetValue(9)
+
+	items := newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL).CreateMetricItems(m, nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, metricTypeSummary, items[0].Type)
+	assert.Equal(t, uint64(4), items[0].Count)
+	assert.Equal(t, float64(12), items[0].Sum)
+	assert.Equal(t, []TelemetryQuantile{{Quantile: 0.99, Value: 9}}, items[0].Quantiles)
+}
+
+func TestCreateMetricItemsSkipsNonFiniteValues(t *testing.T) {
+	require.NoError(t, view.Register(MetricViews()...))
+	defer view.Unregister(MetricViews()...)
+
+	gauge := pdata.NewMetric()
+	gauge.SetName("ratio")
+	gauge.SetDataType(pdata.MetricDataTypeGauge)
+	for _, v := range []float64{math.NaN(), 0.5, math.Inf(1), math.Inf(-1)} {
+		gauge.Gauge().DataPoints().AppendEmpty().SetDoubleVal(v)
+	}
+	tr := newMetricsTranslator(maxCumulativeSeries, cumulativeSeriesTTL)
+	items := tr.CreateMetricItems(gauge, nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, 0.5, items[0].Value)
+	assert.Equal(t, 1, items[0].dataPoint)
+
+	// A NaN point of a cumulative series leaves its baseline alone.
+	newSum := func(ts pdata.Timestamp, value float64) pdata.Metric {
+		m := newSumMetric(pdata.AggregationTemporalityCumulative, true, ts, 0)
+		m.Sum().DataPoints().At(0).SetDoubleVal(value)
+		return m
+	}
+	assert.Empty(t, tr.CreateMetricItems(newSum(testTime1, 10), nil, "", "", ""))
+	assert.Empty(t, tr.CreateMetricItems(newSum(testTime2, math.NaN()), nil, "", "", ""))
+	items = tr.CreateMetricItems(newSum(testTime3, 25), nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, float64(15), items[0].Value)
+
+	histogram := pdata.NewMetric()
+	histogram.SetName("latency")
+	histogram.SetDataType(pdata.MetricDataTypeHistogram)
+	histogram.Histogram().SetAggregationTemporality(pdata.AggregationTemporalityDelta)
+	histogram.Histogram().DataPoints().AppendEmpty().SetSum(math.Inf(1))
+	histogram.Histogram().DataPoints().AppendEmpty().SetSum(1)
+	items = tr.CreateMetricItems(histogram, nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, float64(1), items[0].Sum)
+
+	summary := pdata.NewMetric()
+	summary.SetName("rpc.duration")
+	summary.SetDataType(pdata.MetricDataTypeSummary)
+	summary.Summary().DataPoints().AppendEmpty().QuantileValues().AppendEmpty().SetValue(math.NaN())
+	summary.Summary().DataPoints().AppendEmpty().SetSum(math.NaN())
+	summary.Summary().DataPoints().AppendEmpty().QuantileValues().AppendEmpty().SetValue(9)
+	items = tr.CreateMetricItems(summary, nil, "", "", "")
+	require.Len(t, items, 1)
+	assert.Equal(t, 2, items[0].dataPoint)
+
+	rows, err := view.RetrieveData(mSkippedDataPoints.Name())
+	require.NoError(t, err)
+	require.Len(t, rows, 1)
+	assert.Equal(t, float64(7), rows[0].Data.(*view.SumData).Value)
+}
+
+func TestConsumeMetricsUploadsFiniteValues(t *testing.T) {
+	server := newMockServer(t)
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
+	defer fe.Shutdown(context.Background())
+
+	md := pdata.NewMetrics()
+	metrics := md.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty().Metrics()
+	for i, v := range []float64{1, math.NaN(), 2, math.Inf(1)} {
+		m := metrics.AppendEmpty()
+		m.SetName(fmt.Sprintf("gauge.%d", i))
+		m.SetDataType(pdata.MetricDataTypeGauge)
+		m.Gauge().DataPoints().AppendEmpty().SetDoubleVal(v)
+	}
+	require.NoError(t, fe.ConsumeMetrics(context.Background(), md))
+
+	var records []TelemetryMetric
+	require.NoError(t, lastUpload(t, server).Decode(&records))
+	require.Len(t, records, 2)
+	assert.Equal(t, "gauge.0", records[0].Name)
+	assert.Equal(t, "gauge.2", records[1].Name)
+}
@@ -16,21 +16,34 @@ package site24x7exporter
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"crypto/tls"
 	"encoding/json"
 	"fmt"
-	"io"
 	"io/ioutil"
 	"net/http"
-	"strconv"
-	"strings"
+	"sort"
 	"time"
 
+	"go.opentelemetry.io/collector/consumer/consumererror"
 	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
 )
 
+// isExceptionEvent reports whether the span event records an exception, see
+// https://github.com/open-telemetry/opentelemetry-specification/blob/main/specification/trace/semantic_conventions/exceptions.md
+func isExceptionEvent(event pdata.SpanEvent) bool {
+	if event.Name() == "exception" {
+		return true
+	}
+	attrs := event.Attributes()
+	for _, key := range []string{"exception.message", "exception.stacktrace", "exception.type"} {
+		if _, found := attrs.Get(key); found {
+			return true
+		}
+	}
+	return false
+}
+
 func (e *site24x7exporter) CreateTelemetrySpan(span pdata.Span,
 	resourceAttr map[string]interface{},
 	serviceName string,
@@ -38,16 +51,15 @@ func (e *site24x7exporter) CreateTelemetrySpan(span pdata.Span,
 	instLibraryVersion string,
 	telSDKLang string,
 	telSDKName string,
-	rootSpanId string,) TelemetrySpan {
+	rootSpanId string) TelemetrySpan {
 
 	spanAttr := span.Attributes().AsRaw()
 	startTime := (span.StartTimestamp().AsTime().UnixNano()) // int64(time.Millisecond))
 	endTime := (span.EndTimestamp().AsTime().UnixNano())     // int64(time.Millisecond))
 	spanEvts := span.Events()
 	telEvents := make([]TelemetrySpanEvent, 0, spanEvts.Len())
-	exceptionMessages := make([]string, 0, spanEvts.Len())
-	exceptionStackTraces := make([]string, 0, spanEvts.Len())
-	exceptionTypes := make([]string, 0, spanEvts.Len())
+	var exceptionTimestamps []int64
+	var exceptionMessages, exceptionStackTraces, exceptionTypes []string
 	for i := 0; i < spanEvts.Len(); i++ {
 		spanEvt := spanEvts.At(i)
 		telEvt := TelemetrySpanEvent{
@@ -55,19 +67,14 @@ func (e *site24x7exporter) CreateTelemetrySpan(span pdata.Span,
 			Name:            spanEvt.Name(),
 			EventAttributes: spanEvt.Attributes().AsRaw(),
 		}
-		if telEvt.EventAttributes != nil {
-
-			if exMsg, found := telEvt.EventAttributes["exception.message"]; found {
-				exceptionMessages = append(exceptionMessages, exMsg.(string))
-			}
-
-			if exST, found := telEvt.EventAttributes["exception.stacktrace"]; found {
-				exceptionStackTraces = append(exceptionStackTraces, exST.(string))
-			}
-
-			if exType, found := telEvt.EventAttributes["exception.type"]; found {
-				exceptionTypes = append(exceptionTypes, exType.(string))
-			}
+		if isExceptionEvent(spanEvt) {
+			// Every exception event adds an entry to all exception fields, so
+			// that their indexes match.
+			evtAttr := spanEvt.Attributes()
+			exceptionTimestamps = append(exceptionTimestamps, telEvt.Timestamp)
+			exceptionMessages = append(exceptionMessages, attributeString(evtAttr, "exception.message"))
+			exceptionStackTraces = append(exceptionStackTraces, attributeString(evtAttr, "exception.stacktrace"))
+			exceptionTypes = append(exceptionTypes, attributeString(evtAttr, "exception.type"))
 		}
 		telEvents = append(telEvents, telEvt)
 	}
@@ -103,52 +110,6 @@ func (e *site24x7exporter) CreateTelemetrySpan(span pdata.Span,
 		spanKind = "CONSUMER"
 	}
 
-	// Host attributes
-	var hostIp, hostName, threadname string
-	var hostPort, threadid int64
-	if attrval, found := spanAttr["net.peer.ip"]; found {
-		hostIp = attrval.(string)
-	}
-	if attrval, found := spanAttr["net.peer.name"]; found {
-		hostName = attrval.(string)
-	}
-	if attrval, found := spanAttr["net.peer.port"]; found {
-		hostPort = attrval.(int64)
-	}
-	// Thread attributes
-	if attrval, found := spanAttr["thread.id"]; found {
-		threadid = attrval.(int64)
-	}
-	if attrval, found := spanAttr["thread.name"]; found {
-		threadname = attrval.(string)
-	}
-	// DB attributes
-	var dbsystem, dbstmt, dbname, dbconnstr string
-	if attrval, found := spanAttr["db.system"]; found {
-		dbsystem = attrval.(string)
-	}
-	if attrval, found := spanAttr["db.statement"]; found {
-		dbstmt = attrval.(string)
-	}
-	if attrval, found := spanAttr["db.name"]; found {
-		dbname = attrval.(string)
-	}
-	if attrval, found := spanAttr["db.connection_string"]; found {
-		dbconnstr = attrval.(string)
-	}
-	// Http attributes
-	var httpurl, httpmethod string
-	var httpstatus int64
-	if attrval, found := spanAttr["http.url"]; found {
-		httpurl = attrval.(string)
-	}
-	if attrval, found := spanAttr["http.method"]; found {
-		httpmethod = attrval.(string)
-	}
-	if attrval, found := spanAttr["http.status_code"]; found {
-		httpstatus = attrval.(int64)
-	}
-
 	isRoot := span.ParentSpanID().IsEmpty()
 	telemetryParams := make([]TelemetryCustomParam, 0, len(spanAttr))
 	for k, v := range spanAttr {
@@ -158,39 +119,41 @@ func (e *site24x7exporter) CreateTelemetrySpan(span pdata.Span,
 		}
 		telemetryParams = append(telemetryParams, telemetrycustomParam)
 	}
+	// Map iteration order is random, sort to keep the records stable.
+	sort.Slice(telemetryParams, func(i, j int) bool { return telemetryParams[i].Key < telemetryParams[j].Key })
 
 	spanid := span.SpanID().HexString()
 	traceId := span.TraceID().HexString()
 	parentspanId := span.ParentSpanID().HexString()
 	spanName := span.Name()
-	
+
 	//fmt.Println("Creating telemetry span: Trace/Span/Parent/Root:  ", traceId," / ", spanid," / ", parentspanId," / ", rootSpanId)
 	startTimeMs := (startTime / int64(time.Millisecond))
 
 	tspan := TelemetrySpan{
-		Timestamp:          	startTimeMs,
-		S247UID:	            "otel-s247exporter",
+		Timestamp:              startTimeMs,
+		S247UID:                "otel-s247exporter",
 		SpanId:                 spanid,
 		TraceId:                traceId,
 		ParentSpanId:           parentspanId,
-		RootSpanId: 			rootSpanId,
+		RootSpanId:             rootSpanId,
 		Name:                   spanName,
 		Kind:                   spanKind,
 		StartTime:              startTime,
 		EndTime:                endTime,
 		Duration:               float64(endTime-startTime) / float64(time.Millisecond),
 		ServiceName:            serviceName,
-		resourceAttributes:     resourceAttr,
-		spanAttributes:         spanAttr,
-		traceState:             string(span.TraceState()),
-		spanEvents:             telEvents,
-		spanLinks:              telLinks,
-		statusCode:             spanState.Code().String(),
-		statusMsg:              spanState.Message(),
-		droppedAttributesCount: span.DroppedAttributesCount(),
-		droppedLinksCount:      span.DroppedLinksCount(),
-		droppedEventsCount:     span.DroppedEventsCount(),
+		StatusCode:             spanState.Code().String(),
+		StatusMessage:          spanState.Message(),
+		TraceState:             string(span.TraceState()),
+		DroppedAttributesCount: span.DroppedAttributesCount(),
+		DroppedEventsCount:     span.DroppedEventsCount(),
+		DroppedLinksCount:      span.DroppedLinksCount(),
 
+		resourceAttributes: resourceAttr,
+		spanAttributes:     spanAttr,
+
+		ExceptionTimestamp:  exceptionTimestamps,
 		ExceptionMessage:    exceptionMessages,
 		ExceptionStackTrace: exceptionStackTraces,
 		ExceptionType:       exceptionTypes,
@@ -200,93 +163,68 @@ func (e *site24x7exporter) CreateTelemetrySpan(span pdata.Span,
 		TelemetrySDKLanguage:          telSDKLang,
 		TelemetrySDKName:              telSDKName,
 
-		HostIP:   hostIp,
-		HostName: hostName,
-		HostPort: hostPort,
-
-		ThreadId:   threadid,
-		ThreadName: threadname,
-
-		DbSystem:    dbsystem,
-		DbStatement: dbstmt,
-		DbName:      dbname,
-		DbConnStr:   dbconnstr,
-
-		HttpUrl:        httpurl,
-		HttpMethod:     httpmethod,
-		HttpStatusCode: httpstatus,
-
 		IsRoot:   isRoot,
 		HasError: hasError,
 
 		CustomParams: telemetryParams,
 	}
+	if e.exportSpanEvents {
+		tspan.Events = telEvents
+	}
+	if e.exportSpanLinks {
+		tspan.Links = telLinks
+	}
+	e.spanMapper.apply(span.Attributes(), &tspan)
+	e.redactor.redact(&tspan)
 	return tspan
 }
 
-func (e *site24x7exporter) ConsumeTraces(_ context.Context, td pdata.Traces) error {
-	/*buf, err := tracesMarshaler.MarshalTraces(td)
-	if err != nil {
-		return err
-	}
-	return exportMessageAsLine(e, buf)*/
-
-	e.mutex.Lock()
-	defer e.mutex.Unlock()
-
+// batchRootSpans returns the root spans of the traces in the batch.
+func batchRootSpans(td pdata.Traces) map[pdata.TraceID]rootSpan {
+	roots := make(map[pdata.TraceID]rootSpan)
 	resourcespans := td.ResourceSpans()
-	spanCount := td.SpanCount()
-	rootSpanList := make(map[string]string)
-
-	spanList := make([]TelemetrySpan, 0, spanCount)
-	
-	t := time.Now()
-	fmt.Println(t, "Begin formatting spans ", spanCount)
-
 	for i := 0; i < resourcespans.Len(); i++ {
 		rspans := resourcespans.At(i)
+		serviceName := attributeString(rspans.Resource().Attributes(), "service.name")
 		instSpans := rspans.InstrumentationLibrarySpans()
-		// processing root id before sending in arh
 		for j := 0; j < instSpans.Len(); j++ {
-			ispans := instSpans.At(j)
-			ispanItems := ispans.Spans()
-
+			ispanItems := instSpans.At(j).Spans()
 			for k := 0; k < ispanItems.Len(); k++ {
 				span := ispanItems.At(k)
-				var rootSpanId string
-				var traceId string
 				if span.ParentSpanID().IsEmpty() {
-					//rootSpanId = span.SpanID().HexString()
-					traceId = span.TraceID().HexString()
-					rootSpanId = span.Name()
-					//parentSpanId = "nil"
-					rootSpanList[traceId] = rootSpanId
-					//fmt.Println("Formatting spans: Trace/Root:  ", traceId," / ", rootSpanId)
-				} 
+					roots[span.TraceID()] = rootSpan{name: span.Name(), service: serviceName}
+				}
 			}
 		}
 	}
+	return roots
+}
+
+func (e *site24x7exporter) ConsumeTraces(ctx context.Context, td pdata.Traces) error {
+	resourcespans := td.ResourceSpans()
+	spanCount := td.SpanCount()
+	rootSpans := batchRootSpans(td)
+	if e.rootSpans != nil {
+		e.rootSpans.add(rootSpans)
+	}
+
+	spanList := make([]TelemetrySpan, 0, spanCount)
+	// pending holds the indexes of the spans whose root span is unknown, by trace.
+	pending := make(map[pdata.TraceID][]int)
+	// transactions holds the APM transactions by the index of their span.
+	transactions := make(map[int]apmTransaction)
 
-	t = time.Now()
-	fmt.Println(t, "Completed formatting meta-data")
 	for i := 0; i < resourcespans.Len(); i++ {
 		rspans := resourcespans.At(i)
 		resource := rspans.Resource()
 		resourceAttr := resource.Attributes().AsRaw()
 
-		var serviceName, telSDKLang, telSDKName string
-		if val, found := resourceAttr["service.name"]; found {
-			serviceName = val.(string)
-		}
-		if val, found := resourceAttr["telemetry.sdk.name"]; found {
-			telSDKName = val.(string)
-		}
-		if val, found := resourceAttr["telemetry.sdk.language"]; found {
-			telSDKLang = val.(string)
-		}
+		serviceName := attributeString(resource.Attributes(), "service.name")
+		telSDKName := attributeString(resource.Attributes(), "telemetry.sdk.name")
+		telSDKLang := attributeString(resource.Attributes(), "telemetry.sdk.language")
 
 		instSpans := rspans.InstrumentationLibrarySpans()
-		
+
 		for j := 0; j < instSpans.Len(); j++ {
 			ispans := instSpans.At(j)
 			instLibName := ispans.InstrumentationLibrary().Name()
@@ -295,118 +233,74 @@ func (e *site24x7exporter) ConsumeTraces(_ context.Context, td pdata.Traces) err
 
 			for k := 0; k < ispanItems.Len(); k++ {
 				span := ispanItems.At(k)
-				
-				//traceId := span.TraceID().HexString()
-				//spanId := span.SpanID().HexString()
-				//parentSpanId := span.ParentSpanID().HexString()
 
-				rootSpanId := rootSpanList[span.TraceID().HexString()]
+				root, found := rootSpans[span.TraceID()]
+				if !found && e.rootSpans != nil {
+					root, found = e.rootSpans.get(span.TraceID())
+				}
+				if !found {
+					pending[span.TraceID()] = append(pending[span.TraceID()], len(spanList))
+				}
+				if e.apmMetrics != nil && isAPMTransaction(span) {
+					transactions[len(spanList)] = newAPMTransaction(serviceName, span)
+				}
 
-				//fmt.Println("Formatting spans: Trace/Span/Parent/Root:  ", traceId," / ", spanId," / ", parentSpanId," / ", rootSpanId)
-				
 				s247span := e.CreateTelemetrySpan(span, resourceAttr,
 					serviceName,
 					instLibName, instLibVer,
-					telSDKLang, telSDKName, rootSpanId)
+					telSDKLang, telSDKName, root.name)
+				s247span.RootServiceName = root.service
 				spanList = append(spanList, s247span)
 			}
 		}
 	}
-	t = time.Now()
-	fmt.Println(t, "Completed formatting spans ", spanCount)
-	io.WriteString(e.file, "\nTransformed telemetry data to site24x7 format. \n")
-	buf, err := json.Marshal(spanList)
-	if err != nil {
-		io.WriteString(e.file, "\nError in converting telemetry data. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
+
+	if len(pending) > 0 && e.rootSpans != nil && e.holdWindow > 0 {
+		e.rootSpans.wait(ctx, e.holdWindow, pending, func(i int, root rootSpan) {
+			spanList[i].RootSpanId = root.name
+			spanList[i].RootServiceName = root.service
+		})
 	}
-	
-	if strings.Contains(e.url, "catalyst") {
-		err = e.SendCatalyst(buf)
-		t = time.Now()
-		fmt.Println(t, "Completed exporting spans catalyst", spanCount)
-	} else {
-		err = SendAppLogs(e, buf, len(spanList))
-		t = time.Now()
-		fmt.Println(t, "Completed exporting spans applogs", spanCount)
+
+	if e.catalyst {
+		buf, err := json.Marshal(spanList)
+		if err != nil {
+			return consumererror.Permanent(err)
+		}
+		err = e.SendCatalyst(ctx, buf)
+		if err == nil || consumererror.IsPermanent(err) {
+			e.recordAPMTransactions(transactions, nil)
+		}
+		return err
 	}
 
-	return err
+	records := e.marshalRecords(len(spanList), logTypeTraces, func(i int) interface{} { return spanList[i] })
+	result := e.uploadRecords(ctx, records, logTypeTraces)
+	e.recordAPMTransactions(transactions, result.retryable)
+	return e.tracesError(td, result)
 }
 
-func (e *site24x7exporter) SendCatalyst(buf []byte) error {
-	// Deprecated end-point. 
+func (e *site24x7exporter) SendCatalyst(ctx context.Context, buf []byte) error {
+	// Deprecated end-point.
 	var urlBuf bytes.Buffer
-	responseBody := bytes.NewBuffer(buf)
-	//fmt.Println("Sending to Site24x7: ", responseBody)
-	fmt.Fprint(&urlBuf, e.url, "?license.key=", e.apikey)
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: e.insecure}
-	resp, err := http.Post(urlBuf.String(), "application/json", responseBody)
+	fmt.Fprint(&urlBuf, e.endpoints.traces, "?license.key=", e.apikey)
+	req, err := http.NewRequestWithContext(ctx, "POST", urlBuf.String(), bytes.NewBuffer(buf))
+	if err != nil {
+		return consumererror.Permanent(err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	e.dumpPayload(buf)
+	resp, err := e.client.Do(req)
 	if err != nil {
-		io.WriteString(e.file, "\nError in posting data to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
 		return err
 	}
-	io.WriteString(e.file, "\nPosting telemetry data to url. \n")
 	defer resp.Body.Close()
 	body, err := ioutil.ReadAll(resp.Body)
 	if err != nil {
 		return err
 	}
-	if _, err := e.file.Write(body); err != nil {
-		return err
-	}
-	return err
+	e.logger.Debug("Uploaded spans to Site24x7 Catalyst",
+		zap.Int("status", resp.StatusCode),
+		zap.ByteString("response", body))
+	return checkResponse(resp)
 }
-
-func SendAppLogs(e *site24x7exporter, buf []byte, spanCount int) error {
-	client := http.Client{}
-
-	var gzbuf bytes.Buffer
-	g := gzip.NewWriter(&gzbuf)
-	g.Write(buf)
-	g.Close()
-	req , err := http.NewRequest("POST", e.url, &gzbuf)
-	if err != nil {
-		//Handle Error
-		fmt.Println("Error initializing Url: ", err)
-		io.WriteString(e.file, "\nError in posting logs to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-
-	req.Header = http.Header{
-		"X-DeviceKey": []string{e.apikey},
-		"Content-Type": []string{"application/json"},
-		"X-LogType": []string{"s247apmopentelemetrytracing"},
-		"X-StreamMode": []string{"1"},
-		"Log-Size": []string{strconv.Itoa(spanCount)},
-		"Content-Encoding": []string{"gzip"},
-		"User-Agent": []string{"site24x7exporter"},
-	}
-	http.DefaultTransport.(*http.Transport).TLSClientConfig = &tls.Config{InsecureSkipVerify: e.insecure}
-	res , err := client.Do(req)
-	if err != nil {
-		//Handle Error
-		fmt.Println("Error initializing Url: ", err)
-		io.WriteString(e.file, "\nError in posting traces to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-	io.WriteString(e.file, "\nPosting telemetry traces to url. \n")
-	uploadid := res.Header.Values("x-uploadid")
-	io.WriteString(e.file, "Upload ID: " + strings.Join(uploadid," "))
-	fmt.Println("Uploaded logs information: ", res.Header)
-	if err != nil {
-		io.WriteString(e.file, "\nError in posting logs to url. \n")
-		errstr := err.Error()
-		io.WriteString(e.file, errstr)
-		return err
-	}
-	return err
-}
\ No newline at end of file
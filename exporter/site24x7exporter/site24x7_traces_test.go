@@ -0,0 +1,102 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func newSpanWithDetails() pdata.Span {
+	span := pdata.NewSpan()
+	span.SetTraceID(testTraceID1)
+	span.SetSpanID(pdata.NewSpanID([8]byte{1}))
+	span.SetName("GET /orders")
+	span.SetTraceState("vendor=value")
+	span.Status().SetCode(pdata.StatusCodeError)
+	span.Status().SetMessage("order not found")
+	span.SetDroppedAttributesCount(1)
+	span.SetDroppedEventsCount(2)
+	span.SetDroppedLinksCount(3)
+
+	evt := span.Events().AppendEmpty()
+	evt.SetName("cache miss")
+	evt.SetTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000001, 0)))
+	// The first exception has no message, the exception fields must stay aligned.
+	evt = span.Events().AppendEmpty()
+	evt.SetName("exception")
+	evt.SetTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000002, 0)))
+	evt.Attributes().InsertString("exception.type", "NotFound")
+	evt = span.Events().AppendEmpty()
+	evt.SetName("exception")
+	evt.SetTimestamp(pdata.NewTimestampFromTime(time.Unix(1600000003, 0)))
+	evt.Attributes().InsertString("exception.type", "Timeout")
+	evt.Attributes().InsertString("exception.message", "deadline exceeded")
+
+	link := span.Links().AppendEmpty()
+	link.SetTraceID(testTraceID2)
+	link.SetSpanID(pdata.NewSpanID([8]byte{9}))
+	return span
+}
+
+func TestCreateTelemetrySpanDetails(t *testing.T) {
+	fe := newSite24x7Exporter(newTestConfig(""), zap.NewNop())
+	tspan := fe.CreateTelemetrySpan(newSpanWithDetails(), nil, "svc", "", "", "", "", "")
+
+	assert.Equal(t, "STATUS_CODE_ERROR", tspan.StatusCode)
+	assert.Equal(t, "order not found", tspan.StatusMessage)
+	assert.Equal(t, "vendor=value", tspan.TraceState)
+	assert.Equal(t, uint32(1), tspan.DroppedAttributesCount)
+	assert.Equal(t, uint32(2), tspan.DroppedEventsCount)
+	assert.Equal(t, uint32(3), tspan.DroppedLinksCount)
+	require.Len(t, tspan.Events, 3)
+	assert.Equal(t, "cache miss", tspan.Events[0].Name)
+	assert.Equal(t, []TelemetrySpanLink{{
+		LinkSpanID:  "0900000000000000",
+		LinkTraceID: testTraceID2.HexString(),
+	}}, tspan.Links)
+
+	assert.Equal(t, []int64{1600000002000, 1600000003000}, tspan.ExceptionTimestamp)
+	assert.Equal(t, []string{"NotFound", "Timeout"}, tspan.ExceptionType)
+	assert.Equal(t, []string{"", "deadline exceeded"}, tspan.ExceptionMessage)
+
+	buf, err := json.Marshal(tspan)
+	require.NoError(t, err)
+	var fields map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf, &fields))
+	for _, name := range []string{"events", "links", "status_code", "status_message", "trace_state",
+		"dropped_attributes_count", "dropped_events_count", "dropped_links_count", "exception_time"} {
+		assert.Contains(t, fields, name)
+	}
+}
+
+func TestCreateTelemetrySpanWithoutEventsAndLinks(t *testing.T) {
+	cfg := newTestConfig("")
+	cfg.ExportSpanEvents = false
+	cfg.ExportSpanLinks = false
+	fe := newSite24x7Exporter(cfg, zap.NewNop())
+	tspan := fe.CreateTelemetrySpan(newSpanWithDetails(), nil, "svc", "", "", "", "", "")
+
+	assert.Nil(t, tspan.Events)
+	assert.Nil(t, tspan.Links)
+	// Exceptions are still reported.
+	assert.Len(t, tspan.ExceptionType, 2)
+}
@@ -0,0 +1,250 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// uploadResult is the outcome of uploading a batch of records in one or more chunks.
+type uploadResult struct {
+	// retryable holds the indexes of the records whose chunk failed with a
+	// retryable error.
+	retryable map[int]bool
+	// dropped holds the indexes of the records that could not be marshaled or
+	// whose chunk was rejected for good.
+	dropped map[int]bool
+	// retryErr combines the errors of the chunks that can be retried.
+	retryErr error
+	// permanentErr combines the errors of the records that were dropped.
+	permanentErr error
+}
+
+// err returns the error to report when the failed records cannot be handed
+// back to the exporterhelper individually.
+func (r uploadResult) err() error {
+	if r.retryErr != nil {
+		return r.retryErr
+	}
+	return r.permanentErr
+}
+
+// marshalRecords marshals every element of a slice of records individually,
+// so that the records can be grouped into upload chunks. A record that cannot
+// be marshaled is logged and left nil, uploadRecords drops it and uploads the
+// others.
+func (e *site24x7exporter) marshalRecords(n int, logType string, record func(i int) interface{}) []json.RawMessage {
+	records := make([]json.RawMessage, n)
+	for i := 0; i < n; i++ {
+		buf, err := json.Marshal(record(i))
+		if err != nil {
+			e.logger.Error("Dropped record that cannot be marshaled",
+				zap.String("log_type", logType),
+				zap.Int("record", i),
+				zap.Error(err))
+			continue
+		}
+		records[i] = buf
+	}
+	return records
+}
+
+func joinRecords(records []json.RawMessage) []byte {
+	size := 2
+	for _, r := range records {
+		size += len(r) + 1
+	}
+	buf := make([]byte, 0, size)
+	buf = append(buf, '[')
+	for i, r := range records {
+		if i > 0 {
+			buf = append(buf, ',')
+		}
+		buf = append(buf, r...)
+	}
+	return append(buf, ']')
+}
+
+func compress(buf []byte) ([]byte, error) {
+	var gzbuf bytes.Buffer
+	g := gzip.NewWriter(&gzbuf)
+	if _, err := g.Write(buf); err != nil {
+		return nil, err
+	}
+	if err := g.Close(); err != nil {
+		return nil, err
+	}
+	return gzbuf.Bytes(), nil
+}
+
+// uploadRecords uploads the records to the AppLogs endpoint in chunks of at
+// most maxRecords records and maxBytes compressed bytes. A failing chunk does
+// not prevent the remaining chunks from being uploaded. The nil records, which
+// could not be marshaled, are dropped.
+func (e *site24x7exporter) uploadRecords(ctx context.Context, records []json.RawMessage, logType string) uploadResult {
+	var retryErrs, permanentErrs []error
+	result := uploadResult{retryable: make(map[int]bool), dropped: make(map[int]bool)}
+	marshaled := make([]json.RawMessage, 0, len(records))
+	indexes := make([]int, 0, len(records))
+	for i, r := range records {
+		if r == nil {
+			result.dropped[i] = true
+			continue
+		}
+		marshaled = append(marshaled, r)
+		indexes = append(indexes, i)
+	}
+	if len(result.dropped) > 0 {
+		permanentErrs = append(permanentErrs, consumererror.Permanent(
+			fmt.Errorf("dropped %d records that cannot be marshaled", len(result.dropped))))
+	}
+
+	for start := 0; start < len(marshaled); start += e.maxRecords {
+		end := start + e.maxRecords
+		if end > len(marshaled) {
+			end = len(marshaled)
+		}
+		e.uploadChunk(ctx, marshaled[start:end], indexes[start:end], logType, &result, &retryErrs, &permanentErrs)
+	}
+	result.retryErr = consumererror.Combine(retryErrs)
+	result.permanentErr = consumererror.Combine(permanentErrs)
+	return result
+}
+
+// uploadChunk uploads the records, whose indexes in the batch are given,
+// halving the chunk until its compressed payload fits into maxBytes.
+func (e *site24x7exporter) uploadChunk(ctx context.Context, records []json.RawMessage, indexes []int, logType string,
+	result *uploadResult, retryErrs *[]error, permanentErrs *[]error) {
+	drop := func(err error) {
+		*permanentErrs = append(*permanentErrs, err)
+		for _, i := range indexes {
+			result.dropped[i] = true
+		}
+	}
+
+	payload := joinRecords(records)
+	compressed, err := compress(payload)
+	if err != nil {
+		drop(consumererror.Permanent(err))
+		return
+	}
+
+	if len(compressed) > e.maxBytes {
+		if len(records) > 1 {
+			half := len(records) / 2
+			e.uploadChunk(ctx, records[:half], indexes[:half], logType, result, retryErrs, permanentErrs)
+			e.uploadChunk(ctx, records[half:], indexes[half:], logType, result, retryErrs, permanentErrs)
+			return
+		}
+		drop(consumererror.Permanent(
+			fmt.Errorf("record of %d compressed bytes exceeds max_bytes_per_request", len(compressed))))
+		return
+	}
+
+	e.dumpPayload(payload)
+	if err = e.postAppLogs(ctx, compressed, len(records), logType); err == nil {
+		return
+	}
+	if consumererror.IsPermanent(err) {
+		drop(err)
+		return
+	}
+	*retryErrs = append(*retryErrs, err)
+	for _, i := range indexes {
+		result.retryable[i] = true
+	}
+}
+
+// logDropped logs the chunks that were dropped while others are retried, as
+// their error is not reported to the exporterhelper.
+func (e *site24x7exporter) logDropped(result uploadResult, logType string) {
+	if result.retryErr != nil && result.permanentErr != nil {
+		e.logger.Error("Dropped records rejected by Site24x7",
+			zap.String("log_type", logType),
+			zap.Error(result.permanentErr))
+	}
+}
+
+// tracesError reports the spans of the chunks that failed with a retryable
+// error back to the exporterhelper, so that only those are retried. Otherwise
+// it reports the dropped spans with their permanent error.
+func (e *site24x7exporter) tracesError(td pdata.Traces, result uploadResult) error {
+	if result.retryErr == nil {
+		if result.permanentErr == nil {
+			return nil
+		}
+		return consumererror.NewTraces(result.permanentErr, selectSpans(td, result.dropped))
+	}
+	e.logDropped(result, logTypeTraces)
+	return consumererror.NewTraces(result.retryErr, selectSpans(td, result.retryable))
+}
+
+// selectSpans returns a copy of the traces with the spans of the given indexes.
+func selectSpans(td pdata.Traces, indexes map[int]bool) pdata.Traces {
+	selected := td.Clone()
+	index := 0
+	selected.ResourceSpans().RemoveIf(func(rs pdata.ResourceSpans) bool {
+		rs.InstrumentationLibrarySpans().RemoveIf(func(ils pdata.InstrumentationLibrarySpans) bool {
+			ils.Spans().RemoveIf(func(pdata.Span) bool {
+				remove := !indexes[index]
+				index++
+				return remove
+			})
+			return ils.Spans().Len() == 0
+		})
+		return rs.InstrumentationLibrarySpans().Len() == 0
+	})
+	return selected
+}
+
+// logsError reports the log records of the chunks that failed with a
+// retryable error back to the exporterhelper, so that only those are retried.
+// Otherwise it reports the dropped log records with their permanent error.
+func (e *site24x7exporter) logsError(ld pdata.Logs, result uploadResult) error {
+	if result.retryErr == nil {
+		if result.permanentErr == nil {
+			return nil
+		}
+		return consumererror.NewLogs(result.permanentErr, selectLogs(ld, result.dropped))
+	}
+	e.logDropped(result, logTypeLogs)
+	return consumererror.NewLogs(result.retryErr, selectLogs(ld, result.retryable))
+}
+
+// selectLogs returns a copy of the logs with the log records of the given indexes.
+func selectLogs(ld pdata.Logs, indexes map[int]bool) pdata.Logs {
+	selected := ld.Clone()
+	index := 0
+	selected.ResourceLogs().RemoveIf(func(rl pdata.ResourceLogs) bool {
+		rl.InstrumentationLibraryLogs().RemoveIf(func(ill pdata.InstrumentationLibraryLogs) bool {
+			ill.Logs().RemoveIf(func(pdata.LogRecord) bool {
+				remove := !indexes[index]
+				index++
+				return remove
+			})
+			return ill.Logs().Len() == 0
+		})
+		return rl.InstrumentationLibraryLogs().Len() == 0
+	})
+	return selected
+}
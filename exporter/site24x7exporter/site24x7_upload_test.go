@@ -0,0 +1,215 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package site24x7exporter
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/exporter/site24x7exporter/internal/mockserver"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/testdata"
+)
+
+// failUploadsContaining answers uploads whose payload contains substr with the status code.
+func failUploadsContaining(substr string, statusCode int) mockserver.Responder {
+	return func(u mockserver.Upload) mockserver.Response {
+		if strings.Contains(string(u.Payload), substr) {
+			return mockserver.Response{StatusCode: statusCode}
+		}
+		return mockserver.Response{}
+	}
+}
+
+// payloads returns the payloads of all uploads accepted by the server.
+func payloads(server *mockserver.Server) []string {
+	var payloads []string
+	for _, u := range server.Uploads() {
+		payloads = append(payloads, string(u.Payload))
+	}
+	return payloads
+}
+
+func testRecords(n int) []json.RawMessage {
+	records := make([]json.RawMessage, n)
+	for i := range records {
+		records[i] = json.RawMessage(`{"n":` + strings.Repeat("1", i+1) + `}`)
+	}
+	return records
+}
+
+func TestUploadRecordsSplitsByRecordCount(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.MaxRecordsPerRequest = 2
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	assert.NoError(t, fe.uploadRecords(context.Background(), testRecords(5), logTypeLogs).err())
+	assert.Equal(t, []string{
+		`[{"n":1},{"n":11}]`,
+		`[{"n":111},{"n":1111}]`,
+		`[{"n":11111}]`,
+	}, payloads(server))
+}
+
+func TestUploadRecordsSplitsByCompressedSize(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	// Barely enough for the gzip overhead of a single small record.
+	cfg.MaxBytesPerRequest = 40
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	assert.NoError(t, fe.uploadRecords(context.Background(), testRecords(4), logTypeLogs).err())
+	assert.Equal(t, []string{`[{"n":1}]`, `[{"n":11}]`, `[{"n":111}]`, `[{"n":1111}]`}, payloads(server))
+}
+
+func TestUploadRecordsOversizedRecordIsPermanent(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.MaxBytesPerRequest = 40
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	records := append(testRecords(1), json.RawMessage(`{"s":"`+strings.Repeat("abcdefghij", 20)+`"}`))
+	result := fe.uploadRecords(context.Background(), records, logTypeLogs)
+	assert.True(t, consumererror.IsPermanent(result.err()))
+	assert.Equal(t, []string{`[{"n":1}]`}, payloads(server))
+}
+
+func TestConsumeTracesRetriesOnlyFailedChunks(t *testing.T) {
+	server := newMockServer(t)
+	server.SetResponder(failUploadsContaining(`"name":"operationB"`, http.StatusServiceUnavailable))
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.MaxRecordsPerRequest = 1
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	err := fe.ConsumeTraces(context.Background(), testdata.GenerateTracesTwoSpansSameResource())
+	require.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+	var tracesErr consumererror.Traces
+	require.True(t, errors.As(err, &tracesErr))
+	failed := tracesErr.GetTraces()
+	require.Equal(t, 1, failed.SpanCount())
+	assert.Equal(t, "operationB", failed.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).Name())
+	assert.Equal(t, 2, server.Requests())
+}
+
+// newCumulativeSums returns a batch with a cumulative sum series per path, with the given values.
+func newCumulativeSums(ts pdata.Timestamp, values map[string]int64) pdata.Metrics {
+	md := pdata.NewMetrics()
+	m := md.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty().Metrics().AppendEmpty()
+	m.SetName("requests")
+	m.SetDataType(pdata.MetricDataTypeSum)
+	m.Sum().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+	m.Sum().SetIsMonotonic(true)
+	for _, path := range []string{"/a", "/b"} {
+		dp := m.Sum().DataPoints().AppendEmpty()
+		dp.SetStartTimestamp(testStartTime)
+		dp.SetTimestamp(ts)
+		dp.SetIntVal(values[path])
+		dp.Attributes().InsertString("path", path)
+	}
+	return md
+}
+
+func TestConsumeMetricsRetriesOnlyFailedChunks(t *testing.T) {
+	server := newMockServer(t)
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.MaxRecordsPerRequest = 1
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	// The first points are only used as baseline.
+	require.NoError(t, fe.ConsumeMetrics(context.Background(), newCumulativeSums(testTime1, map[string]int64{"/a": 10, "/b": 10})))
+	assert.Equal(t, 0, server.Requests())
+
+	server.SetResponder(failUploadsContaining(`"path":"/b"`, http.StatusServiceUnavailable))
+	err := fe.ConsumeMetrics(context.Background(), newCumulativeSums(testTime2, map[string]int64{"/a": 25, "/b": 40}))
+	require.Error(t, err)
+	assert.False(t, consumererror.IsPermanent(err))
+	var metricsErr consumererror.Metrics
+	require.True(t, errors.As(err, &metricsErr))
+	failed := metricsErr.GetMetrics()
+	require.Equal(t, 1, failed.DataPointCount())
+	path, _ := failed.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0).Attributes().Get("path")
+	assert.Equal(t, "/b", path.StringVal())
+
+	// The retry reports the delta of the failed series only, from its last uploaded point.
+	server.SetResponder(nil)
+	require.NoError(t, fe.ConsumeMetrics(context.Background(), failed))
+	uploaded := payloads(server)
+	require.Len(t, uploaded, 2)
+	assert.Contains(t, uploaded[0], `"path":"/a"`)
+	assert.Contains(t, uploaded[0], `"value":15`)
+	assert.Contains(t, uploaded[1], `"path":"/b"`)
+	assert.Contains(t, uploaded[1], `"value":30`)
+
+	// The next batch is computed from the uploaded points.
+	require.NoError(t, fe.ConsumeMetrics(context.Background(), newCumulativeSums(testTime3, map[string]int64{"/a": 26, "/b": 42})))
+	uploaded = payloads(server)
+	require.Len(t, uploaded, 4)
+	assert.Contains(t, uploaded[2], `"value":1`)
+	assert.Contains(t, uploaded[3], `"value":2`)
+}
+
+func TestConsumeLogsDropsRejectedChunks(t *testing.T) {
+	ld := testdata.GenerateLogsTwoLogRecordsSameResource()
+	rejected := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(1).Name()
+	server := newMockServer(t)
+	server.SetResponder(failUploadsContaining(rejected, http.StatusBadRequest))
+	cfg := newTestConfig(server.AppLogsURL())
+	cfg.MaxRecordsPerRequest = 1
+	fe := newTestExporter(t, cfg)
+	defer fe.Shutdown(context.Background())
+
+	err := fe.ConsumeLogs(context.Background(), ld)
+	assert.True(t, consumererror.IsPermanent(err))
+	assert.Equal(t, 2, server.Requests())
+}
+
+func TestConsumeLogsDropsRecordsThatCannotBeMarshaled(t *testing.T) {
+	ld := testdata.GenerateLogsTwoLogRecordsSameResource()
+	logs := ld.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs()
+	logs.At(0).Attributes().UpsertDouble("ratio", math.NaN())
+	server := newMockServer(t)
+	fe := newTestExporter(t, newTestConfig(server.AppLogsURL()))
+	defer fe.Shutdown(context.Background())
+
+	err := fe.ConsumeLogs(context.Background(), ld)
+	require.Error(t, err)
+	assert.True(t, consumererror.IsPermanent(err))
+	var logsErr consumererror.Logs
+	require.True(t, consumererror.AsLogs(err, &logsErr))
+	failed := logsErr.GetLogs()
+	require.Equal(t, 1, failed.LogRecordCount())
+	assert.Equal(t, logs.At(0).Name(), failed.ResourceLogs().At(0).InstrumentationLibraryLogs().At(0).Logs().At(0).Name())
+
+	uploaded := payloads(server)
+	require.Len(t, uploaded, 1)
+	assert.Contains(t, uploaded[0], logs.At(1).Name())
+	assert.NotContains(t, uploaded[0], `"ratio"`)
+}
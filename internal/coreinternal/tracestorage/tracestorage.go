@@ -0,0 +1,189 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tracestorage implements the layout of the traces kept by processors
+// in a storage extension, so that they survive a restart.
+//
+// Traces are numbered in order of arrival. The ID and arrival time of trace n
+// are stored under "trace_n" and its batches of spans under "batch_n_i". As
+// the storage clients can't list their keys, the range of numbers of the
+// traces that may still be stored is kept under the read and write index keys.
+package tracestorage
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/extension/storage"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+const (
+	// ReadIndexKey is the key of the number of the oldest trace that may still be stored.
+	ReadIndexKey = "ri"
+	// WriteIndexKey is the key of the number of the next trace to store.
+	WriteIndexKey = "wi"
+
+	traceEntryLen = 24
+)
+
+var (
+	// ErrNoStorageClient is returned when the host has no storage extension.
+	ErrNoStorageClient = errors.New("no storage client extension found")
+	// ErrMultipleStorageClients is returned when the host has more than one storage extension.
+	ErrMultipleStorageClients = errors.New("multiple storage extensions found")
+)
+
+// GetStorageClient returns a client of the only storage extension of the host for the processor.
+func GetStorageClient(ctx context.Context, host component.Host, id config.ComponentID) (storage.Client, error) {
+	var storageExtension storage.Extension
+	for _, ext := range host.GetExtensions() {
+		if se, ok := ext.(storage.Extension); ok {
+			if storageExtension != nil {
+				return nil, ErrMultipleStorageClients
+			}
+			storageExtension = se
+		}
+	}
+	if storageExtension == nil {
+		return nil, ErrNoStorageClient
+	}
+	return storageExtension.GetClient(ctx, component.KindProcessor, id, "")
+}
+
+// TraceKey returns the key of the ID and arrival time of trace n.
+func TraceKey(index uint64) string {
+	return fmt.Sprintf("trace_%d", index)
+}
+
+// BatchKey returns the key of the i-th batch of trace n.
+func BatchKey(index uint64, batch int) string {
+	return fmt.Sprintf("batch_%d_%d", index, batch)
+}
+
+// EncodeIndex encodes the value of the read or write index.
+func EncodeIndex(index uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, index)
+	return buf
+}
+
+// GetIndex reads the read or write index, which is zero when it isn't stored.
+func GetIndex(ctx context.Context, client storage.Client, key string) (uint64, error) {
+	buf, err := client.Get(ctx, key)
+	if err != nil || buf == nil {
+		return 0, err
+	}
+	if len(buf) != 8 {
+		return 0, fmt.Errorf("invalid %q index of length %d", key, len(buf))
+	}
+	return binary.BigEndian.Uint64(buf), nil
+}
+
+// AddTraceOperations returns the operations storing a new trace under the
+// given number, which moves the write index past it.
+func AddTraceOperations(index uint64, id pdata.TraceID, arrivalTime time.Time) []storage.Operation {
+	entry := make([]byte, traceEntryLen)
+	traceID := id.Bytes()
+	copy(entry, traceID[:])
+	binary.BigEndian.PutUint64(entry[16:], uint64(arrivalTime.UnixNano()))
+	return []storage.Operation{
+		storage.SetOperation(TraceKey(index), entry),
+		storage.SetOperation(WriteIndexKey, EncodeIndex(index+1)),
+	}
+}
+
+// DeleteTraceOperations returns the operations removing the trace stored
+// under the given number along with its batches.
+func DeleteTraceOperations(index uint64, batches int) []storage.Operation {
+	ops := make([]storage.Operation, 0, batches+1)
+	for i := 0; i < batches; i++ {
+		ops = append(ops, storage.DeleteOperation(BatchKey(index, i)))
+	}
+	return append(ops, storage.DeleteOperation(TraceKey(index)))
+}
+
+// StoredTrace is a trace found in the storage.
+type StoredTrace struct {
+	Index       uint64
+	ID          pdata.TraceID
+	ArrivalTime time.Time
+	Batches     int
+}
+
+// Restore returns the read and write indexes and the traces left in the
+// storage, in order of arrival. A trace ID is stored under a single number:
+// when it is found under several ones, only the latest arrival is kept and
+// the older ones are deleted from the storage.
+func Restore(ctx context.Context, client storage.Client) (readIndex, nextIndex uint64, traces []StoredTrace, err error) {
+	if readIndex, err = GetIndex(ctx, client, ReadIndexKey); err != nil {
+		return 0, 0, nil, err
+	}
+	if nextIndex, err = GetIndex(ctx, client, WriteIndexKey); err != nil {
+		return 0, 0, nil, err
+	}
+
+	var found []StoredTrace
+	latest := make(map[pdata.TraceID]StoredTrace)
+	for index := readIndex; index < nextIndex; index++ {
+		entry, err := client.Get(ctx, TraceKey(index))
+		if err != nil {
+			return 0, 0, nil, err
+		}
+		if entry == nil {
+			// The trace was already removed.
+			continue
+		}
+		if len(entry) != traceEntryLen {
+			return 0, 0, nil, fmt.Errorf("invalid stored trace %d of length %d", index, len(entry))
+		}
+		var id [16]byte
+		copy(id[:], entry[:16])
+		trace := StoredTrace{
+			Index:       index,
+			ID:          pdata.NewTraceID(id),
+			ArrivalTime: time.Unix(0, int64(binary.BigEndian.Uint64(entry[16:]))),
+		}
+
+		for ; ; trace.Batches++ {
+			buf, err := client.Get(ctx, BatchKey(index, trace.Batches))
+			if err != nil {
+				return 0, 0, nil, err
+			}
+			if buf == nil {
+				break
+			}
+		}
+
+		if stale, ok := latest[trace.ID]; ok {
+			if err := client.Batch(ctx, DeleteTraceOperations(stale.Index, stale.Batches)...); err != nil {
+				return 0, 0, nil, err
+			}
+		}
+		latest[trace.ID] = trace
+		found = append(found, trace)
+	}
+
+	for _, trace := range found {
+		if latest[trace.ID].Index == trace.Index {
+			traces = append(traces, trace)
+		}
+	}
+	return readIndex, nextIndex, traces, nil
+}
@@ -0,0 +1,166 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tracestorage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/extension/storage"
+	"go.opentelemetry.io/collector/model/pdata"
+)
+
+func TestRestore(t *testing.T) {
+	ctx := context.Background()
+	client := newMapClient()
+	firstID := pdata.NewTraceID([16]byte{1})
+	secondID := pdata.NewTraceID([16]byte{2})
+	arrival := time.Unix(1600000000, 0)
+
+	// trace 0 was removed, trace 3 repeats the ID of trace 1
+	require.NoError(t, client.Batch(ctx, AddTraceOperations(1, firstID, arrival)...))
+	require.NoError(t, client.Set(ctx, BatchKey(1, 0), []byte{1}))
+	require.NoError(t, client.Batch(ctx, AddTraceOperations(2, secondID, arrival)...))
+	require.NoError(t, client.Set(ctx, BatchKey(2, 0), []byte{1}))
+	require.NoError(t, client.Set(ctx, BatchKey(2, 1), []byte{1}))
+	require.NoError(t, client.Batch(ctx, AddTraceOperations(3, firstID, arrival.Add(time.Second))...))
+	require.NoError(t, client.Set(ctx, BatchKey(3, 0), []byte{1}))
+
+	// test
+	readIndex, nextIndex, traces, err := Restore(ctx, client)
+
+	// verify
+	require.NoError(t, err)
+	assert.Equal(t, uint64(0), readIndex)
+	assert.Equal(t, uint64(4), nextIndex)
+	assert.Equal(t, []StoredTrace{
+		{Index: 2, ID: secondID, ArrivalTime: arrival, Batches: 2},
+		{Index: 3, ID: firstID, ArrivalTime: arrival.Add(time.Second), Batches: 1},
+	}, traces)
+	assert.NotContains(t, client.data, TraceKey(1), "the older arrival of the trace should be deleted")
+	assert.NotContains(t, client.data, BatchKey(1, 0))
+}
+
+func TestRestoreInvalidEntries(t *testing.T) {
+	ctx := context.Background()
+
+	client := newMapClient()
+	require.NoError(t, client.Set(ctx, WriteIndexKey, []byte{1}))
+	_, _, _, err := Restore(ctx, client)
+	assert.EqualError(t, err, `invalid "wi" index of length 1`)
+
+	client = newMapClient()
+	require.NoError(t, client.Set(ctx, WriteIndexKey, EncodeIndex(1)))
+	require.NoError(t, client.Set(ctx, TraceKey(0), []byte{1}))
+	_, _, _, err = Restore(ctx, client)
+	assert.EqualError(t, err, "invalid stored trace 0 of length 1")
+}
+
+func TestGetStorageClient(t *testing.T) {
+	id := config.NewID("processor")
+	client := newMapClient()
+
+	_, err := GetStorageClient(context.Background(), newStorageHost(), id)
+	assert.ErrorIs(t, err, ErrNoStorageClient)
+
+	_, err = GetStorageClient(context.Background(), newStorageHost(client, client), id)
+	assert.ErrorIs(t, err, ErrMultipleStorageClients)
+
+	got, err := GetStorageClient(context.Background(), newStorageHost(client), id)
+	require.NoError(t, err)
+	assert.Same(t, client, got)
+}
+
+type mapClient struct {
+	data map[string][]byte
+}
+
+func newMapClient() *mapClient {
+	return &mapClient{data: make(map[string][]byte)}
+}
+
+func (c *mapClient) Get(_ context.Context, key string) ([]byte, error) {
+	return c.data[key], nil
+}
+
+func (c *mapClient) Set(_ context.Context, key string, value []byte) error {
+	c.data[key] = value
+	return nil
+}
+
+func (c *mapClient) Delete(_ context.Context, key string) error {
+	delete(c.data, key)
+	return nil
+}
+
+func (c *mapClient) Batch(ctx context.Context, ops ...storage.Operation) error {
+	for _, op := range ops {
+		switch op.Type {
+		case storage.Get:
+			op.Value, _ = c.Get(ctx, op.Key)
+		case storage.Set:
+			_ = c.Set(ctx, op.Key, op.Value)
+		case storage.Delete:
+			_ = c.Delete(ctx, op.Key)
+		}
+	}
+	return nil
+}
+
+func (c *mapClient) Close(context.Context) error {
+	return nil
+}
+
+type mapStorageExtension struct {
+	client *mapClient
+}
+
+func (e *mapStorageExtension) Start(context.Context, component.Host) error {
+	return nil
+}
+
+func (e *mapStorageExtension) Shutdown(context.Context) error {
+	return nil
+}
+
+func (e *mapStorageExtension) GetClient(context.Context, component.Kind, config.ComponentID, string) (storage.Client, error) {
+	return e.client, nil
+}
+
+type storageHost struct {
+	component.Host
+	extensions map[config.ComponentID]component.Extension
+}
+
+func (h storageHost) GetExtensions() map[config.ComponentID]component.Extension {
+	return h.extensions
+}
+
+func newStorageHost(clients ...*mapClient) component.Host {
+	h := storageHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: make(map[config.ComponentID]component.Extension),
+	}
+	for i, client := range clients {
+		h.extensions[config.NewIDWithName("map_storage", string(rune('a'+i)))] = &mapStorageExtension{client: client}
+	}
+	return h
+}
@@ -36,15 +36,30 @@ type Config struct {
 	// Default: 1s.
 	WaitDuration time.Duration `mapstructure:"wait_duration"`
 
-	// DiscardOrphans instructs the processor to discard traces without the root span.
+	// IdleDuration enables the early release of the traces whose root span was received: such a trace is
+	// released once no spans were received for it for this duration, instead of waiting for WaitDuration.
+	// Default: 0, disabled.
+	IdleDuration time.Duration `mapstructure:"idle_duration"`
+
+	// SpanCountAttribute is the name of an integer span attribute holding the number of spans of the trace,
+	// set by the services knowing it in advance. A trace is released as soon as this number of spans is received.
+	// Default: "", disabled.
+	SpanCountAttribute string `mapstructure:"span_count_attribute"`
+
+	// DiscardOrphans instructs the processor to discard traces with orphan spans, i.e. spans whose parent
+	// span wasn't received within the wait duration, such as traces without the root span.
 	// This typically indicates that the trace is incomplete.
 	// Default: false.
-	// Not yet implemented, and an error will be returned when this option is used.
 	DiscardOrphans bool `mapstructure:"discard_orphans"`
 
+	// MarkOrphans tells the processor to set the "groupbytrace.orphan" attribute on the orphan spans
+	// of the traces it releases. It has no effect when DiscardOrphans is set.
+	// Default: false.
+	MarkOrphans bool `mapstructure:"mark_orphans"`
+
 	// StoreOnDisk tells the processor to keep only the trace ID in memory, serializing the trace spans to disk.
-	// Useful when the duration to wait for traces to complete is high.
+	// Useful when the duration to wait for traces to complete is high. The spans are kept by the storage
+	// extension of the collector, of which there must be exactly one, and survive restarts.
 	// Default: false.
-	// Not yet implemented, and an error will be returned when this option is used.
 	StoreOnDisk bool `mapstructure:"store_on_disk"`
 }
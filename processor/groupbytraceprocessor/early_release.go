@@ -0,0 +1,211 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groupbytraceprocessor
+
+import (
+	"context"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// Reasons for releasing a trace before the wait duration.
+const (
+	earlyReleaseIdle      = "idle"
+	earlyReleaseSpanCount = "span_count"
+)
+
+// traceProgress tracks how complete an in-flight trace is, so that it can be
+// released before the wait duration. It's only accessed by the worker of the trace.
+type traceProgress struct {
+	spans         int64
+	expectedSpans int64
+	rootReceived  bool
+	lastReceived  time.Time
+
+	// release fires the expiration of the trace after the wait duration
+	release *time.Timer
+	// idle fires the idle event of the trace once it has the root span
+	idle *time.Timer
+}
+
+func (p *traceProgress) stop() {
+	if p.release != nil {
+		p.release.Stop()
+	}
+	if p.idle != nil {
+		p.idle.Stop()
+	}
+}
+
+func (sp *groupByTraceProcessor) earlyReleaseEnabled() bool {
+	return sp.config.IdleDuration > 0 || sp.config.SpanCountAttribute != ""
+}
+
+// updateProgress accounts the spans received for the trace, releasing it
+// right away when its expected number of spans is reached, or arming its idle
+// timer once its root span was received.
+func (sp *groupByTraceProcessor) updateProgress(traceID pdata.TraceID, td pdata.Traces, worker *eventMachineWorker) {
+	progress, ok := worker.progress[traceID]
+	if !ok {
+		return
+	}
+
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		ilss := rss.At(i).InstrumentationLibrarySpans()
+		for j := 0; j < ilss.Len(); j++ {
+			spans := ilss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				progress.spans++
+				if span.ParentSpanID().IsEmpty() {
+					progress.rootReceived = true
+				}
+				if sp.config.SpanCountAttribute == "" {
+					continue
+				}
+				if attr, ok := span.Attributes().Get(sp.config.SpanCountAttribute); ok && attr.Type() == pdata.AttributeValueTypeInt {
+					if attr.IntVal() > progress.expectedSpans {
+						progress.expectedSpans = attr.IntVal()
+					}
+				}
+			}
+		}
+	}
+	progress.lastReceived = time.Now()
+
+	if progress.expectedSpans > 0 && progress.spans >= progress.expectedSpans {
+		sp.releaseEarly(traceID, earlyReleaseSpanCount, worker)
+		return
+	}
+
+	if !progress.rootReceived || sp.config.IdleDuration <= 0 {
+		return
+	}
+	if progress.idle == nil {
+		progress.idle = time.AfterFunc(sp.config.IdleDuration, func() {
+			// if the event machine has stopped, it will just discard the event
+			worker.fire(event{
+				typ:     traceIdle,
+				payload: traceID,
+			})
+		})
+	} else {
+		progress.idle.Reset(sp.config.IdleDuration)
+	}
+}
+
+// onTraceIdle releases the trace if no spans were received for it during the idle duration.
+func (sp *groupByTraceProcessor) onTraceIdle(traceID pdata.TraceID, worker *eventMachineWorker) error {
+	progress, ok := worker.progress[traceID]
+	if !ok {
+		// the trace was released already
+		return nil
+	}
+
+	if time.Since(progress.lastReceived) < sp.config.IdleDuration {
+		// spans were received since the timer fired, and it has been reset
+		return nil
+	}
+
+	sp.releaseEarly(traceID, earlyReleaseIdle, worker)
+	return nil
+}
+
+func (sp *groupByTraceProcessor) releaseEarly(traceID pdata.TraceID, reason string, worker *eventMachineWorker) {
+	sp.logger.Debug("releasing complete trace early",
+		zap.String("traceID", traceID.HexString()), zap.String("reason", reason))
+
+	now := time.Now()
+	worker.released.add(traceID, now.Add(sp.config.WaitDuration), now)
+
+	_ = stats.RecordWithTags(
+		context.Background(),
+		[]tag.Mutator{tag.Upsert(tagReasonKey, reason)},
+		mEarlyReleases.M(1),
+	)
+	_ = sp.onTraceExpired(traceID, worker)
+}
+
+// forgetProgress stops tracking the progress of a trace that is no longer in-flight.
+func (sp *groupByTraceProcessor) forgetProgress(traceID pdata.TraceID, worker *eventMachineWorker) {
+	if progress, ok := worker.progress[traceID]; ok {
+		progress.stop()
+		delete(worker.progress, traceID)
+	}
+}
+
+// forwardLateSpans releases the spans received for a trace released early
+// right away: grouped on their own, they would lack the root span of the
+// trace, and be deemed orphans.
+func (sp *groupByTraceProcessor) forwardLateSpans(traceID pdata.TraceID, td pdata.Traces) {
+	sp.logger.Debug("forwarding late spans of trace released early",
+		zap.String("traceID", traceID.HexString()))
+
+	stats.Record(context.Background(),
+		mLateSpans.M(int64(td.SpanCount())),
+		mReleasedSpans.M(int64(td.SpanCount())),
+	)
+
+	// Do async consuming not to block event worker
+	go func() {
+		if err := sp.nextConsumer.ConsumeTraces(context.Background(), td); err != nil {
+			sp.logger.Error("consume failed", zap.Error(err))
+		}
+	}()
+}
+
+// releasedTraces remembers the traces released early until their wait
+// duration is over, in the order they were released. It's only accessed by
+// the worker of the traces.
+type releasedTraces struct {
+	expiries map[pdata.TraceID]time.Time
+	order    []pdata.TraceID
+}
+
+func newReleasedTraces() *releasedTraces {
+	return &releasedTraces{expiries: make(map[pdata.TraceID]time.Time)}
+}
+
+// add remembers the trace until the given expiry.
+func (r *releasedTraces) add(traceID pdata.TraceID, expiry time.Time, now time.Time) {
+	r.prune(now)
+	r.expiries[traceID] = expiry
+	r.order = append(r.order, traceID)
+}
+
+// contains returns whether the trace was released early and its wait duration isn't over.
+func (r *releasedTraces) contains(traceID pdata.TraceID, now time.Time) bool {
+	r.prune(now)
+	expiry, ok := r.expiries[traceID]
+	return ok && expiry.After(now)
+}
+
+// prune forgets the traces whose wait duration is over. The wait duration is
+// the same for all the traces, so they expire in the order they were released.
+func (r *releasedTraces) prune(now time.Time) {
+	for len(r.order) > 0 {
+		traceID := r.order[0]
+		if r.expiries[traceID].After(now) {
+			return
+		}
+		delete(r.expiries, traceID)
+		r.order = r.order[1:]
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groupbytraceprocessor
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestTraceIsReleasedWhenSpanCountIsReached(t *testing.T) {
+	// prepare
+	var spansReleased int64
+	config := Config{
+		WaitDuration:       time.Hour,
+		NumTraces:          8,
+		NumWorkers:         4,
+		SpanCountAttribute: "trace.span_count",
+	}
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			atomic.AddInt64(&spansReleased, int64(received.SpanCount()))
+			return nil
+		},
+	}
+	st := newMemoryStorage()
+	p := newGroupByTraceProcessor(zap.NewNop(), st, next, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, nil))
+	defer p.Shutdown(ctx)
+
+	root := tracesWithSpans(testSpan{service: "frontend", id: 1})
+	root.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).Attributes().InsertInt("trace.span_count", 3)
+
+	// test
+	require.NoError(t, p.ConsumeTraces(ctx, root))
+	require.NoError(t, p.ConsumeTraces(ctx, tracesWithSpans(testSpan{service: "backend", id: 2, parent: 1})))
+
+	// verify
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&spansReleased), "the trace shouldn't be released before all its spans are received")
+
+	// test
+	require.NoError(t, p.ConsumeTraces(ctx, tracesWithSpans(testSpan{service: "backend", id: 3, parent: 2})))
+
+	// verify
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&spansReleased) == 3 && st.count() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTraceIsReleasedWhenIdle(t *testing.T) {
+	// prepare
+	var spansReleased int64
+	config := Config{
+		WaitDuration: time.Hour,
+		NumTraces:    8,
+		NumWorkers:   4,
+		IdleDuration: 20 * time.Millisecond,
+	}
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			atomic.AddInt64(&spansReleased, int64(received.SpanCount()))
+			return nil
+		},
+	}
+	p := newGroupByTraceProcessor(zap.NewNop(), newMemoryStorage(), next, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, nil))
+	defer p.Shutdown(ctx)
+
+	// test
+	require.NoError(t, p.ConsumeTraces(ctx, tracesWithSpans(
+		testSpan{service: "frontend", id: 1},
+		testSpan{service: "backend", id: 2, parent: 1},
+	)))
+
+	// verify
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&spansReleased) == 2
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestTraceWithoutRootIsNotReleasedWhenIdle(t *testing.T) {
+	// prepare
+	var spansReleased int64
+	config := Config{
+		WaitDuration: time.Hour,
+		NumTraces:    8,
+		NumWorkers:   4,
+		IdleDuration: time.Millisecond,
+	}
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			atomic.AddInt64(&spansReleased, int64(received.SpanCount()))
+			return nil
+		},
+	}
+	st := newMemoryStorage()
+	p := newGroupByTraceProcessor(zap.NewNop(), st, next, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, nil))
+	defer p.Shutdown(ctx)
+
+	// test
+	require.NoError(t, p.ConsumeTraces(ctx, tracesWithSpans(testSpan{service: "backend", id: 2, parent: 1})))
+
+	// verify
+	time.Sleep(50 * time.Millisecond)
+	assert.Equal(t, int64(0), atomic.LoadInt64(&spansReleased))
+	assert.Equal(t, 1, st.count())
+}
+
+func TestIdleTimerIsResetBySpans(t *testing.T) {
+	// prepare
+	config := Config{
+		WaitDuration: time.Hour,
+		NumTraces:    8,
+		NumWorkers:   1,
+		IdleDuration: time.Hour,
+	}
+	p := newGroupByTraceProcessor(zap.NewNop(), newMemoryStorage(), &mockProcessor{}, config)
+	worker := p.eventMachine.workers[0]
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+
+	require.NoError(t, p.onTraceReceived(tracesWithID{id: traceID, td: tracesWithSpans(testSpan{service: "frontend", id: 1})}, worker))
+	progress := worker.progress[traceID]
+	require.NotNil(t, progress)
+	defer progress.stop()
+
+	// test
+	require.NoError(t, p.onTraceIdle(traceID, worker))
+
+	// verify
+	assert.True(t, worker.buffer.contains(traceID), "spans were received within the idle duration")
+	assert.Equal(t, int64(1), progress.spans)
+	assert.True(t, progress.rootReceived)
+	assert.NotNil(t, progress.idle)
+}
+
+func TestLateSpansOfTraceReleasedEarlyAreForwarded(t *testing.T) {
+	// prepare
+	var spansReleased int64
+	config := Config{
+		WaitDuration:       time.Hour,
+		NumTraces:          8,
+		NumWorkers:         4,
+		SpanCountAttribute: "trace.span_count",
+		DiscardOrphans:     true,
+	}
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			atomic.AddInt64(&spansReleased, int64(received.SpanCount()))
+			return nil
+		},
+	}
+	st := newMemoryStorage()
+	p := newGroupByTraceProcessor(zap.NewNop(), st, next, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, nil))
+	defer p.Shutdown(ctx)
+
+	root := tracesWithSpans(testSpan{service: "frontend", id: 1}, testSpan{service: "backend", id: 2, parent: 1})
+	root.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).Attributes().InsertInt("trace.span_count", 2)
+	require.NoError(t, p.ConsumeTraces(ctx, root))
+	require.Eventually(t, func() bool {
+		return atomic.LoadInt64(&spansReleased) == 2 && st.count() == 0
+	}, time.Second, 10*time.Millisecond)
+
+	// test: the span count was wrong, a span arrives after the trace was released
+	require.NoError(t, p.ConsumeTraces(ctx, tracesWithSpans(testSpan{service: "backend", id: 3, parent: 2})))
+
+	// verify
+	assert.Eventually(t, func() bool {
+		return atomic.LoadInt64(&spansReleased) == 3
+	}, time.Second, 10*time.Millisecond, "the late span shouldn't be discarded as an orphan")
+	assert.Equal(t, 0, st.count(), "the late span shouldn't wait for the wait duration")
+}
+
+func TestReleasedTracesExpire(t *testing.T) {
+	// prepare
+	r := newReleasedTraces()
+	now := time.Now()
+	traceID1 := pdata.NewTraceID([16]byte{1})
+	traceID2 := pdata.NewTraceID([16]byte{2})
+
+	// test
+	r.add(traceID1, now.Add(time.Second), now)
+	r.add(traceID2, now.Add(2*time.Second), now.Add(time.Millisecond))
+
+	// verify
+	assert.True(t, r.contains(traceID1, now))
+	assert.False(t, r.contains(pdata.NewTraceID([16]byte{3}), now))
+	assert.False(t, r.contains(traceID1, now.Add(time.Second)))
+	assert.True(t, r.contains(traceID2, now.Add(time.Second)))
+	assert.Len(t, r.expiries, 1, "the expired trace should be forgotten")
+	assert.False(t, r.contains(traceID2, now.Add(2*time.Second)))
+	assert.Empty(t, r.order)
+}
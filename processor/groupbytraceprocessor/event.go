@@ -40,6 +40,12 @@ const (
 
 	// traceID to be removed
 	traceRemoved
+
+	// traces found in the storage on start
+	traceRestored
+
+	// traceID without new spans for the idle duration
+	traceIdle
 )
 
 var (
@@ -67,6 +73,12 @@ type tracesWithID struct {
 	td pdata.Traces
 }
 
+type restoredTrace struct {
+	id pdata.TraceID
+	// arrival is the time the first spans of the trace were received
+	arrival time.Time
+}
+
 // eventMachine is a machine that accepts events in a typically non-blocking manner,
 // processing the events serially per worker scope, to ensure that data at the consumer is consistent.
 // Just like the machine itself is non-blocking, consumers are expected to also not block
@@ -84,6 +96,8 @@ type eventMachine struct {
 	onTraceExpired  func(traceID pdata.TraceID, worker *eventMachineWorker) error
 	onTraceReleased func(rss []pdata.ResourceSpans) error
 	onTraceRemoved  func(traceID pdata.TraceID) error
+	onTraceRestored func(trace restoredTrace, worker *eventMachineWorker) error
+	onTraceIdle     func(traceID pdata.TraceID, worker *eventMachineWorker) error
 
 	onError func(event)
 
@@ -103,9 +117,11 @@ func newEventMachine(logger *zap.Logger, bufferSize int, numWorkers int, numTrac
 	}
 	for i := range em.workers {
 		em.workers[i] = &eventMachineWorker{
-			machine: em,
-			buffer:  newRingBuffer(numTraces / numWorkers),
-			events:  make(chan event, bufferSize/numWorkers),
+			machine:  em,
+			buffer:   newRingBuffer(numTraces / numWorkers),
+			progress: make(map[pdata.TraceID]*traceProgress),
+			released: newReleasedTraces(),
+			events:   make(chan event, bufferSize/numWorkers),
 		}
 	}
 	return em
@@ -213,6 +229,38 @@ func (em *eventMachine) handleEvent(e event, w *eventMachineWorker) {
 		em.handleEventWithObservability("onTraceRemoved", func() error {
 			return em.onTraceRemoved(payload)
 		})
+	case traceRestored:
+		if em.onTraceRestored == nil {
+			em.logger.Debug("onTraceRestored not set, skipping event")
+			em.callOnError(e)
+			return
+		}
+		payload, ok := e.payload.(restoredTrace)
+		if !ok {
+			// the payload had an unexpected type!
+			em.callOnError(e)
+			return
+		}
+
+		em.handleEventWithObservability("onTraceRestored", func() error {
+			return em.onTraceRestored(payload, w)
+		})
+	case traceIdle:
+		if em.onTraceIdle == nil {
+			em.logger.Debug("onTraceIdle not set, skipping event")
+			em.callOnError(e)
+			return
+		}
+		payload, ok := e.payload.(pdata.TraceID)
+		if !ok {
+			// the payload had an unexpected type!
+			em.callOnError(e)
+			return
+		}
+
+		em.handleEventWithObservability("onTraceIdle", func() error {
+			return em.onTraceIdle(payload, w)
+		})
 	default:
 		em.logger.Info("unknown event type", zap.Any("event", e.typ))
 		em.callOnError(e)
@@ -227,18 +275,29 @@ func (em *eventMachine) consume(td pdata.Traces) error {
 		return fmt.Errorf("eventmachine consume failed: %w", err)
 	}
 
+	em.workerForTraceID(traceID).fire(event{
+		typ:     traceReceived,
+		payload: tracesWithID{id: traceID, td: td},
+	})
+	return nil
+}
+
+// restore routes a trace found in the storage to the worker it belongs to.
+func (em *eventMachine) restore(trace restoredTrace) {
+	em.workerForTraceID(trace.id).fire(event{
+		typ:     traceRestored,
+		payload: trace,
+	})
+}
+
+func (em *eventMachine) workerForTraceID(traceID pdata.TraceID) *eventMachineWorker {
 	var bucket uint64
 	if len(em.workers) != 1 {
 		bucket = workerIndexForTraceID(traceID, len(em.workers))
 	}
 
 	em.logger.Debug("scheduled trace to worker", zap.Uint64("id", bucket))
-
-	em.workers[bucket].fire(event{
-		typ:     traceReceived,
-		payload: tracesWithID{id: traceID, td: td},
-	})
-	return nil
+	return em.workers[bucket]
 }
 
 func workerIndexForTraceID(traceID pdata.TraceID, numWorkers int) uint64 {
@@ -317,6 +376,12 @@ type eventMachineWorker struct {
 	// the ring buffer holds the IDs for all the in-flight traces
 	buffer *ringBuffer
 
+	// progress holds the completeness state of the in-flight traces, when early release is enabled
+	progress map[pdata.TraceID]*traceProgress
+
+	// released holds the traces released early until their wait duration is over
+	released *releasedTraces
+
 	events chan event
 }
 
@@ -83,6 +83,18 @@ func TestEventCallback(t *testing.T) {
 				}
 			},
 		},
+		{
+			casename: "onTraceIdle",
+			typ:      traceIdle,
+			payload:  pdata.NewTraceID([16]byte{1, 2, 3, 4}),
+			registerCallback: func(em *eventMachine, wg *sync.WaitGroup) {
+				em.onTraceIdle = func(idle pdata.TraceID, worker *eventMachineWorker) error {
+					wg.Done()
+					assert.Equal(t, pdata.NewTraceID([16]byte{1, 2, 3, 4}), idle)
+					return nil
+				}
+			},
+		},
 	} {
 		t.Run(tt.casename, func(t *testing.T) {
 			// prepare
@@ -130,6 +142,10 @@ func TestEventCallbackNotSet(t *testing.T) {
 			casename: "onTraceRemoved",
 			typ:      traceRemoved,
 		},
+		{
+			casename: "onTraceIdle",
+			typ:      traceIdle,
+		},
 	} {
 		t.Run(tt.casename, func(t *testing.T) {
 			// prepare
@@ -198,6 +214,15 @@ func TestEventInvalidPayload(t *testing.T) {
 				}
 			},
 		},
+		{
+			casename: "onTraceIdle",
+			typ:      traceIdle,
+			registerCallback: func(em *eventMachine, wg *sync.WaitGroup) {
+				em.onTraceIdle = func(idle pdata.TraceID, worker *eventMachineWorker) error {
+					return nil
+				}
+			},
+		},
 	} {
 		t.Run(tt.casename, func(t *testing.T) {
 			// prepare
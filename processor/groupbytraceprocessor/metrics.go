@@ -25,13 +25,24 @@ var (
 	mNumTracesConf      = stats.Int64("processor_groupbytrace_conf_num_traces", "Maximum number of traces to hold in the internal storage", stats.UnitDimensionless)
 	mNumEventsInQueue   = stats.Int64("processor_groupbytrace_num_events_in_queue", "Number of events currently in the queue", stats.UnitDimensionless)
 	mNumTracesInMemory  = stats.Int64("processor_groupbytrace_num_traces_in_memory", "Number of traces currently in the in-memory storage", stats.UnitDimensionless)
+	mNumTracesOnDisk    = stats.Int64("processor_groupbytrace_num_traces_on_disk", "Number of traces currently in the on-disk storage", stats.UnitDimensionless)
 	mTracesEvicted      = stats.Int64("processor_groupbytrace_traces_evicted", "Traces evicted from the internal buffer", stats.UnitDimensionless)
 	mReleasedSpans      = stats.Int64("processor_groupbytrace_spans_released", "Spans released to the next consumer", stats.UnitDimensionless)
 	mReleasedTraces     = stats.Int64("processor_groupbytrace_traces_released", "Traces released to the next consumer", stats.UnitDimensionless)
+	mEarlyReleases      = stats.Int64("processor_groupbytrace_traces_released_early", "Traces released before the wait duration as they were deemed complete", stats.UnitDimensionless)
+	mLateSpans          = stats.Int64("processor_groupbytrace_late_spans", "Spans of traces released early forwarded as they arrived", stats.UnitDimensionless)
 	mIncompleteReleases = stats.Int64("processor_groupbytrace_incomplete_releases", "Releases that are suspected to have been incomplete", stats.UnitDimensionless)
+	mOrphanTraces       = stats.Int64("processor_groupbytrace_orphan_traces", "Traces with spans whose parent span wasn't received", stats.UnitDimensionless)
+	mOrphanSpans        = stats.Int64("processor_groupbytrace_orphan_spans", "Spans whose parent span wasn't received", stats.UnitDimensionless)
+	mServiceSpans       = stats.Int64("processor_groupbytrace_service_spans", "Spans of the traces released or discarded", stats.UnitDimensionless)
 	mEventLatency       = stats.Int64("processor_groupbytrace_event_latency", "How long the queue events are taking to be processed", stats.UnitMilliseconds)
 )
 
+var (
+	tagServiceKey = tag.MustNewKey("service")
+	tagReasonKey  = tag.MustNewKey("reason")
+)
+
 // MetricViews return the metrics views according to given telemetry level.
 func MetricViews() []*view.View {
 	return []*view.View{
@@ -53,6 +64,12 @@ func MetricViews() []*view.View {
 			Description: mNumTracesInMemory.Description(),
 			Aggregation: view.LastValue(),
 		},
+		{
+			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mNumTracesOnDisk.Name()),
+			Measure:     mNumTracesOnDisk,
+			Description: mNumTracesOnDisk.Description(),
+			Aggregation: view.LastValue(),
+		},
 		{
 			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mTracesEvicted.Name()),
 			Measure:     mTracesEvicted,
@@ -72,12 +89,45 @@ func MetricViews() []*view.View {
 			Description: mReleasedTraces.Description(),
 			Aggregation: view.Sum(),
 		},
+		{
+			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mEarlyReleases.Name()),
+			Measure:     mEarlyReleases,
+			Description: mEarlyReleases.Description(),
+			TagKeys:     []tag.Key{tagReasonKey},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mLateSpans.Name()),
+			Measure:     mLateSpans,
+			Description: mLateSpans.Description(),
+			Aggregation: view.Sum(),
+		},
 		{
 			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mIncompleteReleases.Name()),
 			Measure:     mIncompleteReleases,
 			Description: mIncompleteReleases.Description(),
 			Aggregation: view.Sum(),
 		},
+		{
+			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mOrphanTraces.Name()),
+			Measure:     mOrphanTraces,
+			Description: mOrphanTraces.Description(),
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mOrphanSpans.Name()),
+			Measure:     mOrphanSpans,
+			Description: mOrphanSpans.Description(),
+			TagKeys:     []tag.Key{tagServiceKey},
+			Aggregation: view.Sum(),
+		},
+		{
+			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mServiceSpans.Name()),
+			Measure:     mServiceSpans,
+			Description: mServiceSpans.Description(),
+			TagKeys:     []tag.Key{tagServiceKey},
+			Aggregation: view.Sum(),
+		},
 		{
 			Name:        obsreport.BuildProcessorCustomMetricName(string(typeStr), mEventLatency.Name()),
 			Measure:     mEventLatency,
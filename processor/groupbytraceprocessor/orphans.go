@@ -0,0 +1,103 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groupbytraceprocessor
+
+import (
+	"context"
+
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/model/pdata"
+	conventions "go.opentelemetry.io/collector/model/semconv/v1.5.0"
+)
+
+// orphanAttributeKey is set on the orphan spans of released traces when mark_orphans is set.
+const orphanAttributeKey = "groupbytrace.orphan"
+
+// serviceSpans counts the spans of a service in a trace.
+type serviceSpans struct {
+	spans   int64
+	orphans int64
+}
+
+// findOrphans returns the spans of the trace whose parent span isn't part of
+// it, i.e. didn't arrive within the wait duration, along with the number of
+// spans and orphans of each service.
+func findOrphans(td pdata.Traces) ([]pdata.Span, map[string]*serviceSpans) {
+	spanIDs := make(map[pdata.SpanID]struct{})
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		ilss := rss.At(i).InstrumentationLibrarySpans()
+		for j := 0; j < ilss.Len(); j++ {
+			spans := ilss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				spanIDs[spans.At(k).SpanID()] = struct{}{}
+			}
+		}
+	}
+
+	var orphans []pdata.Span
+	services := make(map[string]*serviceSpans)
+	for i := 0; i < rss.Len(); i++ {
+		rs := rss.At(i)
+		service := serviceName(rs.Resource())
+		counts, ok := services[service]
+		if !ok {
+			counts = &serviceSpans{}
+			services[service] = counts
+		}
+
+		ilss := rs.InstrumentationLibrarySpans()
+		for j := 0; j < ilss.Len(); j++ {
+			spans := ilss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				counts.spans++
+				parentID := span.ParentSpanID()
+				if parentID.IsEmpty() {
+					continue
+				}
+				if _, ok := spanIDs[parentID]; !ok {
+					counts.orphans++
+					orphans = append(orphans, span)
+				}
+			}
+		}
+	}
+	return orphans, services
+}
+
+func serviceName(resource pdata.Resource) string {
+	if attr, ok := resource.Attributes().Get(conventions.AttributeServiceName); ok {
+		return attr.StringVal()
+	}
+	return ""
+}
+
+// recordOrphans records the number of spans and orphans per service, from
+// which the orphan rate of each service can be derived.
+func recordOrphans(orphans []pdata.Span, services map[string]*serviceSpans) {
+	if len(orphans) > 0 {
+		stats.Record(context.Background(), mOrphanTraces.M(1))
+	}
+	for service, counts := range services {
+		_ = stats.RecordWithTags(
+			context.Background(),
+			[]tag.Mutator{tag.Upsert(tagServiceKey, service)},
+			mServiceSpans.M(counts.spans),
+			mOrphanSpans.M(counts.orphans),
+		)
+	}
+}
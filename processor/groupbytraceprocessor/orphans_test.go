@@ -0,0 +1,198 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groupbytraceprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	conventions "go.opentelemetry.io/collector/model/semconv/v1.5.0"
+	"go.uber.org/zap"
+)
+
+func TestFindOrphans(t *testing.T) {
+	for _, tt := range []struct {
+		name             string
+		spans            []testSpan
+		expectedOrphans  []byte
+		expectedServices map[string]*serviceSpans
+	}{
+		{
+			name: "complete trace",
+			spans: []testSpan{
+				{service: "frontend", id: 1},
+				{service: "frontend", id: 2, parent: 1},
+				{service: "backend", id: 3, parent: 2},
+			},
+			expectedServices: map[string]*serviceSpans{
+				"frontend": {spans: 2},
+				"backend":  {spans: 1},
+			},
+		},
+		{
+			name: "missing root span",
+			spans: []testSpan{
+				{service: "frontend", id: 2, parent: 1},
+				{service: "backend", id: 3, parent: 2},
+			},
+			expectedOrphans: []byte{2},
+			expectedServices: map[string]*serviceSpans{
+				"frontend": {spans: 1, orphans: 1},
+				"backend":  {spans: 1},
+			},
+		},
+		{
+			name: "missing intermediate span",
+			spans: []testSpan{
+				{service: "frontend", id: 1},
+				{service: "backend", id: 3, parent: 2},
+				{service: "backend", id: 4, parent: 3},
+				{service: "backend", id: 5, parent: 2},
+			},
+			expectedOrphans: []byte{3, 5},
+			expectedServices: map[string]*serviceSpans{
+				"frontend": {spans: 1},
+				"backend":  {spans: 3, orphans: 2},
+			},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			// test
+			orphans, services := findOrphans(tracesWithSpans(tt.spans...))
+
+			// verify
+			var orphanIDs []byte
+			for _, span := range orphans {
+				id := span.SpanID().Bytes()
+				orphanIDs = append(orphanIDs, id[0])
+			}
+			assert.Equal(t, tt.expectedOrphans, orphanIDs)
+			assert.Equal(t, tt.expectedServices, services)
+		})
+	}
+}
+
+func TestOrphanTraceIsDiscarded(t *testing.T) {
+	// prepare
+	wg := &sync.WaitGroup{}
+	config := Config{
+		WaitDuration:   time.Nanosecond,
+		NumTraces:      8,
+		NumWorkers:     4,
+		DiscardOrphans: true,
+	}
+	complete := tracesWithSpans(testSpan{service: "frontend", id: 1}, testSpan{service: "backend", id: 2, parent: 1})
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			assert.Equal(t, complete, received)
+			wg.Done()
+			return nil
+		},
+	}
+	st := newMemoryStorage()
+	p := newGroupByTraceProcessor(zap.NewNop(), st, next, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, nil))
+	defer p.Shutdown(ctx)
+
+	orphan := tracesWithSpans(testSpan{service: "backend", id: 2, parent: 1})
+	orphan.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).SetTraceID(pdata.NewTraceID([16]byte{2}))
+
+	// test
+	wg.Add(1)
+	require.NoError(t, p.ConsumeTraces(ctx, orphan))
+	require.NoError(t, p.ConsumeTraces(ctx, complete))
+
+	// verify
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return st.count() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestOrphanSpansAreMarked(t *testing.T) {
+	// prepare
+	wg := &sync.WaitGroup{}
+	config := Config{
+		WaitDuration: time.Nanosecond,
+		NumTraces:    8,
+		NumWorkers:   4,
+		MarkOrphans:  true,
+	}
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			spans := received.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans()
+			require.Equal(t, 2, spans.Len())
+
+			attr, marked := spans.At(0).Attributes().Get(orphanAttributeKey)
+			assert.True(t, marked)
+			assert.True(t, attr.BoolVal())
+			_, marked = spans.At(1).Attributes().Get(orphanAttributeKey)
+			assert.False(t, marked, "the span with a parent in the trace shouldn't be marked")
+
+			wg.Done()
+			return nil
+		},
+	}
+	p := newGroupByTraceProcessor(zap.NewNop(), newMemoryStorage(), next, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, nil))
+	defer p.Shutdown(ctx)
+
+	// test
+	wg.Add(1)
+	require.NoError(t, p.ConsumeTraces(ctx, tracesWithSpans(
+		testSpan{service: "frontend", id: 2, parent: 1},
+		testSpan{service: "frontend", id: 3, parent: 2},
+	)))
+
+	// verify
+	wg.Wait()
+}
+
+type testSpan struct {
+	service string
+	id      byte
+	parent  byte
+}
+
+// tracesWithSpans returns a trace with the given spans, grouped by service
+// in order of first appearance.
+func tracesWithSpans(spans ...testSpan) pdata.Traces {
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+	td := pdata.NewTraces()
+	services := make(map[string]pdata.SpanSlice)
+	for _, s := range spans {
+		slice, ok := services[s.service]
+		if !ok {
+			rs := td.ResourceSpans().AppendEmpty()
+			rs.Resource().Attributes().InsertString(conventions.AttributeServiceName, s.service)
+			slice = rs.InstrumentationLibrarySpans().AppendEmpty().Spans()
+			services[s.service] = slice
+		}
+		span := slice.AppendEmpty()
+		span.SetTraceID(traceID)
+		span.SetSpanID(pdata.NewSpanID([8]byte{s.id}))
+		if s.parent != 0 {
+			span.SetParentSpanID(pdata.NewSpanID([8]byte{s.parent}))
+		}
+	}
+	return td
+}
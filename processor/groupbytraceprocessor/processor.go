@@ -39,6 +39,8 @@ import (
 // The typical data flow looks like this:
 // ConsumeTraces -> eventMachine.consume(trace) -> event(traceReceived) -> onTraceReceived -> AfterFunc(duration, event(traceExpired)) -> onTraceExpired
 // async markAsReleased -> event(traceReleased) -> onTraceReleased -> nextConsumer
+// When early release is enabled, a trace deemed complete is expired right away by onTraceReceived, or by onTraceIdle
+// once no spans were received for it for the idle duration.
 // Each worker in the eventMachine also uses a ring buffer to hold the in-flight trace IDs, so that we don't hold more than the given maximum number
 // of traces in memory/storage. Items that are evicted from the buffer are discarded without warning.
 type groupByTraceProcessor struct {
@@ -75,6 +77,8 @@ func newGroupByTraceProcessor(logger *zap.Logger, st storage, nextConsumer consu
 	eventMachine.onTraceExpired = sp.onTraceExpired
 	eventMachine.onTraceReleased = sp.onTraceReleased
 	eventMachine.onTraceRemoved = sp.onTraceRemoved
+	eventMachine.onTraceRestored = sp.onTraceRestored
+	eventMachine.onTraceIdle = sp.onTraceIdle
 
 	return sp
 }
@@ -94,14 +98,29 @@ func (sp *groupByTraceProcessor) Capabilities() consumer.Capabilities {
 }
 
 // Start is invoked during service startup.
-func (sp *groupByTraceProcessor) Start(context.Context, component.Host) error {
+func (sp *groupByTraceProcessor) Start(ctx context.Context, host component.Host) error {
 	// start these metrics, as it might take a while for them to receive their first event
 	stats.Record(context.Background(), mTracesEvicted.M(0))
 	stats.Record(context.Background(), mIncompleteReleases.M(0))
+	stats.Record(context.Background(), mOrphanTraces.M(0))
 	stats.Record(context.Background(), mNumTracesConf.M(int64(sp.config.NumTraces)))
 
 	sp.eventMachine.startInBackground()
-	return sp.st.start()
+	if err := sp.st.start(ctx, host); err != nil {
+		return err
+	}
+
+	// schedule the release of the traces that were waiting when the processor stopped
+	if rst, ok := sp.st.(restorableStorage); ok {
+		restored := rst.restored()
+		for traceID, arrival := range restored {
+			sp.eventMachine.restore(restoredTrace{id: traceID, arrival: arrival})
+		}
+		if len(restored) > 0 {
+			sp.logger.Info("restored traces from the storage", zap.Int("traces", len(restored)))
+		}
+	}
+	return nil
 }
 
 // Shutdown is invoked during service shutdown.
@@ -112,6 +131,11 @@ func (sp *groupByTraceProcessor) Shutdown(_ context.Context) error {
 
 func (sp *groupByTraceProcessor) onTraceReceived(trace tracesWithID, worker *eventMachineWorker) error {
 	traceID := trace.id
+	if !worker.buffer.contains(traceID) && worker.released.contains(traceID, time.Now()) {
+		sp.forwardLateSpans(traceID, trace.td)
+		return nil
+	}
+
 	if worker.buffer.contains(traceID) {
 		sp.logger.Debug("trace is already in memory storage")
 
@@ -119,6 +143,7 @@ func (sp *groupByTraceProcessor) onTraceReceived(trace tracesWithID, worker *eve
 		if err := sp.addSpans(traceID, trace.td); err != nil {
 			return fmt.Errorf("couldn't add spans to existing trace: %w", err)
 		}
+		sp.updateProgress(traceID, trace.td, worker)
 
 		// we are done with this trace, move on
 		return nil
@@ -126,10 +151,45 @@ func (sp *groupByTraceProcessor) onTraceReceived(trace tracesWithID, worker *eve
 
 	// at this point, we determined that we haven't seen the trace yet, so, record the
 	// traceID in the map and the spans to the storage
+	sp.trackTrace(traceID, worker)
+
+	// we have the traceID in the memory, place the spans in the storage too
+	if err := sp.addSpans(traceID, trace.td); err != nil {
+		return fmt.Errorf("couldn't add spans to existing trace: %w", err)
+	}
+
+	release := sp.scheduleRelease(traceID, sp.config.WaitDuration, worker)
+	if sp.earlyReleaseEnabled() {
+		worker.progress[traceID] = &traceProgress{release: release}
+		sp.updateProgress(traceID, trace.td, worker)
+	}
+	return nil
+}
 
-	// place the trace ID in the buffer, and check if an item had to be evicted
+// onTraceRestored schedules the release of a trace found in the storage on start,
+// once it has waited for the remainder of its duration.
+func (sp *groupByTraceProcessor) onTraceRestored(trace restoredTrace, worker *eventMachineWorker) error {
+	if worker.buffer.contains(trace.id) {
+		// spans for the trace were received since the processor started
+		return nil
+	}
+
+	sp.trackTrace(trace.id, worker)
+
+	wait := sp.config.WaitDuration - time.Since(trace.arrival)
+	if wait < 0 {
+		wait = 0
+	}
+	sp.scheduleRelease(trace.id, wait, worker)
+	return nil
+}
+
+// trackTrace places the trace ID in the buffer, removing the evicted trace, if any, from the storage.
+func (sp *groupByTraceProcessor) trackTrace(traceID pdata.TraceID, worker *eventMachineWorker) {
 	evicted := worker.buffer.put(traceID)
 	if !evicted.IsEmpty() {
+		sp.forgetProgress(evicted, worker)
+
 		// delete from the storage
 		worker.fire(event{
 			typ:     traceRemoved,
@@ -141,22 +201,19 @@ func (sp *groupByTraceProcessor) onTraceReceived(trace tracesWithID, worker *eve
 		sp.logger.Info("trace evicted: in order to avoid this in the future, adjust the wait duration and/or number of traces to keep in memory",
 			zap.String("traceID", evicted.HexString()))
 	}
+}
 
-	// we have the traceID in the memory, place the spans in the storage too
-	if err := sp.addSpans(traceID, trace.td); err != nil {
-		return fmt.Errorf("couldn't add spans to existing trace: %w", err)
-	}
-
-	sp.logger.Debug("scheduled to release trace", zap.Duration("duration", sp.config.WaitDuration))
+// scheduleRelease fires the expiration of the trace after the given duration.
+func (sp *groupByTraceProcessor) scheduleRelease(traceID pdata.TraceID, wait time.Duration, worker *eventMachineWorker) *time.Timer {
+	sp.logger.Debug("scheduled to release trace", zap.Duration("duration", wait))
 
-	time.AfterFunc(sp.config.WaitDuration, func() {
+	return time.AfterFunc(wait, func() {
 		// if the event machine has stopped, it will just discard the event
 		worker.fire(event{
 			typ:     traceExpired,
 			payload: traceID,
 		})
 	})
-	return nil
 }
 
 func (sp *groupByTraceProcessor) onTraceExpired(traceID pdata.TraceID, worker *eventMachineWorker) error {
@@ -175,6 +232,7 @@ func (sp *groupByTraceProcessor) onTraceExpired(traceID pdata.TraceID, worker *e
 
 	// delete from the map and erase its memory entry
 	worker.buffer.delete(traceID)
+	sp.forgetProgress(traceID, worker)
 
 	// this might block, but we don't need to wait
 	sp.logger.Debug("marking the trace as released",
@@ -216,6 +274,21 @@ func (sp *groupByTraceProcessor) onTraceReleased(rss []pdata.ResourceSpans) erro
 		trs := trace.ResourceSpans().AppendEmpty()
 		rs.CopyTo(trs)
 	}
+
+	orphans, services := findOrphans(trace)
+	recordOrphans(orphans, services)
+	if len(orphans) > 0 {
+		if sp.config.DiscardOrphans {
+			sp.logger.Debug("discarding trace with orphan spans", zap.Int("orphans", len(orphans)))
+			return nil
+		}
+		if sp.config.MarkOrphans {
+			for _, span := range orphans {
+				span.Attributes().UpsertBool(orphanAttributeKey, true)
+			}
+		}
+	}
+
 	stats.Record(context.Background(),
 		mReleasedSpans.M(int64(trace.SpanCount())),
 		mReleasedTraces.M(1),
@@ -15,6 +15,10 @@
 package groupbytraceprocessor
 
 import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/model/pdata"
 )
 
@@ -35,8 +39,17 @@ type storage interface {
 	delete(pdata.TraceID) ([]pdata.ResourceSpans, error)
 
 	// start gives the storage the opportunity to initialize any resources or procedures
-	start() error
+	start(context.Context, component.Host) error
 
 	// shutdown signals the storage that the processor is shutting down
 	shutdown() error
 }
+
+// restorableStorage is a storage keeping the traces across restarts.
+type restorableStorage interface {
+	storage
+
+	// restored returns the traces found in the storage when it started, along with the
+	// time their first spans were received
+	restored() map[pdata.TraceID]time.Time
+}
@@ -0,0 +1,253 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groupbytraceprocessor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"go.opencensus.io/stats"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
+	storageextension "go.opentelemetry.io/collector/extension/storage"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/tracestorage"
+)
+
+// diskStorage keeps the spans of the traces in a storage extension, only
+// keeping their IDs in memory. The traces left in the storage when the
+// processor stopped are restored when it starts again.
+//
+// The traces are stored with the layout of the tracestorage package, their
+// batches of spans as OTLP protobuf.
+type diskStorage struct {
+	sync.Mutex
+	id          config.ComponentID
+	client      storageextension.Client
+	marshaler   pdata.TracesMarshaler
+	unmarshaler pdata.TracesUnmarshaler
+
+	traces map[pdata.TraceID]*diskTrace
+	// indexes holds the numbers of the traces in the storage.
+	indexes   map[uint64]struct{}
+	readIndex uint64
+	nextIndex uint64
+	// restoredTraces are the arrival times of the traces found on start.
+	restoredTraces map[pdata.TraceID]time.Time
+
+	stopped                   bool
+	stoppedLock               sync.RWMutex
+	metricsCollectionInterval time.Duration
+}
+
+// diskTrace is a trace whose spans are in the storage.
+type diskTrace struct {
+	index   uint64
+	batches int
+}
+
+var _ storage = (*diskStorage)(nil)
+var _ restorableStorage = (*diskStorage)(nil)
+
+func newDiskStorage(id config.ComponentID) *diskStorage {
+	return &diskStorage{
+		id:                        id,
+		marshaler:                 otlp.NewProtobufTracesMarshaler(),
+		unmarshaler:               otlp.NewProtobufTracesUnmarshaler(),
+		traces:                    make(map[pdata.TraceID]*diskTrace),
+		indexes:                   make(map[uint64]struct{}),
+		metricsCollectionInterval: time.Second,
+	}
+}
+
+func (st *diskStorage) createOrAppend(traceID pdata.TraceID, td pdata.Traces) error {
+	buf, err := st.marshaler.MarshalTraces(td)
+	if err != nil {
+		return err
+	}
+
+	st.Lock()
+	defer st.Unlock()
+
+	ctx := context.Background()
+	trace, ok := st.traces[traceID]
+	if !ok {
+		trace = &diskTrace{index: st.nextIndex}
+		if err := st.client.Batch(ctx, tracestorage.AddTraceOperations(trace.index, traceID, time.Now())...); err != nil {
+			return err
+		}
+		st.nextIndex++
+		st.traces[traceID] = trace
+		st.indexes[trace.index] = struct{}{}
+	}
+
+	if err := st.client.Set(ctx, tracestorage.BatchKey(trace.index, trace.batches), buf); err != nil {
+		return err
+	}
+	trace.batches++
+	return nil
+}
+
+func (st *diskStorage) get(traceID pdata.TraceID) ([]pdata.ResourceSpans, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	trace, ok := st.traces[traceID]
+	if !ok {
+		return nil, nil
+	}
+	return st.load(trace)
+}
+
+// load reads the spans of the trace from the storage.
+func (st *diskStorage) load(trace *diskTrace) ([]pdata.ResourceSpans, error) {
+	var result []pdata.ResourceSpans
+	for i := 0; i < trace.batches; i++ {
+		buf, err := st.client.Get(context.Background(), tracestorage.BatchKey(trace.index, i))
+		if err != nil {
+			return nil, err
+		}
+		if buf == nil {
+			continue
+		}
+		td, err := st.unmarshaler.UnmarshalTraces(buf)
+		if err != nil {
+			return nil, err
+		}
+		for j := 0; j < td.ResourceSpans().Len(); j++ {
+			result = append(result, td.ResourceSpans().At(j))
+		}
+	}
+	return result, nil
+}
+
+func (st *diskStorage) delete(traceID pdata.TraceID) ([]pdata.ResourceSpans, error) {
+	st.Lock()
+	defer st.Unlock()
+
+	trace, ok := st.traces[traceID]
+	if !ok {
+		return nil, nil
+	}
+	result, err := st.load(trace)
+	if err != nil {
+		return nil, err
+	}
+
+	delete(st.traces, traceID)
+	delete(st.indexes, trace.index)
+	ops := tracestorage.DeleteTraceOperations(trace.index, trace.batches)
+
+	// traces are mostly removed in order of arrival, so the read index usually
+	// only needs to skip the trace just removed
+	readIndex := st.readIndex
+	for readIndex < st.nextIndex {
+		if _, ok := st.indexes[readIndex]; ok {
+			break
+		}
+		readIndex++
+	}
+	if readIndex != st.readIndex {
+		ops = append(ops, storageextension.SetOperation(tracestorage.ReadIndexKey, tracestorage.EncodeIndex(readIndex)))
+	}
+	if err := st.client.Batch(context.Background(), ops...); err != nil {
+		return nil, err
+	}
+	st.readIndex = readIndex
+	return result, nil
+}
+
+// restore loads the traces left in the storage.
+func (st *diskStorage) restore(ctx context.Context) error {
+	readIndex, nextIndex, traces, err := tracestorage.Restore(ctx, st.client)
+	if err != nil {
+		return err
+	}
+
+	st.readIndex = readIndex
+	st.nextIndex = nextIndex
+	st.restoredTraces = make(map[pdata.TraceID]time.Time, len(traces))
+	for _, trace := range traces {
+		st.traces[trace.ID] = &diskTrace{index: trace.Index, batches: trace.Batches}
+		st.indexes[trace.Index] = struct{}{}
+		st.restoredTraces[trace.ID] = trace.ArrivalTime
+	}
+	return nil
+}
+
+// restored returns the traces found in the storage on start, with their arrival time.
+func (st *diskStorage) restored() map[pdata.TraceID]time.Time {
+	st.Lock()
+	defer st.Unlock()
+	return st.restoredTraces
+}
+
+func (st *diskStorage) start(ctx context.Context, host component.Host) error {
+	client, err := tracestorage.GetStorageClient(ctx, host, st.id)
+	if err != nil {
+		return err
+	}
+
+	st.Lock()
+	st.client = client
+	err = st.restore(ctx)
+	st.Unlock()
+	if err != nil {
+		_ = client.Close(ctx)
+		return fmt.Errorf("couldn't restore the traces from the storage: %w", err)
+	}
+
+	go st.periodicMetrics()
+	return nil
+}
+
+func (st *diskStorage) shutdown() error {
+	st.stoppedLock.Lock()
+	st.stopped = true
+	st.stoppedLock.Unlock()
+
+	st.Lock()
+	defer st.Unlock()
+	if st.client == nil {
+		return nil
+	}
+	return st.client.Close(context.Background())
+}
+
+func (st *diskStorage) periodicMetrics() {
+	numTraces := st.count()
+	stats.Record(context.Background(), mNumTracesOnDisk.M(int64(numTraces)))
+
+	st.stoppedLock.RLock()
+	stopped := st.stopped
+	st.stoppedLock.RUnlock()
+	if stopped {
+		return
+	}
+
+	time.AfterFunc(st.metricsCollectionInterval, func() {
+		st.periodicMetrics()
+	})
+}
+
+func (st *diskStorage) count() int {
+	st.Lock()
+	defer st.Unlock()
+	return len(st.traces)
+}
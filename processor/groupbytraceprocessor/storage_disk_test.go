@@ -0,0 +1,337 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package groupbytraceprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config"
+	storageextension "go.opentelemetry.io/collector/extension/storage"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/tracestorage"
+)
+
+func TestDiskCreateAndGetTrace(t *testing.T) {
+	// prepare
+	st := newDiskStorage(config.NewID(typeStr))
+	require.NoError(t, st.start(context.Background(), newStorageHost(newMapClient())))
+	defer st.shutdown()
+
+	traceIDs := []pdata.TraceID{
+		pdata.NewTraceID([16]byte{1, 2, 3, 4}),
+		pdata.NewTraceID([16]byte{2, 3, 4, 5}),
+	}
+
+	// test
+	for _, traceID := range traceIDs {
+		require.NoError(t, st.createOrAppend(traceID, simpleTracesWithID(traceID)))
+		require.NoError(t, st.createOrAppend(traceID, simpleTracesWithID(traceID)))
+	}
+
+	// verify
+	assert.Equal(t, 2, st.count())
+	for _, traceID := range traceIDs {
+		expected := simpleTracesWithID(traceID).ResourceSpans().At(0)
+
+		retrieved, err := st.get(traceID)
+
+		require.NoError(t, err)
+		assert.Equal(t, []pdata.ResourceSpans{expected, expected}, retrieved)
+	}
+}
+
+func TestDiskDeleteTrace(t *testing.T) {
+	// prepare
+	client := newMapClient()
+	st := newDiskStorage(config.NewID(typeStr))
+	require.NoError(t, st.start(context.Background(), newStorageHost(client)))
+	defer st.shutdown()
+
+	firstID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+	secondID := pdata.NewTraceID([16]byte{2, 3, 4, 5})
+	require.NoError(t, st.createOrAppend(firstID, simpleTracesWithID(firstID)))
+	require.NoError(t, st.createOrAppend(secondID, simpleTracesWithID(secondID)))
+
+	// test
+	deleted, err := st.delete(secondID)
+
+	// verify
+	require.NoError(t, err)
+	assert.Equal(t, []pdata.ResourceSpans{simpleTracesWithID(secondID).ResourceSpans().At(0)}, deleted)
+	assert.Equal(t, 1, st.count())
+	assert.Equal(t, uint64(0), st.readIndex, "the first trace is still stored")
+
+	// test
+	_, err = st.delete(firstID)
+
+	// verify
+	require.NoError(t, err)
+	assert.Equal(t, 0, st.count())
+	assert.Equal(t, uint64(2), st.readIndex)
+	assert.Equal(t, tracestorage.EncodeIndex(2), client.data[tracestorage.ReadIndexKey])
+	assert.Len(t, client.data, 2, "only the indexes should be left")
+
+	retrieved, err := st.get(firstID)
+	require.NoError(t, err)
+	assert.Nil(t, retrieved)
+}
+
+func TestDiskRestoreTraces(t *testing.T) {
+	// prepare
+	client := newMapClient()
+	host := newStorageHost(client)
+	st := newDiskStorage(config.NewID(typeStr))
+	require.NoError(t, st.start(context.Background(), host))
+	assert.Empty(t, st.restored())
+
+	releasedID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+	pendingID := pdata.NewTraceID([16]byte{2, 3, 4, 5})
+	before := time.Now()
+	require.NoError(t, st.createOrAppend(releasedID, simpleTracesWithID(releasedID)))
+	require.NoError(t, st.createOrAppend(pendingID, simpleTracesWithID(pendingID)))
+	require.NoError(t, st.createOrAppend(pendingID, simpleTracesWithID(pendingID)))
+	_, err := st.delete(releasedID)
+	require.NoError(t, err)
+	require.NoError(t, st.shutdown())
+
+	// test
+	st = newDiskStorage(config.NewID(typeStr))
+	require.NoError(t, st.start(context.Background(), host))
+	defer st.shutdown()
+
+	// verify
+	restored := st.restored()
+	require.Len(t, restored, 1)
+	assert.False(t, restored[pendingID].Before(before.Truncate(time.Nanosecond)))
+	assert.Equal(t, 1, st.count())
+
+	expected := simpleTracesWithID(pendingID).ResourceSpans().At(0)
+	retrieved, err := st.get(pendingID)
+	require.NoError(t, err)
+	assert.Equal(t, []pdata.ResourceSpans{expected, expected}, retrieved)
+
+	// new traces are numbered after the restored ones
+	newID := pdata.NewTraceID([16]byte{3, 4, 5, 6})
+	require.NoError(t, st.createOrAppend(newID, simpleTracesWithID(newID)))
+	assert.Equal(t, uint64(3), st.nextIndex)
+}
+
+func TestDiskRestoreDuplicateTrace(t *testing.T) {
+	// prepare
+	client := newMapClient()
+	host := newStorageHost(client)
+	st := newDiskStorage(config.NewID(typeStr))
+	require.NoError(t, st.start(context.Background(), host))
+
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+	require.NoError(t, st.createOrAppend(traceID, simpleTracesWithID(traceID)))
+	require.NoError(t, st.shutdown())
+
+	// the same trace stored again under the next number, as left by an interrupted release
+	ctx := context.Background()
+	latest := simpleTracesWithID(traceID)
+	latest.ResourceSpans().At(0).Resource().Attributes().InsertString("attempt", "latest")
+	buf, err := st.marshaler.MarshalTraces(latest)
+	require.NoError(t, err)
+	require.NoError(t, client.Batch(ctx, tracestorage.AddTraceOperations(1, traceID, time.Now())...))
+	require.NoError(t, client.Set(ctx, tracestorage.BatchKey(1, 0), buf))
+
+	// test
+	st = newDiskStorage(config.NewID(typeStr))
+	require.NoError(t, st.start(context.Background(), host))
+	defer st.shutdown()
+
+	// verify
+	assert.Len(t, st.restored(), 1)
+	assert.Equal(t, 1, st.count())
+	assert.NotContains(t, client.data, tracestorage.TraceKey(0), "the older arrival should be deleted")
+
+	deleted, err := st.delete(traceID)
+	require.NoError(t, err)
+	assert.Equal(t, []pdata.ResourceSpans{latest.ResourceSpans().At(0)}, deleted)
+	assert.Equal(t, uint64(2), st.readIndex, "no stale trace should hold the read index back")
+	assert.Len(t, client.data, 2, "only the indexes should be left")
+}
+
+func TestDiskStartWithoutStorageExtension(t *testing.T) {
+	for _, tt := range []struct {
+		host        component.Host
+		expectedErr error
+	}{
+		{
+			newStorageHost(),
+			tracestorage.ErrNoStorageClient,
+		},
+		{
+			newStorageHost(newMapClient(), newMapClient()),
+			tracestorage.ErrMultipleStorageClients,
+		},
+	} {
+		st := newDiskStorage(config.NewID(typeStr))
+
+		// test
+		err := st.start(context.Background(), tt.host)
+
+		// verify
+		assert.ErrorIs(t, err, tt.expectedErr)
+		assert.NoError(t, st.shutdown())
+	}
+}
+
+func TestRestoredTraceIsReleased(t *testing.T) {
+	// prepare
+	client := newMapClient()
+	host := newStorageHost(client)
+	config := Config{
+		WaitDuration: time.Hour,
+		NumTraces:    10,
+		NumWorkers:   4,
+	}
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+	traces := simpleTracesWithID(traceID)
+
+	p := newGroupByTraceProcessor(zap.NewNop(), newDiskStorage(config.ID()), &mockProcessor{}, config)
+	ctx := context.Background()
+	require.NoError(t, p.Start(ctx, host))
+	require.NoError(t, p.ConsumeTraces(ctx, traces))
+
+	// the trace is stored before the processor stops, without being released
+	assert.Eventually(t, func() bool {
+		return p.st.(*diskStorage).count() == 1
+	}, time.Second, 10*time.Millisecond)
+	require.NoError(t, p.Shutdown(ctx))
+
+	// test
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	next := &mockProcessor{
+		onTraces: func(_ context.Context, received pdata.Traces) error {
+			assert.Equal(t, traces, received)
+			wg.Done()
+			return nil
+		},
+	}
+	config.WaitDuration = time.Nanosecond
+	p = newGroupByTraceProcessor(zap.NewNop(), newDiskStorage(config.ID()), next, config)
+	require.NoError(t, p.Start(ctx, host))
+	defer p.Shutdown(ctx)
+
+	// verify
+	wg.Wait()
+	assert.Eventually(t, func() bool {
+		return p.st.(*diskStorage).count() == 0
+	}, time.Second, 10*time.Millisecond)
+}
+
+// mapClient is a storage client keeping its data in a map that outlives it.
+type mapClient struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+}
+
+var _ storageextension.Client = (*mapClient)(nil)
+
+func newMapClient() *mapClient {
+	return &mapClient{data: make(map[string][]byte)}
+}
+
+func (c *mapClient) Get(_ context.Context, key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.data[key], nil
+}
+
+func (c *mapClient) Set(_ context.Context, key string, value []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data[key] = value
+	return nil
+}
+
+func (c *mapClient) Delete(_ context.Context, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+func (c *mapClient) Batch(ctx context.Context, ops ...storageextension.Operation) error {
+	for _, op := range ops {
+		var err error
+		switch op.Type {
+		case storageextension.Get:
+			op.Value, err = c.Get(ctx, op.Key)
+		case storageextension.Set:
+			err = c.Set(ctx, op.Key, op.Value)
+		case storageextension.Delete:
+			err = c.Delete(ctx, op.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *mapClient) Close(context.Context) error {
+	return nil
+}
+
+type mapStorageExtension struct {
+	client *mapClient
+}
+
+var _ storageextension.Extension = (*mapStorageExtension)(nil)
+
+func (e *mapStorageExtension) Start(context.Context, component.Host) error {
+	return nil
+}
+
+func (e *mapStorageExtension) Shutdown(context.Context) error {
+	return nil
+}
+
+func (e *mapStorageExtension) GetClient(context.Context, component.Kind, config.ComponentID, string) (storageextension.Client, error) {
+	return e.client, nil
+}
+
+type storageHost struct {
+	component.Host
+	extensions map[config.ComponentID]component.Extension
+}
+
+func (h storageHost) GetExtensions() map[config.ComponentID]component.Extension {
+	return h.extensions
+}
+
+func newStorageHost(clients ...*mapClient) component.Host {
+	h := storageHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: make(map[config.ComponentID]component.Extension),
+	}
+	for i, client := range clients {
+		h.extensions[config.NewIDWithName("map_storage", string(rune('a'+i)))] = &mapStorageExtension{client: client}
+	}
+	return h
+}
@@ -20,6 +20,19 @@ import (
 	"go.opentelemetry.io/collector/config"
 )
 
+// The values of the aggregation_temporality option.
+const (
+	delta      = "AGGREGATION_TEMPORALITY_DELTA"
+	cumulative = "AGGREGATION_TEMPORALITY_CUMULATIVE"
+)
+
+// ExemplarsConfig defines the configuration of the latency histogram exemplars.
+type ExemplarsConfig struct {
+	// Enabled attaches to each latency histogram bucket the trace and span IDs of the last span that fell in it,
+	// allowing to go from a latency to a matching trace.
+	Enabled bool `mapstructure:"enabled"`
+}
+
 // Dimension defines the dimension name and optional default value if the Dimension is missing from a span attribute.
 type Dimension struct {
 	Name    string  `mapstructure:"name"`
@@ -33,6 +46,10 @@ type Config struct {
 	// MetricsExporter is the name of the metrics exporter to use to ship metrics.
 	MetricsExporter string `mapstructure:"metrics_exporter"`
 
+	// MetricsReceiver is the name of a spanmetrics receiver to push the metrics to instead of the metrics exporter,
+	// so that they flow through the processors of the metrics pipelines the receiver is part of.
+	MetricsReceiver string `mapstructure:"metrics_receiver"`
+
 	// LatencyHistogramBuckets is the list of durations representing latency histogram buckets.
 	// See defaultLatencyHistogramBucketsMs in processor.go for the default value.
 	LatencyHistogramBuckets []time.Duration `mapstructure:"latency_histogram_buckets"`
@@ -45,4 +62,28 @@ type Config struct {
 	// The dimensions will be fetched from the span's attributes. Examples of some conventionally used attributes:
 	// https://github.com/open-telemetry/opentelemetry-collector/blob/main/model/semconv/opentelemetry.go.
 	Dimensions []Dimension `mapstructure:"dimensions"`
+
+	// ResourceDimensions defines the list of additional dimensions fetched from the attributes of the resource of
+	// the spans, such as k8s.namespace.name or deployment.environment.
+	ResourceDimensions []Dimension `mapstructure:"resource_dimensions"`
+
+	// Exemplars configures the exemplars attached to the latency histogram buckets.
+	Exemplars ExemplarsConfig `mapstructure:"exemplars"`
+
+	// DimensionsCacheSize is the maximum number of metric series, i.e. distinct combinations of dimension values,
+	// kept track of. The least recently used series are dropped when it's reached, bounding the memory used when
+	// dimensions have a high cardinality.
+	// See defaultDimensionsCacheSize in factory.go for the default value.
+	DimensionsCacheSize int `mapstructure:"dimensions_cache_size"`
+
+	// AggregationTemporality is the temporality of the generated metrics, either
+	// "AGGREGATION_TEMPORALITY_CUMULATIVE" or "AGGREGATION_TEMPORALITY_DELTA". Delta metrics only account for
+	// the spans received since they were last emitted.
+	// Default: "AGGREGATION_TEMPORALITY_CUMULATIVE".
+	AggregationTemporality string `mapstructure:"aggregation_temporality"`
+
+	// MetricsFlushInterval is the interval at which the metrics are emitted. They're emitted for every received
+	// batch of spans when it's zero.
+	// Default: 0.
+	MetricsFlushInterval time.Duration `mapstructure:"metrics_flush_interval"`
 }
@@ -35,14 +35,37 @@ import (
 
 func TestLoadConfig(t *testing.T) {
 	defaultMethod := "GET"
+	unknown := "unknown"
 	testcases := []struct {
 		configFile                  string
 		wantMetricsExporter         string
+		wantMetricsReceiver         string
 		wantLatencyHistogramBuckets []time.Duration
 		wantDimensions              []Dimension
+		wantDimensionsCacheSize     int
+		wantAggregationTemporality  string
+		wantMetricsFlushInterval    time.Duration
+		wantResourceDimensions      []Dimension
+		wantExemplars               ExemplarsConfig
 	}{
-		{configFile: "config-2-pipelines.yaml", wantMetricsExporter: "prometheus"},
-		{configFile: "config-3-pipelines.yaml", wantMetricsExporter: "otlp/spanmetrics"},
+		{
+			configFile:                 "config-2-pipelines.yaml",
+			wantMetricsExporter:        "prometheus",
+			wantDimensionsCacheSize:    defaultDimensionsCacheSize,
+			wantAggregationTemporality: cumulative,
+		},
+		{
+			configFile:                 "config-3-pipelines.yaml",
+			wantMetricsExporter:        "otlp/spanmetrics",
+			wantDimensionsCacheSize:    defaultDimensionsCacheSize,
+			wantAggregationTemporality: cumulative,
+		},
+		{
+			configFile:                 "config-receiver.yaml",
+			wantMetricsReceiver:        "spanmetrics",
+			wantDimensionsCacheSize:    defaultDimensionsCacheSize,
+			wantAggregationTemporality: cumulative,
+		},
 		{
 			configFile:          "config-full.yaml",
 			wantMetricsExporter: "otlp/spanmetrics",
@@ -59,6 +82,13 @@ func TestLoadConfig(t *testing.T) {
 				{"http.method", &defaultMethod},
 				{"http.status_code", nil},
 			},
+			wantDimensionsCacheSize:    500,
+			wantAggregationTemporality: delta,
+			wantMetricsFlushInterval:   15 * time.Second,
+			wantResourceDimensions: []Dimension{
+				{"deployment.environment", &unknown},
+			},
+			wantExemplars: ExemplarsConfig{Enabled: true},
 		},
 	}
 	for _, tc := range testcases {
@@ -69,6 +99,7 @@ func TestLoadConfig(t *testing.T) {
 
 			factories.Receivers["otlp"] = otlpreceiver.NewFactory()
 			factories.Receivers["jaeger"] = jaegerreceiver.NewFactory()
+			factories.Receivers[typeStr] = NewReceiverFactory()
 
 			factories.Processors[typeStr] = NewFactory()
 			factories.Processors["batch"] = batchprocessor.NewFactory()
@@ -87,8 +118,14 @@ func TestLoadConfig(t *testing.T) {
 				&Config{
 					ProcessorSettings:       config.NewProcessorSettings(config.NewID(typeStr)),
 					MetricsExporter:         tc.wantMetricsExporter,
+					MetricsReceiver:         tc.wantMetricsReceiver,
 					LatencyHistogramBuckets: tc.wantLatencyHistogramBuckets,
 					Dimensions:              tc.wantDimensions,
+					DimensionsCacheSize:     tc.wantDimensionsCacheSize,
+					AggregationTemporality:  tc.wantAggregationTemporality,
+					MetricsFlushInterval:    tc.wantMetricsFlushInterval,
+					ResourceDimensions:      tc.wantResourceDimensions,
+					Exemplars:               tc.wantExemplars,
 				},
 				cfg.Processors[config.NewID(typeStr)],
 			)
@@ -26,6 +26,9 @@ import (
 const (
 	// The value of "type" key in configuration.
 	typeStr = "spanmetrics"
+
+	// The maximum number of metric series kept track of by default.
+	defaultDimensionsCacheSize = 1000
 )
 
 // NewFactory creates a factory for the spanmetrics processor.
@@ -39,7 +42,9 @@ func NewFactory() component.ProcessorFactory {
 
 func createDefaultConfig() config.Processor {
 	return &Config{
-		ProcessorSettings: config.NewProcessorSettings(config.NewID(typeStr)),
+		ProcessorSettings:      config.NewProcessorSettings(config.NewID(typeStr)),
+		DimensionsCacheSize:    defaultDimensionsCacheSize,
+		AggregationTemporality: cumulative,
 	}
 }
 
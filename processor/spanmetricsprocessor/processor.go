@@ -24,6 +24,7 @@ import (
 	"time"
 	"unicode"
 
+	"github.com/hashicorp/golang-lru/simplelru"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer"
@@ -34,9 +35,10 @@ import (
 
 const (
 	serviceNameKey     = conventions.AttributeServiceName
-	operationKey       = "operation"   // OpenTelemetry non-standard constant.
-	spanKindKey        = "span.kind"   // OpenTelemetry non-standard constant.
-	statusCodeKey      = "status.code" // OpenTelemetry non-standard constant.
+	operationKey       = "operation"      // OpenTelemetry non-standard constant.
+	spanKindKey        = "span.kind"      // OpenTelemetry non-standard constant.
+	statusCodeKey      = "status.code"    // OpenTelemetry non-standard constant.
+	statusMessageKey   = "status.message" // OpenTelemetry non-standard constant.
 	metricKeySeparator = string(byte(0))
 )
 
@@ -56,27 +58,60 @@ type processorImp struct {
 	logger *zap.Logger
 	config Config
 
-	metricsExporter component.MetricsExporter
+	// The consumer of the metrics, either the configured exporter or the metrics pipelines of the configured receiver.
+	metricsConsumer consumer.Metrics
 	nextConsumer    consumer.Traces
 
 	// Additional dimensions to add to metrics.
 	dimensions []Dimension
+	// Additional dimensions to add to metrics, fetched from the resource attributes.
+	resourceDimensions []Dimension
 
-	// The starting time of the data points.
+	// The starting time of the data points of delta metrics, i.e. when they were last emitted.
 	startTime time.Time
 
-	// Call & Error counts.
-	callSum map[metricKey]int64
+	// Call & Error counts. The errors are keyed by error key, see buildErrorKey.
+	callSum  map[metricKey]int64
+	errorSum map[metricKey]int64
 
 	// Latency histogram.
 	latencyCount        map[metricKey]uint64
 	latencySum          map[metricKey]float64
 	latencyBucketCounts map[metricKey][]uint64
 	latencyBounds       []float64
+	// The last span of each latency histogram bucket, when exemplars are enabled.
+	latencyExemplars map[metricKey][]exemplarData
 
-	// A cache of dimension key-value maps keyed by a unique identifier formed by a concatenation of its values:
+	// A LRU cache of dimension key-value maps keyed by a unique identifier formed by a concatenation of its values:
 	// e.g. { "foo/barOK": { "serviceName": "foo", "operation": "/bar", "status_code": "OK" }}
-	metricKeyToDimensions map[metricKey]pdata.AttributeMap
+	// The call and latency data of a metric key are dropped when it's evicted, bounding the number of series.
+	metricKeyToDimensions *simplelru.LRU
+	// A LRU cache of the dimension key-value maps of the error counts, keyed by error key, of the same size.
+	errorKeyToDimensions *simplelru.LRU
+	// The number of series evicted from the caches since the metrics were last built, and whether it was logged yet.
+	evictedSeries  int
+	evictionLogged bool
+
+	// Closed to stop the periodic flush of the metrics, which closes flushDone when it's done.
+	flushStop chan struct{}
+	flushDone chan struct{}
+	// Unregisters the flush on shutdown of the configured receiver, if any.
+	removeReceiverFlush func()
+}
+
+// exemplarData is the exemplar of a latency histogram bucket.
+type exemplarData struct {
+	traceID   pdata.TraceID
+	spanID    pdata.SpanID
+	value     float64
+	timestamp pdata.Timestamp
+}
+
+// cachedDimensions are the dimension key-value map of a metric key.
+type cachedDimensions struct {
+	attributes pdata.AttributeMap
+	// The starting time of the data points of cumulative metrics, i.e. when the metric key was cached.
+	startTime time.Time
 }
 
 func newProcessor(logger *zap.Logger, config config.Processor, nextConsumer consumer.Traces) (*processorImp, error) {
@@ -93,23 +128,46 @@ func newProcessor(logger *zap.Logger, config config.Processor, nextConsumer cons
 		}
 	}
 
-	if err := validateDimensions(pConfig.Dimensions); err != nil {
+	allDimensions := make([]Dimension, 0, len(pConfig.Dimensions)+len(pConfig.ResourceDimensions))
+	allDimensions = append(allDimensions, pConfig.Dimensions...)
+	allDimensions = append(allDimensions, pConfig.ResourceDimensions...)
+	if err := validateDimensions(allDimensions); err != nil {
 		return nil, err
 	}
 
-	return &processorImp{
-		logger:                logger,
-		config:                *pConfig,
-		startTime:             time.Now(),
-		callSum:               make(map[metricKey]int64),
-		latencyBounds:         bounds,
-		latencySum:            make(map[metricKey]float64),
-		latencyCount:          make(map[metricKey]uint64),
-		latencyBucketCounts:   make(map[metricKey][]uint64),
-		nextConsumer:          nextConsumer,
-		dimensions:            pConfig.Dimensions,
-		metricKeyToDimensions: make(map[metricKey]pdata.AttributeMap),
-	}, nil
+	if pConfig.AggregationTemporality != cumulative && pConfig.AggregationTemporality != delta {
+		return nil, fmt.Errorf("invalid aggregation_temporality %q, must be one of %s or %s", pConfig.AggregationTemporality, cumulative, delta)
+	}
+
+	if pConfig.MetricsExporter != "" && pConfig.MetricsReceiver != "" {
+		return nil, fmt.Errorf("metrics_exporter and metrics_receiver are mutually exclusive")
+	}
+
+	p := &processorImp{
+		logger:              logger,
+		config:              *pConfig,
+		startTime:           time.Now(),
+		callSum:             make(map[metricKey]int64),
+		errorSum:            make(map[metricKey]int64),
+		latencyBounds:       bounds,
+		latencySum:          make(map[metricKey]float64),
+		latencyCount:        make(map[metricKey]uint64),
+		latencyBucketCounts: make(map[metricKey][]uint64),
+		latencyExemplars:    make(map[metricKey][]exemplarData),
+		nextConsumer:        nextConsumer,
+		dimensions:          pConfig.Dimensions,
+		resourceDimensions:  pConfig.ResourceDimensions,
+	}
+
+	cache, err := simplelru.NewLRU(pConfig.DimensionsCacheSize, p.onEvicted)
+	if err != nil {
+		return nil, fmt.Errorf("invalid dimensions_cache_size %d: %w", pConfig.DimensionsCacheSize, err)
+	}
+	p.metricKeyToDimensions = cache
+	// The size was validated above.
+	p.errorKeyToDimensions, _ = simplelru.NewLRU(pConfig.DimensionsCacheSize, p.onErrorEvicted)
+
+	return p, nil
 }
 
 // durationToMillis converts the given duration to the number of milliseconds it represents.
@@ -130,7 +188,7 @@ func mapDurationsToMillis(vs []time.Duration) []float64 {
 // the usage of Prometheus related exporters, we also validate the dimensions after sanitization.
 func validateDimensions(dimensions []Dimension) error {
 	labelNames := make(map[string]struct{})
-	for _, key := range []string{serviceNameKey, spanKindKey, statusCodeKey} {
+	for _, key := range []string{serviceNameKey, spanKindKey, statusCodeKey, statusMessageKey} {
 		labelNames[key] = struct{}{}
 		labelNames[sanitize(key)] = struct{}{}
 	}
@@ -158,6 +216,23 @@ func validateDimensions(dimensions []Dimension) error {
 // Start implements the component.Component interface.
 func (p *processorImp) Start(ctx context.Context, host component.Host) error {
 	p.logger.Info("Starting spanmetricsprocessor")
+	if p.config.MetricsReceiver != "" {
+		if err := p.findMetricsReceiver(); err != nil {
+			return err
+		}
+	} else if err := p.findMetricsExporter(host); err != nil {
+		return err
+	}
+
+	if p.config.MetricsFlushInterval > 0 {
+		p.startFlushing()
+	}
+	p.logger.Info("Started spanmetricsprocessor")
+	return nil
+}
+
+// findMetricsExporter looks up the configured metrics exporter among the exporters of the metrics pipelines.
+func (p *processorImp) findMetricsExporter(host component.Host) error {
 	exporters := host.GetExporters()
 
 	var availableMetricsExporters []string
@@ -176,23 +251,77 @@ func (p *processorImp) Start(ctx context.Context, host component.Host) error {
 			zap.Any("available-exporters", availableMetricsExporters),
 		)
 		if k.String() == p.config.MetricsExporter {
-			p.metricsExporter = metricsExp
+			p.metricsConsumer = metricsExp
 			p.logger.Info("Found exporter", zap.String("spanmetrics-exporter", p.config.MetricsExporter))
 			break
 		}
 	}
-	if p.metricsExporter == nil {
+	if p.metricsConsumer == nil {
 		return fmt.Errorf("failed to find metrics exporter: '%s'; please configure metrics_exporter from one of: %+v",
 			p.config.MetricsExporter, availableMetricsExporters)
 	}
-	p.logger.Info("Started spanmetricsprocessor")
+	return nil
+}
+
+// findMetricsReceiver sets up the configured spanmetrics receiver, so that the metrics flow through its metrics
+// pipelines. Receivers start after processors, so it's only looked up when metrics are pushed.
+func (p *processorImp) findMetricsReceiver() error {
+	id, err := config.NewIDFromString(p.config.MetricsReceiver)
+	if err != nil {
+		return fmt.Errorf("invalid metrics_receiver %q: %w", p.config.MetricsReceiver, err)
+	}
+	if id.Type() != typeStr {
+		return fmt.Errorf("invalid metrics_receiver %q, must be a %s receiver", p.config.MetricsReceiver, typeStr)
+	}
+
+	// The receiver shuts down first, the remaining metrics must be flushed while its pipelines still run.
+	p.removeReceiverFlush = addReceiverFlush(id, p.flush)
+	p.metricsConsumer = &receiverConsumer{id: id, logger: p.logger}
+	p.logger.Info("Using receiver", zap.String("spanmetrics-receiver", p.config.MetricsReceiver))
 	return nil
 }
 
 // Shutdown implements the component.Component interface.
 func (p *processorImp) Shutdown(ctx context.Context) error {
 	p.logger.Info("Shutting down spanmetricsprocessor")
-	return nil
+	if p.removeReceiverFlush != nil {
+		p.removeReceiverFlush()
+	}
+	return p.flush(ctx)
+}
+
+// flush stops the periodic flush and emits the metrics aggregated since the last one. It's called on Shutdown, or
+// before when the configured receiver shuts down, and does nothing once the periodic flush is stopped.
+func (p *processorImp) flush(ctx context.Context) error {
+	if p.flushStop == nil {
+		return nil
+	}
+	close(p.flushStop)
+	<-p.flushDone
+	p.flushStop = nil
+
+	return p.exportMetrics(ctx)
+}
+
+// startFlushing emits the metrics every flush interval until Shutdown is called.
+func (p *processorImp) startFlushing() {
+	p.flushStop = make(chan struct{})
+	p.flushDone = make(chan struct{})
+	go func() {
+		defer close(p.flushDone)
+		ticker := time.NewTicker(p.config.MetricsFlushInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if err := p.exportMetrics(context.Background()); err != nil {
+					p.logger.Error("Failed to export span metrics", zap.Error(err))
+				}
+			case <-p.flushStop:
+				return
+			}
+		}
+	}()
 }
 
 // Capabilities implements the consumer interface.
@@ -201,37 +330,120 @@ func (p *processorImp) Capabilities() consumer.Capabilities {
 }
 
 // ConsumeTraces implements the consumer.Traces interface.
-// It aggregates the trace data to generate metrics, forwarding these metrics to the discovered metrics exporter.
+// It aggregates the trace data to generate metrics, forwarding these metrics to the discovered metrics exporter or receiver.
 // The original input trace data will be forwarded to the next consumer, unmodified.
 func (p *processorImp) ConsumeTraces(ctx context.Context, traces pdata.Traces) error {
 	p.aggregateMetrics(traces)
 
-	m := p.buildMetrics()
-
 	// Firstly, export metrics to avoid being impacted by downstream trace processor errors/latency.
-	if err := p.metricsExporter.ConsumeMetrics(ctx, *m); err != nil {
-		return err
+	// They're exported periodically instead when a flush interval is configured.
+	if p.config.MetricsFlushInterval <= 0 {
+		if err := p.metricsConsumer.ConsumeMetrics(ctx, *p.buildMetrics()); err != nil {
+			return err
+		}
 	}
 
 	// Forward trace data unmodified.
 	return p.nextConsumer.ConsumeTraces(ctx, traces)
 }
 
+// exportMetrics sends the metrics to the exporter or receiver, if any span was aggregated into them.
+func (p *processorImp) exportMetrics(ctx context.Context) error {
+	m := p.buildMetrics()
+	if m.MetricCount() == 0 {
+		return nil
+	}
+	return p.metricsConsumer.ConsumeMetrics(ctx, *m)
+}
+
 // buildMetrics collects the computed raw metrics data, builds the metrics object and
 // writes the raw metrics data into the metrics object.
+// The raw metrics data is reset afterwards for delta metrics. The exemplars are reset
+// whatever the temporality, so that a span is only reported once as an exemplar.
 func (p *processorImp) buildMetrics() *pdata.Metrics {
 	m := pdata.NewMetrics()
 	ilm := m.ResourceMetrics().AppendEmpty().InstrumentationLibraryMetrics().AppendEmpty()
 	ilm.InstrumentationLibrary().SetName("spanmetricsprocessor")
 
-	p.lock.RLock()
+	p.lock.Lock()
 	p.collectCallMetrics(ilm)
 	p.collectLatencyMetrics(ilm)
-	p.lock.RUnlock()
+	p.collectErrorMetrics(ilm)
+	if p.config.AggregationTemporality == delta {
+		p.resetAccumulatedMetrics()
+	}
+	p.latencyExemplars = make(map[metricKey][]exemplarData)
+	evicted, warn := p.evictedSeries, !p.evictionLogged
+	if evicted > 0 {
+		p.evictedSeries = 0
+		p.evictionLogged = true
+	}
+	p.lock.Unlock()
 
+	p.logEvictions(evicted, warn)
 	return &m
 }
 
+// resetAccumulatedMetrics resets the raw metrics data, keeping the cached dimensions.
+func (p *processorImp) resetAccumulatedMetrics() {
+	p.callSum = make(map[metricKey]int64)
+	p.errorSum = make(map[metricKey]int64)
+	p.latencyCount = make(map[metricKey]uint64)
+	p.latencySum = make(map[metricKey]float64)
+	p.latencyBucketCounts = make(map[metricKey][]uint64)
+	p.startTime = time.Now()
+}
+
+// onEvicted drops the raw metrics data of a metric key evicted from the dimensions cache.
+func (p *processorImp) onEvicted(key interface{}, _ interface{}) {
+	p.evictedSeries++
+	k := key.(metricKey)
+	delete(p.callSum, k)
+	delete(p.latencyCount, k)
+	delete(p.latencySum, k)
+	delete(p.latencyBucketCounts, k)
+	delete(p.latencyExemplars, k)
+}
+
+// onErrorEvicted drops the error count of an error key evicted from the error dimensions cache.
+func (p *processorImp) onErrorEvicted(key interface{}, _ interface{}) {
+	p.evictedSeries++
+	delete(p.errorSum, key.(metricKey))
+}
+
+// logEvictions logs the number of series evicted from the dimensions caches, whose cumulative metrics restart from
+// zero if they're seen again. The first evictions are logged as a warning, the following ones at debug level not to
+// flood the logs.
+func (p *processorImp) logEvictions(evicted int, warn bool) {
+	if evicted == 0 {
+		return
+	}
+	fields := []zap.Field{zap.Int("evicted-series", evicted), zap.Int("dimensions-cache-size", p.config.DimensionsCacheSize)}
+	if warn {
+		p.logger.Warn("Evicted the least recently used metric series, dimensions_cache_size is reached", fields...)
+		return
+	}
+	p.logger.Debug("Evicted the least recently used metric series", fields...)
+}
+
+// cachedDimensions returns the dimensions of the key in the given cache along with the start time of its data points.
+func (p *processorImp) cachedDimensions(cache *simplelru.LRU, key metricKey) (pdata.AttributeMap, pdata.Timestamp) {
+	v, _ := cache.Peek(key)
+	dims := v.(*cachedDimensions)
+	if p.config.AggregationTemporality == delta {
+		return dims.attributes, pdata.NewTimestampFromTime(p.startTime)
+	}
+	return dims.attributes, pdata.NewTimestampFromTime(dims.startTime)
+}
+
+// aggregationTemporality returns the aggregation temporality of the metrics.
+func (p *processorImp) aggregationTemporality() pdata.AggregationTemporality {
+	if p.config.AggregationTemporality == delta {
+		return pdata.AggregationTemporalityDelta
+	}
+	return pdata.AggregationTemporalityCumulative
+}
+
 // collectLatencyMetrics collects the raw latency metrics, writing the data
 // into the given instrumentation library metrics.
 func (p *processorImp) collectLatencyMetrics(ilm pdata.InstrumentationLibraryMetrics) {
@@ -239,17 +451,55 @@ func (p *processorImp) collectLatencyMetrics(ilm pdata.InstrumentationLibraryMet
 		mLatency := ilm.Metrics().AppendEmpty()
 		mLatency.SetDataType(pdata.MetricDataTypeHistogram)
 		mLatency.SetName("latency")
-		mLatency.Histogram().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+		mLatency.Histogram().SetAggregationTemporality(p.aggregationTemporality())
 
+		dims, startTime := p.cachedDimensions(p.metricKeyToDimensions, key)
 		dpLatency := mLatency.Histogram().DataPoints().AppendEmpty()
-		dpLatency.SetStartTimestamp(pdata.NewTimestampFromTime(p.startTime))
+		dpLatency.SetStartTimestamp(startTime)
 		dpLatency.SetTimestamp(pdata.NewTimestampFromTime(time.Now()))
 		dpLatency.SetExplicitBounds(p.latencyBounds)
 		dpLatency.SetBucketCounts(p.latencyBucketCounts[key])
 		dpLatency.SetCount(p.latencyCount[key])
 		dpLatency.SetSum(p.latencySum[key])
+		p.collectExemplars(key, dpLatency.Exemplars())
 
-		p.metricKeyToDimensions[key].CopyTo(dpLatency.Attributes())
+		dims.CopyTo(dpLatency.Attributes())
+	}
+}
+
+// collectExemplars writes the exemplars of the latency histogram buckets of the metric key into the given slice.
+func (p *processorImp) collectExemplars(key metricKey, exemplars pdata.ExemplarSlice) {
+	for _, data := range p.latencyExemplars[key] {
+		if data.traceID.IsEmpty() {
+			// No span fell in the bucket.
+			continue
+		}
+		e := exemplars.AppendEmpty()
+		e.SetTraceID(data.traceID)
+		e.SetSpanID(data.spanID)
+		e.SetDoubleVal(data.value)
+		e.SetTimestamp(data.timestamp)
+	}
+}
+
+// collectErrorMetrics collects the raw error count metrics, writing the data
+// into the given instrumentation library metrics.
+// The errors are split by status.code and status.message, see buildErrorKey.
+func (p *processorImp) collectErrorMetrics(ilm pdata.InstrumentationLibraryMetrics) {
+	for key := range p.errorSum {
+		mErrors := ilm.Metrics().AppendEmpty()
+		mErrors.SetDataType(pdata.MetricDataTypeSum)
+		mErrors.SetName("errors_total")
+		mErrors.Sum().SetIsMonotonic(true)
+		mErrors.Sum().SetAggregationTemporality(p.aggregationTemporality())
+
+		dims, startTime := p.cachedDimensions(p.errorKeyToDimensions, key)
+		dpErrors := mErrors.Sum().DataPoints().AppendEmpty()
+		dpErrors.SetStartTimestamp(startTime)
+		dpErrors.SetTimestamp(pdata.NewTimestampFromTime(time.Now()))
+		dpErrors.SetIntVal(p.errorSum[key])
+
+		dims.CopyTo(dpErrors.Attributes())
 	}
 }
 
@@ -261,14 +511,15 @@ func (p *processorImp) collectCallMetrics(ilm pdata.InstrumentationLibraryMetric
 		mCalls.SetDataType(pdata.MetricDataTypeSum)
 		mCalls.SetName("calls_total")
 		mCalls.Sum().SetIsMonotonic(true)
-		mCalls.Sum().SetAggregationTemporality(pdata.AggregationTemporalityCumulative)
+		mCalls.Sum().SetAggregationTemporality(p.aggregationTemporality())
 
+		dims, startTime := p.cachedDimensions(p.metricKeyToDimensions, key)
 		dpCalls := mCalls.Sum().DataPoints().AppendEmpty()
-		dpCalls.SetStartTimestamp(pdata.NewTimestampFromTime(p.startTime))
+		dpCalls.SetStartTimestamp(startTime)
 		dpCalls.SetTimestamp(pdata.NewTimestampFromTime(time.Now()))
 		dpCalls.SetIntVal(p.callSum[key])
 
-		p.metricKeyToDimensions[key].CopyTo(dpCalls.Attributes())
+		dims.CopyTo(dpCalls.Attributes())
 	}
 }
 
@@ -291,29 +542,41 @@ func (p *processorImp) aggregateMetrics(traces pdata.Traces) {
 }
 
 func (p *processorImp) aggregateMetricsForServiceSpans(rspans pdata.ResourceSpans, serviceName string) {
+	resourceAttr := rspans.Resource().Attributes()
 	ilsSlice := rspans.InstrumentationLibrarySpans()
 	for j := 0; j < ilsSlice.Len(); j++ {
 		ils := ilsSlice.At(j)
 		spans := ils.Spans()
 		for k := 0; k < spans.Len(); k++ {
 			span := spans.At(k)
-			p.aggregateMetricsForSpan(serviceName, span)
+			p.aggregateMetricsForSpan(serviceName, span, resourceAttr)
 		}
 	}
 }
 
-func (p *processorImp) aggregateMetricsForSpan(serviceName string, span pdata.Span) {
+func (p *processorImp) aggregateMetricsForSpan(serviceName string, span pdata.Span, resourceAttr pdata.AttributeMap) {
 	latencyInMilliseconds := float64(span.EndTimestamp()-span.StartTimestamp()) / float64(time.Millisecond.Nanoseconds())
 
 	// Binary search to find the latencyInMilliseconds bucket index.
 	index := sort.SearchFloat64s(p.latencyBounds, latencyInMilliseconds)
 
-	key := buildKey(serviceName, span, p.dimensions)
+	key := buildKey(serviceName, span, p.dimensions, p.resourceDimensions, resourceAttr)
+	var errorKey metricKey
+	isError := span.Status().Code() == pdata.StatusCodeError
+	if isError {
+		errorKey = buildErrorKey(serviceName, span, p.dimensions, p.resourceDimensions, resourceAttr)
+	}
 
 	p.lock.Lock()
-	p.cache(serviceName, span, key)
+	p.cache(serviceName, span, key, resourceAttr)
 	p.updateCallMetrics(key)
+	if isError {
+		p.updateErrorMetrics(serviceName, span, errorKey, resourceAttr)
+	}
 	p.updateLatencyMetrics(key, latencyInMilliseconds, index)
+	if p.config.Exemplars.Enabled {
+		p.updateLatencyExemplars(key, span, latencyInMilliseconds, index)
+	}
 	p.lock.Unlock()
 }
 
@@ -322,6 +585,30 @@ func (p *processorImp) updateCallMetrics(key metricKey) {
 	p.callSum[key]++
 }
 
+// updateErrorMetrics increments the error count for the given error key, caching its dimensions if needed.
+func (p *processorImp) updateErrorMetrics(serviceName string, span pdata.Span, key metricKey, resourceAttr pdata.AttributeMap) {
+	if _, ok := p.errorKeyToDimensions.Get(key); !ok {
+		p.errorKeyToDimensions.Add(key, &cachedDimensions{
+			attributes: buildErrorDimensionKVs(serviceName, span, p.dimensions, p.resourceDimensions, resourceAttr),
+			startTime:  time.Now(),
+		})
+	}
+	p.errorSum[key]++
+}
+
+// updateLatencyExemplars sets the span as the exemplar of the histogram bucket for the given metric key and bucket index.
+func (p *processorImp) updateLatencyExemplars(key metricKey, span pdata.Span, latency float64, index int) {
+	if _, ok := p.latencyExemplars[key]; !ok {
+		p.latencyExemplars[key] = make([]exemplarData, len(p.latencyBounds))
+	}
+	p.latencyExemplars[key][index] = exemplarData{
+		traceID:   span.TraceID(),
+		spanID:    span.SpanID(),
+		value:     latency,
+		timestamp: span.EndTimestamp(),
+	}
+}
+
 // updateLatencyMetrics increments the histogram counts for the given metric key and bucket index.
 func (p *processorImp) updateLatencyMetrics(key metricKey, latency float64, index int) {
 	if _, ok := p.latencyBucketCounts[key]; !ok {
@@ -332,7 +619,7 @@ func (p *processorImp) updateLatencyMetrics(key metricKey, latency float64, inde
 	p.latencyBucketCounts[key][index]++
 }
 
-func buildDimensionKVs(serviceName string, span pdata.Span, optionalDims []Dimension) pdata.AttributeMap {
+func buildDimensionKVs(serviceName string, span pdata.Span, optionalDims []Dimension, resourceDims []Dimension, resourceAttr pdata.AttributeMap) pdata.AttributeMap {
 	dims := pdata.NewAttributeMap()
 	dims.UpsertString(serviceNameKey, serviceName)
 	dims.UpsertString(operationKey, span.Name())
@@ -347,6 +634,22 @@ func buildDimensionKVs(serviceName string, span pdata.Span, optionalDims []Dimen
 			dims.UpsertString(d.Name, *d.Default)
 		}
 	}
+	for _, d := range resourceDims {
+		if attr, ok := resourceAttr.Get(d.Name); ok {
+			dims.Upsert(d.Name, attr)
+		} else if d.Default != nil {
+			dims.UpsertString(d.Name, *d.Default)
+		}
+	}
+	return dims
+}
+
+// buildErrorDimensionKVs builds the dimensions of the error count of a span: those of its metric key except
+// span.kind, with the status message.
+func buildErrorDimensionKVs(serviceName string, span pdata.Span, optionalDims []Dimension, resourceDims []Dimension, resourceAttr pdata.AttributeMap) pdata.AttributeMap {
+	dims := buildDimensionKVs(serviceName, span, optionalDims, resourceDims, resourceAttr)
+	dims.Delete(spanKindKey)
+	dims.UpsertString(statusMessageKey, span.Status().Message())
 	return dims
 }
 
@@ -360,15 +663,34 @@ func concatDimensionValue(metricKeyBuilder *strings.Builder, value string, prefi
 }
 
 // buildKey builds the metric key from the service name and span metadata such as operation, kind, status_code and
-// any additional dimensions the user has configured.
+// any additional dimensions the user has configured, from the span or its resource.
 // The metric key is a simple concatenation of dimension values.
-func buildKey(serviceName string, span pdata.Span, optionalDims []Dimension) metricKey {
+func buildKey(serviceName string, span pdata.Span, optionalDims []Dimension, resourceDims []Dimension, resourceAttr pdata.AttributeMap) metricKey {
 	var metricKeyBuilder strings.Builder
 	concatDimensionValue(&metricKeyBuilder, serviceName, false)
 	concatDimensionValue(&metricKeyBuilder, span.Name(), true)
 	concatDimensionValue(&metricKeyBuilder, span.Kind().String(), true)
 	concatDimensionValue(&metricKeyBuilder, span.Status().Code().String(), true)
+	concatDimensionValues(&metricKeyBuilder, span, optionalDims, resourceDims, resourceAttr)
 
+	k := metricKey(metricKeyBuilder.String())
+	return k
+}
+
+// buildErrorKey builds the key of the error count of a span from the service name, operation, status code and
+// message and any additional dimensions, so that the errors of an operation are split by status.
+func buildErrorKey(serviceName string, span pdata.Span, optionalDims []Dimension, resourceDims []Dimension, resourceAttr pdata.AttributeMap) metricKey {
+	var errorKeyBuilder strings.Builder
+	concatDimensionValue(&errorKeyBuilder, serviceName, false)
+	concatDimensionValue(&errorKeyBuilder, span.Name(), true)
+	concatDimensionValue(&errorKeyBuilder, span.Status().Code().String(), true)
+	concatDimensionValue(&errorKeyBuilder, span.Status().Message(), true)
+	concatDimensionValues(&errorKeyBuilder, span, optionalDims, resourceDims, resourceAttr)
+	return metricKey(errorKeyBuilder.String())
+}
+
+// concatDimensionValues appends the values of the additional dimensions, from the span or its resource, to the key.
+func concatDimensionValues(metricKeyBuilder *strings.Builder, span pdata.Span, optionalDims []Dimension, resourceDims []Dimension, resourceAttr pdata.AttributeMap) {
 	spanAttr := span.Attributes()
 	var value string
 	for _, d := range optionalDims {
@@ -379,19 +701,29 @@ func buildKey(serviceName string, span pdata.Span, optionalDims []Dimension) met
 		if attr, ok := spanAttr.Get(d.Name); ok {
 			value = attr.AsString()
 		}
-		concatDimensionValue(&metricKeyBuilder, value, true)
+		concatDimensionValue(metricKeyBuilder, value, true)
+	}
+	for _, d := range resourceDims {
+		value = ""
+		if d.Default != nil {
+			value = *d.Default
+		}
+		if attr, ok := resourceAttr.Get(d.Name); ok {
+			value = attr.AsString()
+		}
+		concatDimensionValue(metricKeyBuilder, value, true)
 	}
-
-	k := metricKey(metricKeyBuilder.String())
-	return k
 }
 
-// cache the dimension key-value map for the metricKey if there is a cache miss.
-// This enables a lookup of the dimension key-value map when constructing the metric like so:
-//   LabelsMap().InitFromMap(p.metricKeyToDimensions[key])
-func (p *processorImp) cache(serviceName string, span pdata.Span, k metricKey) {
-	if _, ok := p.metricKeyToDimensions[k]; !ok {
-		p.metricKeyToDimensions[k] = buildDimensionKVs(serviceName, span, p.dimensions)
+// cache the dimension key-value map for the metricKey if there is a cache miss, marking it as recently used otherwise.
+// This enables a lookup of the dimension key-value map when constructing the metric.
+// Adding a metricKey to a full cache evicts the least recently used one.
+func (p *processorImp) cache(serviceName string, span pdata.Span, k metricKey, resourceAttr pdata.AttributeMap) {
+	if _, ok := p.metricKeyToDimensions.Get(k); !ok {
+		p.metricKeyToDimensions.Add(k, &cachedDimensions{
+			attributes: buildDimensionKVs(serviceName, span, p.dimensions, p.resourceDimensions, resourceAttr),
+			startTime:  time.Now(),
+		})
 	}
 }
 
@@ -17,9 +17,11 @@ package spanmetricsprocessor
 import (
 	"context"
 	"fmt"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/hashicorp/golang-lru/simplelru"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
@@ -32,6 +34,8 @@ import (
 	"go.opentelemetry.io/collector/model/pdata"
 	conventions "go.opentelemetry.io/collector/model/semconv/v1.5.0"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
 	"google.golang.org/grpc/metadata"
 
 	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/spanmetricsprocessor/mocks"
@@ -257,13 +261,336 @@ func TestMetricKeyCache(t *testing.T) {
 	// Validate
 	require.NoError(t, err)
 
-	origKeyCache := make(map[metricKey]pdata.AttributeMap)
-	for k, v := range p.metricKeyToDimensions {
-		origKeyCache[k] = v
+	origKeyCache := make(map[interface{}]interface{})
+	for _, k := range p.metricKeyToDimensions.Keys() {
+		origKeyCache[k], _ = p.metricKeyToDimensions.Peek(k)
 	}
 	err = p.ConsumeTraces(ctx, traces)
 	require.NoError(t, err)
-	assert.Equal(t, origKeyCache, p.metricKeyToDimensions)
+	assert.Equal(t, len(origKeyCache), p.metricKeyToDimensions.Len())
+	for k, v := range origKeyCache {
+		cached, ok := p.metricKeyToDimensions.Peek(k)
+		require.True(t, ok)
+		assert.Same(t, v, cached, "cached dimensions should be reused")
+	}
+}
+
+func TestMetricKeyCacheEviction(t *testing.T) {
+	// Prepare
+	mexp := &mocks.MetricsExporter{}
+	tcon := &mocks.TracesConsumer{}
+
+	mexp.On("ConsumeMetrics", mock.Anything, mock.Anything).Return(nil)
+	tcon.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+
+	defaultNullValue := "defaultNullValue"
+	p := newProcessorImp(mexp, tcon, &defaultNullValue)
+	core, logs := observer.New(zapcore.DebugLevel)
+	p.logger = zap.New(core)
+	p.config.DimensionsCacheSize = 2
+	cache, err := simplelru.NewLRU(2, p.onEvicted)
+	require.NoError(t, err)
+	p.metricKeyToDimensions = cache
+
+	// Test
+	ctx := metadata.NewIncomingContext(context.Background(), nil)
+	err = p.ConsumeTraces(ctx, buildSampleTrace())
+
+	// Verify
+	require.NoError(t, err)
+	assert.Equal(t, 2, p.metricKeyToDimensions.Len())
+	assert.Len(t, p.callSum, 2, "the data of the evicted metric key should be dropped")
+	assert.Len(t, p.latencyCount, 2)
+	assert.Len(t, p.latencySum, 2)
+	assert.Len(t, p.latencyBucketCounts, 2)
+	for _, k := range p.metricKeyToDimensions.Keys() {
+		assert.Contains(t, p.callSum, k)
+	}
+	// The calls and latencies of the 2 cached keys, and the errors of service-b.
+	assert.Equal(t, 5, p.buildMetrics().MetricCount())
+
+	// The evictions are logged as a warning the first time, at debug level afterwards.
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+	entries := logs.FilterMessageSnippet("Evicted").AllUntimed()
+	require.Len(t, entries, 2)
+	assert.Equal(t, zapcore.WarnLevel, entries[0].Level)
+	assert.Equal(t, int64(1), entries[0].ContextMap()["evicted-series"])
+	assert.Equal(t, int64(2), entries[0].ContextMap()["dimensions-cache-size"])
+	assert.Equal(t, zapcore.DebugLevel, entries[1].Level)
+}
+
+func TestProcessorConsumeTracesDelta(t *testing.T) {
+	// Prepare
+	mexp := &mocks.MetricsExporter{}
+	tcon := &mocks.TracesConsumer{}
+
+	var exported []pdata.Metrics
+	mexp.On("ConsumeMetrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		exported = append(exported, args.Get(1).(pdata.Metrics))
+	}).Return(nil)
+	tcon.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+
+	defaultNullValue := "defaultNullValue"
+	p := newProcessorImp(mexp, tcon, &defaultNullValue)
+	p.config.AggregationTemporality = delta
+
+	// Test
+	ctx := metadata.NewIncomingContext(context.Background(), nil)
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+
+	// Verify
+	require.Len(t, exported, 2)
+	for _, m := range exported {
+		metrics := m.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+		require.Equal(t, 7, metrics.Len())
+		for i := 0; i < metrics.Len(); i++ {
+			metric := metrics.At(i)
+			switch metric.DataType() {
+			case pdata.MetricDataTypeSum:
+				assert.Equal(t, pdata.AggregationTemporalityDelta, metric.Sum().AggregationTemporality())
+				assert.Equal(t, int64(1), metric.Sum().DataPoints().At(0).IntVal(), "the calls of the previous batch shouldn't be accounted")
+			case pdata.MetricDataTypeHistogram:
+				assert.Equal(t, pdata.AggregationTemporalityDelta, metric.Histogram().AggregationTemporality())
+				assert.Equal(t, uint64(1), metric.Histogram().DataPoints().At(0).Count())
+			}
+		}
+	}
+	first := exported[0].ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0)
+	second := exported[1].ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics().At(0).Sum().DataPoints().At(0)
+	assert.LessOrEqual(t, first.Timestamp(), second.StartTimestamp(), "the second data points should start after the first ones")
+}
+
+func TestProcessorFlushesPeriodically(t *testing.T) {
+	// Prepare
+	mexp := &mocks.MetricsExporter{}
+	tcon := &mocks.TracesConsumer{}
+
+	var exportedMetrics int64
+	mexp.On("ConsumeMetrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		atomic.AddInt64(&exportedMetrics, int64(args.Get(1).(pdata.Metrics).MetricCount()))
+	}).Return(nil)
+	tcon.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+
+	defaultNullValue := "defaultNullValue"
+	p := newProcessorImp(mexp, tcon, &defaultNullValue)
+	p.config.AggregationTemporality = delta
+	p.config.MetricsFlushInterval = time.Hour
+	p.startFlushing()
+
+	// Test
+	ctx := metadata.NewIncomingContext(context.Background(), nil)
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+
+	// Verify
+	mexp.AssertNotCalled(t, "ConsumeMetrics", mock.Anything, mock.Anything)
+	tcon.AssertNumberOfCalls(t, "ConsumeTraces", 2)
+
+	// The metrics aggregated since the last flush are emitted on shutdown.
+	require.NoError(t, p.Shutdown(ctx))
+	mexp.AssertNumberOfCalls(t, "ConsumeMetrics", 1)
+	assert.Equal(t, int64(7), atomic.LoadInt64(&exportedMetrics))
+}
+
+func TestProcessorExemplars(t *testing.T) {
+	// Prepare
+	mexp := &mocks.MetricsExporter{}
+	tcon := &mocks.TracesConsumer{}
+
+	var exported pdata.Metrics
+	mexp.On("ConsumeMetrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		exported = args.Get(1).(pdata.Metrics)
+	}).Return(nil)
+	tcon.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+
+	defaultNullValue := "defaultNullValue"
+	p := newProcessorImp(mexp, tcon, &defaultNullValue)
+	p.config.Exemplars.Enabled = true
+
+	traces := buildSampleTrace()
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4})
+	span := traces.ResourceSpans().At(1).InstrumentationLibrarySpans().At(0).Spans().At(0)
+	span.SetTraceID(traceID)
+	span.SetSpanID(pdata.NewSpanID([8]byte{5, 6, 7, 8}))
+
+	// Test
+	ctx := metadata.NewIncomingContext(context.Background(), nil)
+	require.NoError(t, p.ConsumeTraces(ctx, traces))
+
+	// Verify
+	exemplars := latencyExemplars(exported)
+	require.Len(t, exemplars, 1, "only the span with a trace ID should be an exemplar")
+	assert.Equal(t, traceID, exemplars[0].TraceID())
+	assert.Equal(t, pdata.NewSpanID([8]byte{5, 6, 7, 8}), exemplars[0].SpanID())
+	assert.Equal(t, sampleLatency, exemplars[0].DoubleVal())
+	assert.Equal(t, span.EndTimestamp(), exemplars[0].Timestamp())
+
+	// The cumulative histograms are exported again, without the exemplars already reported.
+	require.NoError(t, p.exportMetrics(ctx))
+	assert.Equal(t, 7, exported.MetricCount())
+	assert.Empty(t, latencyExemplars(exported))
+}
+
+// latencyExemplars returns the exemplars of the latency histograms of the metrics.
+func latencyExemplars(md pdata.Metrics) []pdata.Exemplar {
+	var exemplars []pdata.Exemplar
+	metrics := md.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	for i := 0; i < metrics.Len(); i++ {
+		if metrics.At(i).DataType() != pdata.MetricDataTypeHistogram {
+			continue
+		}
+		dp := metrics.At(i).Histogram().DataPoints().At(0)
+		for j := 0; j < dp.Exemplars().Len(); j++ {
+			exemplars = append(exemplars, dp.Exemplars().At(j))
+		}
+	}
+	return exemplars
+}
+
+func TestProcessorErrorsSplitByStatus(t *testing.T) {
+	// Prepare
+	mexp := &mocks.MetricsExporter{}
+	tcon := &mocks.TracesConsumer{}
+
+	var exported pdata.Metrics
+	mexp.On("ConsumeMetrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		exported = args.Get(1).(pdata.Metrics)
+	}).Return(nil)
+	tcon.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+
+	defaultNullValue := "defaultNullValue"
+	p := newProcessorImp(mexp, tcon, &defaultNullValue)
+
+	traces := pdata.NewTraces()
+	initServiceSpans(serviceSpans{
+		serviceName: "service-a",
+		spans: []span{
+			{operation: "/ping", kind: pdata.SpanKindServer, statusCode: pdata.StatusCodeError},
+			{operation: "/ping", kind: pdata.SpanKindClient, statusCode: pdata.StatusCodeError},
+			{operation: "/ping", kind: pdata.SpanKindServer, statusCode: pdata.StatusCodeError},
+			{operation: "/ping", kind: pdata.SpanKindServer, statusCode: pdata.StatusCodeOk},
+		},
+	}, traces.ResourceSpans().AppendEmpty())
+	spans := traces.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans()
+	spans.At(0).Status().SetMessage("timeout")
+	spans.At(1).Status().SetMessage("timeout")
+	spans.At(2).Status().SetMessage("connection refused")
+
+	// Test
+	ctx := metadata.NewIncomingContext(context.Background(), nil)
+	require.NoError(t, p.ConsumeTraces(ctx, traces))
+
+	// Verify
+	errorCounts := make(map[string]int64)
+	metrics := exported.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	for i := 0; i < metrics.Len(); i++ {
+		if metrics.At(i).Name() != "errors_total" {
+			continue
+		}
+		dp := metrics.At(i).Sum().DataPoints().At(0)
+		message, ok := dp.Attributes().Get(statusMessageKey)
+		require.True(t, ok)
+		errorCounts[message.StringVal()] = dp.IntVal()
+	}
+	assert.Equal(t, map[string]int64{"timeout": 2, "connection refused": 1}, errorCounts,
+		"the errors of the operation should be split by status message, whatever the span kind")
+}
+
+func TestProcessorResourceDimensions(t *testing.T) {
+	// Prepare
+	mexp := &mocks.MetricsExporter{}
+	tcon := &mocks.TracesConsumer{}
+
+	var exported pdata.Metrics
+	mexp.On("ConsumeMetrics", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		exported = args.Get(1).(pdata.Metrics)
+	}).Return(nil)
+	tcon.On("ConsumeTraces", mock.Anything, mock.Anything).Return(nil)
+
+	defaultNullValue := "defaultNullValue"
+	defaultEnvironment := "unknown"
+	p := newProcessorImp(mexp, tcon, &defaultNullValue)
+	p.resourceDimensions = []Dimension{
+		{"deployment.environment", &defaultEnvironment},
+		{"k8s.namespace.name", nil},
+	}
+
+	traces := buildSampleTrace()
+	traces.ResourceSpans().At(0).Resource().Attributes().InsertString("deployment.environment", "production")
+
+	// Test
+	ctx := metadata.NewIncomingContext(context.Background(), nil)
+	require.NoError(t, p.ConsumeTraces(ctx, traces))
+
+	// Verify
+	environments := make(map[string]string)
+	metrics := exported.ResourceMetrics().At(0).InstrumentationLibraryMetrics().At(0).Metrics()
+	for i := 0; i < metrics.Len(); i++ {
+		if metrics.At(i).DataType() != pdata.MetricDataTypeSum {
+			continue
+		}
+		attrs := metrics.At(i).Sum().DataPoints().At(0).Attributes()
+		service, _ := attrs.Get(serviceNameKey)
+		environment, ok := attrs.Get("deployment.environment")
+		require.True(t, ok)
+		environments[service.StringVal()] = environment.StringVal()
+		_, ok = attrs.Get("k8s.namespace.name")
+		assert.False(t, ok, "a resource dimension without a default shouldn't be added when missing")
+	}
+	assert.Equal(t, map[string]string{"service-a": "production", "service-b": "unknown"}, environments)
+}
+
+func TestProcessorInvalidConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name         string
+		modifyConfig func(cfg *Config)
+		wantErrMsg   string
+	}{
+		{
+			name: "invalid aggregation temporality",
+			modifyConfig: func(cfg *Config) {
+				cfg.AggregationTemporality = "AGGREGATION_TEMPORALITY_UNSPECIFIED"
+			},
+			wantErrMsg: "invalid aggregation_temporality \"AGGREGATION_TEMPORALITY_UNSPECIFIED\", must be one of AGGREGATION_TEMPORALITY_CUMULATIVE or AGGREGATION_TEMPORALITY_DELTA",
+		},
+		{
+			name: "invalid dimensions cache size",
+			modifyConfig: func(cfg *Config) {
+				cfg.DimensionsCacheSize = 0
+			},
+			wantErrMsg: "invalid dimensions_cache_size 0: Must provide a positive size",
+		},
+		{
+			name: "duplicate resource dimension",
+			modifyConfig: func(cfg *Config) {
+				cfg.Dimensions = []Dimension{{Name: "deployment.environment"}}
+				cfg.ResourceDimensions = []Dimension{{Name: "deployment.environment"}}
+			},
+			wantErrMsg: "duplicate dimension name deployment.environment",
+		},
+		{
+			name: "both metrics exporter and receiver",
+			modifyConfig: func(cfg *Config) {
+				cfg.MetricsExporter = "otlp"
+				cfg.MetricsReceiver = "spanmetrics"
+			},
+			wantErrMsg: "metrics_exporter and metrics_receiver are mutually exclusive",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Prepare
+			cfg := NewFactory().CreateDefaultConfig().(*Config)
+			tc.modifyConfig(cfg)
+
+			// Test
+			p, err := newProcessor(zap.NewNop(), cfg, consumertest.NewNop())
+
+			// Verify
+			assert.Nil(t, p)
+			assert.EqualError(t, err, tc.wantErrMsg)
+		})
+	}
 }
 
 func BenchmarkProcessorConsumeTraces(b *testing.B) {
@@ -288,16 +615,19 @@ func BenchmarkProcessorConsumeTraces(b *testing.B) {
 
 func newProcessorImp(mexp *mocks.MetricsExporter, tcon *mocks.TracesConsumer, defaultNullValue *string) *processorImp {
 	defaultNotInSpanAttrVal := "defaultNotInSpanAttrVal"
-	return &processorImp{
+	p := &processorImp{
 		logger:          zap.NewNop(),
-		metricsExporter: mexp,
+		config:          Config{AggregationTemporality: cumulative},
+		metricsConsumer: mexp,
 		nextConsumer:    tcon,
 
 		startTime:           time.Now(),
 		callSum:             make(map[metricKey]int64),
+		errorSum:            make(map[metricKey]int64),
 		latencySum:          make(map[metricKey]float64),
 		latencyCount:        make(map[metricKey]uint64),
 		latencyBucketCounts: make(map[metricKey][]uint64),
+		latencyExemplars:    make(map[metricKey][]exemplarData),
 		latencyBounds:       defaultLatencyHistogramBucketsMs,
 		dimensions: []Dimension{
 			// Set nil defaults to force a lookup for the attribute in the span.
@@ -313,16 +643,19 @@ func newProcessorImp(mexp *mocks.MetricsExporter, tcon *mocks.TracesConsumer, de
 			// Leave the default value unset to test that this dimension should not be added to the metric.
 			{notInSpanAttrName1, nil},
 		},
-		metricKeyToDimensions: make(map[metricKey]pdata.AttributeMap),
 	}
+	p.metricKeyToDimensions, _ = simplelru.NewLRU(defaultDimensionsCacheSize, p.onEvicted)
+	p.errorKeyToDimensions, _ = simplelru.NewLRU(defaultDimensionsCacheSize, p.onErrorEvicted)
+	return p
 }
 
 // verifyConsumeMetricsInput verifies the input of the ConsumeMetrics call from this processor.
 // This is the best point to verify the computed metrics from spans are as expected.
 func verifyConsumeMetricsInput(input pdata.Metrics, t *testing.T) bool {
-	require.Equal(t, 6, input.MetricCount(),
+	require.Equal(t, 7, input.MetricCount(),
 		"Should be 3 for each of call count and latency. Each group of 3 metrics is made of: "+
-			"service-a (server kind) -> service-a (client kind) -> service-b (service kind)",
+			"service-a (server kind) -> service-a (client kind) -> service-b (service kind). "+
+			"Followed by 1 error count for service-b",
 	)
 
 	rm := input.ResourceMetrics()
@@ -333,7 +666,7 @@ func verifyConsumeMetricsInput(input pdata.Metrics, t *testing.T) bool {
 	assert.Equal(t, "spanmetricsprocessor", ilm.At(0).InstrumentationLibrary().Name())
 
 	m := ilm.At(0).Metrics()
-	require.Equal(t, 6, m.Len())
+	require.Equal(t, 7, m.Len())
 
 	seenMetricIDs := make(map[metricID]bool)
 	mi := 0
@@ -357,8 +690,8 @@ func verifyConsumeMetricsInput(input pdata.Metrics, t *testing.T) bool {
 	}
 
 	seenMetricIDs = make(map[metricID]bool)
-	// The remaining metrics are for latency.
-	for ; mi < m.Len(); mi++ {
+	// The next 3 metrics are for latency.
+	for ; mi < 6; mi++ {
 		assert.Equal(t, "latency", m.At(mi).Name())
 
 		data := m.At(mi).Histogram()
@@ -390,6 +723,24 @@ func verifyConsumeMetricsInput(input pdata.Metrics, t *testing.T) bool {
 		}
 		verifyMetricLabels(dp, t, seenMetricIDs)
 	}
+
+	// The last metric is for the error count.
+	assert.Equal(t, "errors_total", m.At(mi).Name())
+	data := m.At(mi).Sum()
+	assert.Equal(t, pdata.AggregationTemporalityCumulative, data.AggregationTemporality())
+	assert.True(t, data.IsMonotonic())
+	require.Equal(t, 1, data.DataPoints().Len())
+	dp := data.DataPoints().At(0)
+	assert.Equal(t, int64(1), dp.IntVal(), "There should only be one error for service-b")
+	statusCode, ok := dp.Attributes().Get(statusCodeKey)
+	require.True(t, ok)
+	assert.Equal(t, pdata.StatusCodeError.String(), statusCode.StringVal())
+	statusMessage, ok := dp.Attributes().Get(statusMessageKey)
+	require.True(t, ok)
+	assert.Equal(t, "", statusMessage.StringVal())
+	_, ok = dp.Attributes().Get(spanKindKey)
+	assert.False(t, ok, "errors should not be split by span kind")
+	verifyMetricLabels(dp, t, make(map[metricID]bool))
 	return true
 }
 
@@ -415,6 +766,8 @@ func verifyMetricLabels(dp metricDataPoint, t *testing.T, seenMetricIDs map[metr
 			mID.kind = v.StringVal()
 		case statusCodeKey:
 			mID.statusCode = v.StringVal()
+		case statusMessageKey:
+			// Only a dimension of the error counts, checked by the caller.
 		case notInSpanAttrName1:
 			assert.Fail(t, notInSpanAttrName1+" should not be in this metric")
 		default:
@@ -431,9 +784,10 @@ func verifyMetricLabels(dp metricDataPoint, t *testing.T, seenMetricIDs map[metr
 }
 
 // buildSampleTrace builds the following trace:
-//   service-a/ping (server) ->
-//     service-a/ping (client) ->
-//       service-b/ping (server)
+//
+//	service-a/ping (server) ->
+//	  service-a/ping (client) ->
+//	    service-b/ping (server)
 func buildSampleTrace() pdata.Traces {
 	traces := pdata.NewTraces()
 
@@ -515,11 +869,11 @@ func newOTLPExporters(t *testing.T) (*otlpexporter.Config, component.MetricsExpo
 func TestBuildKey(t *testing.T) {
 	span0 := pdata.NewSpan()
 	span0.SetName("c")
-	k0 := buildKey("ab", span0, nil)
+	k0 := buildKey("ab", span0, nil, nil, pdata.NewAttributeMap())
 
 	span1 := pdata.NewSpan()
 	span1.SetName("bc")
-	k1 := buildKey("a", span1, nil)
+	k1 := buildKey("a", span1, nil, nil, pdata.NewAttributeMap())
 
 	assert.NotEqual(t, k0, k1)
 }
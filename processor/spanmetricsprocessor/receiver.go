@@ -0,0 +1,202 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spanmetricsprocessor
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer"
+	"go.opentelemetry.io/collector/consumer/consumererror"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.opentelemetry.io/collector/receiver/receiverhelper"
+	"go.uber.org/zap"
+)
+
+// metricsReceivers are the running spanmetrics receivers, keyed by receiver ID, and the final flushes of the
+// processors pushing to them. Receivers are registered on Start and unregistered on Shutdown, so that a receiver
+// that is built but never started, e.g. when building the pipelines fails, doesn't linger. Processors start before
+// receivers, so they look the receiver up whenever they push metrics.
+var metricsReceivers = struct {
+	sync.Mutex
+	receivers map[config.ComponentID]*metricsReceiver
+	flushes   map[config.ComponentID][]*receiverFlush
+}{
+	receivers: make(map[config.ComponentID]*metricsReceiver),
+	flushes:   make(map[config.ComponentID][]*receiverFlush),
+}
+
+// receiverFlush is the final flush of a processor pushing to a spanmetrics receiver.
+type receiverFlush struct {
+	flush func(context.Context) error
+}
+
+// NewReceiverFactory creates a factory for the spanmetrics receiver, which feeds the metrics of a spanmetrics
+// processor configured with metrics_receiver into the metrics pipelines it's part of.
+func NewReceiverFactory() component.ReceiverFactory {
+	return receiverhelper.NewFactory(
+		typeStr,
+		createDefaultReceiverConfig,
+		receiverhelper.WithMetrics(createMetricsReceiver),
+	)
+}
+
+func createDefaultReceiverConfig() config.Receiver {
+	cfg := config.NewReceiverSettings(config.NewID(typeStr))
+	return &cfg
+}
+
+func createMetricsReceiver(_ context.Context, _ component.ReceiverCreateSettings, cfg config.Receiver, nextConsumer consumer.Metrics) (component.MetricsReceiver, error) {
+	return &metricsReceiver{id: cfg.ID(), nextConsumer: nextConsumer}, nil
+}
+
+// lookupMetricsReceiver returns the given spanmetrics receiver, if it's running.
+func lookupMetricsReceiver(id config.ComponentID) (*metricsReceiver, bool) {
+	metricsReceivers.Lock()
+	defer metricsReceivers.Unlock()
+
+	r, ok := metricsReceivers.receivers[id]
+	return r, ok
+}
+
+// addReceiverFlush registers the final flush of a processor pushing to the given receiver, called when the receiver
+// shuts down. The returned function unregisters it.
+func addReceiverFlush(id config.ComponentID, flush func(context.Context) error) func() {
+	metricsReceivers.Lock()
+	defer metricsReceivers.Unlock()
+
+	f := &receiverFlush{flush: flush}
+	metricsReceivers.flushes[id] = append(metricsReceivers.flushes[id], f)
+	return func() {
+		metricsReceivers.Lock()
+		defer metricsReceivers.Unlock()
+
+		flushes := metricsReceivers.flushes[id]
+		for i := range flushes {
+			if flushes[i] == f {
+				metricsReceivers.flushes[id] = append(flushes[:i:i], flushes[i+1:]...)
+				break
+			}
+		}
+		if len(metricsReceivers.flushes[id]) == 0 {
+			delete(metricsReceivers.flushes, id)
+		}
+	}
+}
+
+// metricsReceiver doesn't receive anything by itself, the spanmetrics processors referencing it push their metrics
+// through it to its metrics pipelines.
+//
+// Receivers are shut down before processors, while the metrics pipelines are still running: the processors are
+// flushed when the receiver shuts down, and the metrics they push afterwards are dropped.
+type metricsReceiver struct {
+	id           config.ComponentID
+	nextConsumer consumer.Metrics
+
+	// lock is held for writing on shutdown, so that no metrics are being pushed once it's done.
+	lock    sync.RWMutex
+	stopped bool
+}
+
+var _ consumer.Metrics = (*metricsReceiver)(nil)
+
+// Capabilities implements the consumer.Metrics interface.
+func (r *metricsReceiver) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeMetrics implements the consumer.Metrics interface. The metrics are dropped once the receiver is shut down.
+func (r *metricsReceiver) ConsumeMetrics(ctx context.Context, md pdata.Metrics) error {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	if r.stopped {
+		return nil
+	}
+	return r.nextConsumer.ConsumeMetrics(ctx, md)
+}
+
+// Start implements the component.Component interface.
+func (r *metricsReceiver) Start(context.Context, component.Host) error {
+	metricsReceivers.Lock()
+	defer metricsReceivers.Unlock()
+
+	if _, ok := metricsReceivers.receivers[r.id]; ok {
+		return fmt.Errorf("spanmetrics receiver %q already exists", r.id.String())
+	}
+	metricsReceivers.receivers[r.id] = r
+	return nil
+}
+
+// Shutdown implements the component.Component interface. The processors pushing to the receiver are flushed if it
+// was started.
+func (r *metricsReceiver) Shutdown(ctx context.Context) error {
+	metricsReceivers.Lock()
+	started := metricsReceivers.receivers[r.id] == r
+	var flushes []*receiverFlush
+	if started {
+		flushes = metricsReceivers.flushes[r.id]
+		delete(metricsReceivers.flushes, r.id)
+	}
+	metricsReceivers.Unlock()
+
+	var errs []error
+	for _, f := range flushes {
+		if err := f.flush(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	metricsReceivers.Lock()
+	if started {
+		delete(metricsReceivers.receivers, r.id)
+	}
+	metricsReceivers.Unlock()
+
+	r.lock.Lock()
+	r.stopped = true
+	r.lock.Unlock()
+	return consumererror.Combine(errs)
+}
+
+// receiverConsumer pushes the metrics of a processor to the spanmetrics receiver with the given ID. The metrics are
+// dropped while that receiver isn't running.
+type receiverConsumer struct {
+	id       config.ComponentID
+	logger   *zap.Logger
+	warnOnce sync.Once
+}
+
+var _ consumer.Metrics = (*receiverConsumer)(nil)
+
+// Capabilities implements the consumer.Metrics interface.
+func (c *receiverConsumer) Capabilities() consumer.Capabilities {
+	return consumer.Capabilities{MutatesData: false}
+}
+
+// ConsumeMetrics implements the consumer.Metrics interface.
+func (c *receiverConsumer) ConsumeMetrics(ctx context.Context, md pdata.Metrics) error {
+	r, ok := lookupMetricsReceiver(c.id)
+	if !ok {
+		c.warnOnce.Do(func() {
+			c.logger.Warn("Dropping span metrics, the metrics receiver isn't running; it must be present in a metrics pipeline",
+				zap.String("spanmetrics-receiver", c.id.String()))
+		})
+		return nil
+	}
+	return r.ConsumeMetrics(ctx, md)
+}
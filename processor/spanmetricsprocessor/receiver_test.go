@@ -0,0 +1,197 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package spanmetricsprocessor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.uber.org/zap"
+)
+
+func TestProcessorPushesMetricsToReceiver(t *testing.T) {
+	// Prepare
+	ctx := context.Background()
+	sink := new(consumertest.MetricsSink)
+	receiverFactory := NewReceiverFactory()
+	receiverCfg := receiverFactory.CreateDefaultConfig()
+	receiverCfg.SetIDName("pipeline")
+	receiver, err := receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, sink)
+	require.NoError(t, err)
+	defer receiver.Shutdown(ctx)
+
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	cfg.MetricsReceiver = "spanmetrics/pipeline"
+	p, err := newProcessor(zap.NewNop(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+
+	// Test
+	require.NoError(t, p.Start(ctx, componenttest.NewNopHost()))
+	require.NoError(t, receiver.Start(ctx, componenttest.NewNopHost()))
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+
+	// Verify
+	require.Len(t, sink.AllMetrics(), 1)
+	assert.Equal(t, 7, sink.AllMetrics()[0].MetricCount())
+	require.NoError(t, p.Shutdown(ctx))
+}
+
+func TestMetricsReceiverShutdown(t *testing.T) {
+	// Prepare
+	ctx := context.Background()
+	receiverFactory := NewReceiverFactory()
+	receiverCfg := receiverFactory.CreateDefaultConfig()
+	receiver, err := receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, consumertest.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, receiver.Start(ctx, componenttest.NewNopHost()))
+
+	duplicate, err := receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, consumertest.NewNop())
+	require.NoError(t, err)
+	assert.EqualError(t, duplicate.Start(ctx, componenttest.NewNopHost()), "spanmetrics receiver \"spanmetrics\" already exists")
+	require.NoError(t, duplicate.Shutdown(ctx))
+	_, ok := lookupMetricsReceiver(config.NewID(typeStr))
+	assert.True(t, ok, "shutting down the duplicate should leave the running receiver registered")
+
+	// Test
+	require.NoError(t, receiver.Shutdown(ctx))
+
+	// Verify
+	_, ok = lookupMetricsReceiver(config.NewID(typeStr))
+	assert.False(t, ok, "the receiver should be unregistered on shutdown")
+	receiver, err = receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, consumertest.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, receiver.Start(ctx, componenttest.NewNopHost()))
+	assert.NoError(t, receiver.Shutdown(ctx))
+}
+
+func TestMetricsReceiverNotStarted(t *testing.T) {
+	// Prepare
+	ctx := context.Background()
+	sink := new(consumertest.MetricsSink)
+	receiverFactory := NewReceiverFactory()
+	receiverCfg := receiverFactory.CreateDefaultConfig()
+	receiverCfg.SetIDName("reload")
+
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	cfg.MetricsReceiver = "spanmetrics/reload"
+	cfg.MetricsFlushInterval = time.Hour
+	p, err := newProcessor(zap.NewNop(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, p.Start(ctx, componenttest.NewNopHost()))
+	defer p.Shutdown(ctx)
+
+	// Test: a receiver built by a failed attempt to build the pipelines is never started.
+	_, err = receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, consumertest.NewNop())
+	require.NoError(t, err)
+
+	// Verify
+	_, ok := lookupMetricsReceiver(config.NewIDWithName(typeStr, "reload"))
+	assert.False(t, ok, "a receiver should only be registered once started")
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+
+	receiver, err := receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, sink)
+	require.NoError(t, err)
+	require.NoError(t, receiver.Start(ctx, componenttest.NewNopHost()))
+	require.NoError(t, receiver.Shutdown(ctx))
+	require.Len(t, sink.AllMetrics(), 1, "the processor should push to the receiver that was started")
+	assert.Equal(t, 7, sink.AllMetrics()[0].MetricCount())
+}
+
+func TestProcessorDropsMetricsWithoutReceiver(t *testing.T) {
+	// Prepare
+	ctx := context.Background()
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	cfg.MetricsReceiver = "spanmetrics/missing"
+	next := new(consumertest.TracesSink)
+	p, err := newProcessor(zap.NewNop(), cfg, next)
+	require.NoError(t, err)
+	require.NoError(t, p.Start(ctx, componenttest.NewNopHost()))
+
+	// Test
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+
+	// Verify
+	assert.Equal(t, 1, len(next.AllTraces()), "the traces should still be forwarded")
+	require.NoError(t, p.Shutdown(ctx))
+	metricsReceivers.Lock()
+	defer metricsReceivers.Unlock()
+	assert.NotContains(t, metricsReceivers.flushes, config.NewIDWithName(typeStr, "missing"), "the flush should be unregistered on shutdown")
+}
+
+func TestProcessorFlushedOnReceiverShutdown(t *testing.T) {
+	// Prepare
+	ctx := context.Background()
+	sink := new(consumertest.MetricsSink)
+	receiverFactory := NewReceiverFactory()
+	receiverCfg := receiverFactory.CreateDefaultConfig()
+	receiverCfg.SetIDName("shutdown")
+	receiver, err := receiverFactory.CreateMetricsReceiver(ctx, componenttest.NewNopReceiverCreateSettings(), receiverCfg, sink)
+	require.NoError(t, err)
+
+	cfg := NewFactory().CreateDefaultConfig().(*Config)
+	cfg.MetricsReceiver = "spanmetrics/shutdown"
+	cfg.MetricsFlushInterval = time.Hour
+	p, err := newProcessor(zap.NewNop(), cfg, consumertest.NewNop())
+	require.NoError(t, err)
+	require.NoError(t, p.Start(ctx, componenttest.NewNopHost()))
+	require.NoError(t, receiver.Start(ctx, componenttest.NewNopHost()))
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+	assert.Empty(t, sink.AllMetrics(), "the metrics should wait for the flush interval")
+
+	// Test: the collector shuts down receivers before processors.
+	require.NoError(t, receiver.Shutdown(ctx))
+
+	// Verify
+	_, ok := lookupMetricsReceiver(config.NewIDWithName(typeStr, "shutdown"))
+	assert.False(t, ok, "the receiver should be unregistered on shutdown")
+	require.Len(t, sink.AllMetrics(), 1, "the processor should be flushed while the metrics pipeline still runs")
+	assert.Equal(t, 7, sink.AllMetrics()[0].MetricCount())
+
+	// The metrics of the spans received afterwards don't reach the metrics pipeline, which may be shut down.
+	require.NoError(t, p.ConsumeTraces(ctx, buildSampleTrace()))
+	require.NoError(t, p.Shutdown(ctx))
+	assert.Len(t, sink.AllMetrics(), 1)
+}
+
+func TestProcessorStartWithMetricsReceiver(t *testing.T) {
+	for _, tc := range []struct {
+		name            string
+		metricsReceiver string
+		wantErrorMsg    string
+	}{
+		{"receiver of another type", "otlp", "invalid metrics_receiver \"otlp\", must be a spanmetrics receiver"},
+		{"invalid receiver name", "spanmetrics/", "invalid metrics_receiver \"spanmetrics/\": name part must be specified after / in type/name key"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			// Prepare
+			cfg := NewFactory().CreateDefaultConfig().(*Config)
+			cfg.MetricsReceiver = tc.metricsReceiver
+			p, err := newProcessor(zap.NewNop(), cfg, consumertest.NewNop())
+			require.NoError(t, err)
+
+			// Test
+			err = p.Start(context.Background(), componenttest.NewNopHost())
+
+			// Verify
+			assert.EqualError(t, err, tc.wantErrorMsg)
+		})
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+func getNewAndPolicy(logger *zap.Logger, cfg *AndCfg) (sampling.PolicyEvaluator, error) {
+	if len(cfg.SubPolicyCfg) == 0 {
+		return nil, errors.New("and policy requires at least one sub-policy")
+	}
+	subpolicies := make([]sampling.PolicyEvaluator, 0, len(cfg.SubPolicyCfg))
+	for i := range cfg.SubPolicyCfg {
+		subCfg := &cfg.SubPolicyCfg[i]
+		eval, err := getSharedPolicyEvaluator(logger, &subCfg.sharedPolicyCfg)
+		if err != nil {
+			return nil, fmt.Errorf("and sub-policy %q: %w", subCfg.Name, err)
+		}
+		subpolicies = append(subpolicies, eval)
+	}
+	return sampling.NewAnd(logger, subpolicies), nil
+}
@@ -0,0 +1,104 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"errors"
+	"fmt"
+
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+func getNewCompositePolicy(logger *zap.Logger, cfg *CompositeCfg) (sampling.PolicyEvaluator, error) {
+	if cfg.MaxTotalSpansPerSecond <= 0 {
+		return nil, errors.New("composite policy requires a positive max_total_spans_per_second")
+	}
+	if len(cfg.SubPolicyCfg) == 0 {
+		return nil, errors.New("composite policy requires at least one sub-policy")
+	}
+	allocations, err := getRateAllocations(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	params := make([]sampling.SubPolicyEvalParams, 0, len(cfg.SubPolicyCfg))
+	for i := range cfg.SubPolicyCfg {
+		subCfg := &cfg.SubPolicyCfg[i]
+		eval, err := getCompositeSubPolicyEvaluator(logger, subCfg)
+		if err != nil {
+			return nil, fmt.Errorf("composite sub-policy %q: %w", subCfg.Name, err)
+		}
+		params = append(params, sampling.SubPolicyEvalParams{
+			Evaluator:         eval,
+			MaxSpansPerSecond: allocations[i],
+		})
+	}
+	return sampling.NewComposite(logger, cfg.MaxTotalSpansPerSecond, params), nil
+}
+
+func getCompositeSubPolicyEvaluator(logger *zap.Logger, cfg *CompositeSubPolicyCfg) (sampling.PolicyEvaluator, error) {
+	if cfg.Type == And {
+		return withInvert(logger, cfg.Invert)(getNewAndPolicy(logger, &cfg.AndCfg))
+	}
+	return getSharedPolicyEvaluator(logger, &cfg.sharedPolicyCfg)
+}
+
+// getRateAllocations returns the spans per second allocated to every
+// sub-policy, by index. The budget left over by the rate allocations is shared
+// equally by the sub-policies without an allocation.
+func getRateAllocations(cfg *CompositeCfg) ([]int64, error) {
+	indexes := make(map[string]int, len(cfg.SubPolicyCfg))
+	for i, subCfg := range cfg.SubPolicyCfg {
+		if _, found := indexes[subCfg.Name]; found {
+			return nil, fmt.Errorf("duplicate composite sub-policy name %q", subCfg.Name)
+		}
+		indexes[subCfg.Name] = i
+	}
+
+	percents := make([]int64, len(cfg.SubPolicyCfg))
+	allocated := make([]bool, len(cfg.SubPolicyCfg))
+	var totalPercent int64
+	for _, ra := range cfg.RateAllocation {
+		i, found := indexes[ra.Policy]
+		if !found {
+			return nil, fmt.Errorf("rate_allocation refers to unknown composite sub-policy %q", ra.Policy)
+		}
+		if allocated[i] {
+			return nil, fmt.Errorf("duplicate rate_allocation of composite sub-policy %q", ra.Policy)
+		}
+		if ra.Percent <= 0 || ra.Percent > 100 {
+			return nil, fmt.Errorf("rate_allocation percent of composite sub-policy %q must be between 1 and 100", ra.Policy)
+		}
+		percents[i] = ra.Percent
+		allocated[i] = true
+		totalPercent += ra.Percent
+	}
+	if totalPercent > 100 {
+		return nil, errors.New("rate_allocation percentages of the composite policy must not exceed 100")
+	}
+
+	unallocated := int64(len(cfg.SubPolicyCfg) - len(cfg.RateAllocation))
+	allocations := make([]int64, len(cfg.SubPolicyCfg))
+	for i := range allocations {
+		if allocated[i] {
+			allocations[i] = cfg.MaxTotalSpansPerSecond * percents[i] / 100
+		} else {
+			allocations[i] = cfg.MaxTotalSpansPerSecond * (100 - totalPercent) / 100 / unallocated
+		}
+	}
+	return allocations, nil
+}
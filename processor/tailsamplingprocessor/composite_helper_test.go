@@ -0,0 +1,175 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+func newCompositeSubPolicy(name string, policyType PolicyType) CompositeSubPolicyCfg {
+	return CompositeSubPolicyCfg{sharedPolicyCfg: sharedPolicyCfg{Name: name, Type: policyType}}
+}
+
+func TestGetRateAllocations(t *testing.T) {
+	cfg := &CompositeCfg{
+		MaxTotalSpansPerSecond: 1000,
+		SubPolicyCfg: []CompositeSubPolicyCfg{
+			newCompositeSubPolicy("errors", AlwaysSample),
+			newCompositeSubPolicy("slow", AlwaysSample),
+			newCompositeSubPolicy("rest", AlwaysSample),
+		},
+		RateAllocation: []RateAllocationCfg{{Policy: "errors", Percent: 50}},
+	}
+	allocations, err := getRateAllocations(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{500, 250, 250}, allocations)
+
+	cfg.RateAllocation = append(cfg.RateAllocation, RateAllocationCfg{Policy: "slow", Percent: 30}, RateAllocationCfg{Policy: "rest", Percent: 20})
+	allocations, err = getRateAllocations(cfg)
+	require.NoError(t, err)
+	assert.Equal(t, []int64{500, 300, 200}, allocations)
+}
+
+func TestGetRateAllocationsErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		subPolicies []CompositeSubPolicyCfg
+		allocations []RateAllocationCfg
+		err         string
+	}{
+		{
+			name:        "unknown policy",
+			subPolicies: []CompositeSubPolicyCfg{newCompositeSubPolicy("errors", AlwaysSample)},
+			allocations: []RateAllocationCfg{{Policy: "slow", Percent: 50}},
+			err:         `rate_allocation refers to unknown composite sub-policy "slow"`,
+		},
+		{
+			name:        "duplicate policy name",
+			subPolicies: []CompositeSubPolicyCfg{newCompositeSubPolicy("errors", AlwaysSample), newCompositeSubPolicy("errors", AlwaysSample)},
+			err:         `duplicate composite sub-policy name "errors"`,
+		},
+		{
+			name:        "duplicate allocation",
+			subPolicies: []CompositeSubPolicyCfg{newCompositeSubPolicy("errors", AlwaysSample)},
+			allocations: []RateAllocationCfg{{Policy: "errors", Percent: 50}, {Policy: "errors", Percent: 10}},
+			err:         `duplicate rate_allocation of composite sub-policy "errors"`,
+		},
+		{
+			name:        "invalid percent",
+			subPolicies: []CompositeSubPolicyCfg{newCompositeSubPolicy("errors", AlwaysSample)},
+			allocations: []RateAllocationCfg{{Policy: "errors", Percent: 0}},
+			err:         `rate_allocation percent of composite sub-policy "errors" must be between 1 and 100`,
+		},
+		{
+			name:        "over allocated",
+			subPolicies: []CompositeSubPolicyCfg{newCompositeSubPolicy("errors", AlwaysSample), newCompositeSubPolicy("slow", AlwaysSample)},
+			allocations: []RateAllocationCfg{{Policy: "errors", Percent: 60}, {Policy: "slow", Percent: 60}},
+			err:         "rate_allocation percentages of the composite policy must not exceed 100",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := getRateAllocations(&CompositeCfg{
+				MaxTotalSpansPerSecond: 100,
+				SubPolicyCfg:           tt.subPolicies,
+				RateAllocation:         tt.allocations,
+			})
+			assert.EqualError(t, err, tt.err)
+		})
+	}
+}
+
+func newTraceData(status pdata.StatusCode, service string) *sampling.TraceData {
+	td := pdata.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().InsertString("service.name", service)
+	span := rs.InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+	span.Status().SetCode(status)
+	return &sampling.TraceData{ReceivedBatches: []pdata.Traces{td}, SpanCount: 1}
+}
+
+func TestCompositeAndInvertPolicies(t *testing.T) {
+	cfg := &PolicyCfg{
+		sharedPolicyCfg: sharedPolicyCfg{Name: "composite", Type: Composite},
+		CompositeCfg: CompositeCfg{
+			MaxTotalSpansPerSecond: 100,
+			SubPolicyCfg: []CompositeSubPolicyCfg{
+				{
+					sharedPolicyCfg: sharedPolicyCfg{Name: "checkout-errors", Type: And},
+					AndCfg: AndCfg{SubPolicyCfg: []AndSubPolicyCfg{
+						{sharedPolicyCfg: sharedPolicyCfg{Type: StatusCode, StatusCodeCfg: StatusCodeCfg{StatusCodes: []string{"ERROR"}}}},
+						{sharedPolicyCfg: sharedPolicyCfg{Type: StringAttribute, StringAttributeCfg: StringAttributeCfg{Key: "service.name", Values: []string{"checkout"}}}},
+					}},
+				},
+				{
+					sharedPolicyCfg: sharedPolicyCfg{
+						Name:               "not-healthcheck",
+						Type:               StringAttribute,
+						Invert:             true,
+						StringAttributeCfg: StringAttributeCfg{Key: "service.name", Values: []string{"healthcheck"}},
+					},
+				},
+			},
+		},
+	}
+	eval, err := getPolicyEvaluator(zap.NewNop(), cfg)
+	require.NoError(t, err)
+
+	tests := []struct {
+		status  pdata.StatusCode
+		service string
+		want    sampling.Decision
+	}{
+		{status: pdata.StatusCodeError, service: "checkout", want: sampling.Sampled},
+		{status: pdata.StatusCodeOk, service: "cart", want: sampling.Sampled},
+		{status: pdata.StatusCodeError, service: "healthcheck", want: sampling.NotSampled},
+	}
+	for _, tt := range tests {
+		decision, err := eval.Evaluate(pdata.NewTraceID([16]byte{1}), newTraceData(tt.status, tt.service))
+		require.NoError(t, err)
+		assert.Equal(t, tt.want, decision, tt.service)
+	}
+
+	cfg.Invert = true
+	eval, err = getPolicyEvaluator(zap.NewNop(), cfg)
+	require.NoError(t, err)
+	decision, err := eval.Evaluate(pdata.NewTraceID([16]byte{1}), newTraceData(pdata.StatusCodeError, "healthcheck"))
+	require.NoError(t, err)
+	assert.Equal(t, sampling.Sampled, decision)
+}
+
+func TestCompositePolicyErrors(t *testing.T) {
+	_, err := getNewCompositePolicy(zap.NewNop(), &CompositeCfg{SubPolicyCfg: []CompositeSubPolicyCfg{newCompositeSubPolicy("a", AlwaysSample)}})
+	assert.EqualError(t, err, "composite policy requires a positive max_total_spans_per_second")
+
+	_, err = getNewCompositePolicy(zap.NewNop(), &CompositeCfg{MaxTotalSpansPerSecond: 10})
+	assert.EqualError(t, err, "composite policy requires at least one sub-policy")
+
+	_, err = getNewCompositePolicy(zap.NewNop(), &CompositeCfg{
+		MaxTotalSpansPerSecond: 10,
+		SubPolicyCfg:           []CompositeSubPolicyCfg{newCompositeSubPolicy("a", "unknown")},
+	})
+	assert.EqualError(t, err, `composite sub-policy "a": unknown sampling policy type unknown`)
+
+	_, err = getNewAndPolicy(zap.NewNop(), &AndCfg{})
+	assert.EqualError(t, err, "and policy requires at least one sub-policy")
+}
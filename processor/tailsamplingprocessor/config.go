@@ -15,6 +15,7 @@
 package tailsamplingprocessor
 
 import (
+	"errors"
 	"time"
 
 	"go.opentelemetry.io/collector/config"
@@ -40,14 +41,33 @@ const (
 	StringAttribute PolicyType = "string_attribute"
 	// RateLimiting allows all traces until the specified limits are satisfied.
 	RateLimiting PolicyType = "rate_limiting"
+	// SpanCount sample traces that have a number of spans in a given range.
+	SpanCount PolicyType = "span_count"
+	// TraceState sample traces that have a given key of the W3C tracestate
+	// matching one of the listed values.
+	TraceState PolicyType = "trace_state"
+	// SpanName sample traces that have a span whose name matches one of the
+	// listed regular expressions.
+	SpanName PolicyType = "span_name"
+	// BooleanAttribute sample traces that have a given boolean attribute set
+	// to a given value.
+	BooleanAttribute PolicyType = "boolean_attribute"
+	// And samples traces that are sampled by all of its sub-policies.
+	And PolicyType = "and"
+	// Composite samples traces that are sampled by any of its sub-policies, within
+	// a spans per second budget allocated to each sub-policy.
+	Composite PolicyType = "composite"
 )
 
-// PolicyCfg holds the common configuration to all policies.
-type PolicyCfg struct {
+// sharedPolicyCfg holds the common configuration to all policies, including the
+// sub-policies of the and and composite policies.
+type sharedPolicyCfg struct {
 	// Name given to the instance of the policy to make easy to identify it in metrics and logs.
 	Name string `mapstructure:"name"`
 	// Type of the policy this will be used to match the proper configuration of the policy.
 	Type PolicyType `mapstructure:"type"`
+	// Invert samples the traces the policy would not sample and vice versa.
+	Invert bool `mapstructure:"invert"`
 	// Configs for latency filter sampling policy evaluator.
 	LatencyCfg LatencyCfg `mapstructure:"latency"`
 	// Configs for numeric attribute filter sampling policy evaluator.
@@ -60,6 +80,35 @@ type PolicyCfg struct {
 	StringAttributeCfg StringAttributeCfg `mapstructure:"string_attribute"`
 	// Configs for rate limiting filter sampling policy evaluator.
 	RateLimitingCfg RateLimitingCfg `mapstructure:"rate_limiting"`
+	// Configs for span count filter sampling policy evaluator.
+	SpanCountCfg SpanCountCfg `mapstructure:"span_count"`
+	// Configs for trace state filter sampling policy evaluator.
+	TraceStateCfg TraceStateCfg `mapstructure:"trace_state"`
+	// Configs for span name filter sampling policy evaluator.
+	SpanNameCfg SpanNameCfg `mapstructure:"span_name"`
+	// Configs for boolean attribute filter sampling policy evaluator.
+	BooleanAttributeCfg BooleanAttributeCfg `mapstructure:"boolean_attribute"`
+}
+
+// AndSubPolicyCfg holds the configuration of a sub-policy of an and policy.
+type AndSubPolicyCfg struct {
+	sharedPolicyCfg `mapstructure:",squash"`
+}
+
+// CompositeSubPolicyCfg holds the configuration of a sub-policy of a composite policy.
+type CompositeSubPolicyCfg struct {
+	sharedPolicyCfg `mapstructure:",squash"`
+	// Configs for and sampling policy evaluator.
+	AndCfg AndCfg `mapstructure:"and"`
+}
+
+// PolicyCfg holds the common configuration to all policies.
+type PolicyCfg struct {
+	sharedPolicyCfg `mapstructure:",squash"`
+	// Configs for and sampling policy evaluator.
+	AndCfg AndCfg `mapstructure:"and"`
+	// Configs for composite sampling policy evaluator.
+	CompositeCfg CompositeCfg `mapstructure:"composite"`
 }
 
 // LatencyCfg holds the configurable settings to create a latency filter sampling policy
@@ -121,6 +170,100 @@ type RateLimitingCfg struct {
 	SpansPerSecond int64 `mapstructure:"spans_per_second"`
 }
 
+// SpanCountCfg holds the configurable settings to create a span count filter
+// sampling policy evaluator.
+type SpanCountCfg struct {
+	// MinSpans is the minimum number of spans of a trace to be considered a match.
+	MinSpans int64 `mapstructure:"min_spans"`
+	// MaxSpans is the maximum number of spans of a trace to be considered a match.
+	// There is no maximum when zero.
+	MaxSpans int64 `mapstructure:"max_spans"`
+}
+
+// TraceStateCfg holds the configurable settings to create a trace state filter
+// sampling policy evaluator.
+type TraceStateCfg struct {
+	// Key of the W3C tracestate that the filter is going to be matching against.
+	Key string `mapstructure:"key"`
+	// Values indicate the set of values to match against.
+	Values []string `mapstructure:"values"`
+}
+
+// SpanNameCfg holds the configurable settings to create a span name filter
+// sampling policy evaluator.
+type SpanNameCfg struct {
+	// Patterns are the regular expressions the span names are matched against.
+	Patterns []string `mapstructure:"patterns"`
+}
+
+// BooleanAttributeCfg holds the configurable settings to create a boolean
+// attribute filter sampling policy evaluator.
+type BooleanAttributeCfg struct {
+	// Tag that the filter is going to be matching against.
+	Key string `mapstructure:"key"`
+	// Value indicates the value of the attribute to be considered a match.
+	Value bool `mapstructure:"value"`
+}
+
+// AndCfg holds the configurable settings to create an and sampling policy
+// evaluator.
+type AndCfg struct {
+	// SubPolicyCfg are the policies that must all sample a trace for it to be sampled.
+	SubPolicyCfg []AndSubPolicyCfg `mapstructure:"and_sub_policy"`
+}
+
+// CompositeCfg holds the configurable settings to create a composite sampling
+// policy evaluator.
+type CompositeCfg struct {
+	// MaxTotalSpansPerSecond is the budget of spans per second shared by all sub-policies.
+	MaxTotalSpansPerSecond int64 `mapstructure:"max_total_spans_per_second"`
+	// SubPolicyCfg are the policies evaluated in order, a trace is sampled by the first
+	// one sampling it if its share of the budget allows it.
+	SubPolicyCfg []CompositeSubPolicyCfg `mapstructure:"composite_sub_policy"`
+	// RateAllocation assigns a percentage of the budget to sub-policies. Sub-policies
+	// without an allocation share the rest of the budget equally.
+	RateAllocation []RateAllocationCfg `mapstructure:"rate_allocation"`
+}
+
+// RateAllocationCfg assigns a percentage of the budget of a composite policy to
+// one of its sub-policies.
+type RateAllocationCfg struct {
+	// Policy is the name of the sub-policy.
+	Policy string `mapstructure:"policy"`
+	// Percent of the budget allocated to the sub-policy.
+	Percent int64 `mapstructure:"percent"`
+}
+
+// DecisionCacheCfg holds the configurable settings of the cache of sampling
+// decisions, used to route the spans of traces that arrive after their trace
+// was removed from memory.
+type DecisionCacheCfg struct {
+	// SampledCacheSize is the number of trace IDs of sampled traces to remember.
+	// Decisions to sample are not cached when zero.
+	SampledCacheSize int `mapstructure:"sampled_cache_size"`
+	// NonSampledCacheSize is the number of trace IDs of not sampled traces to
+	// remember. Decisions not to sample are not cached when zero.
+	NonSampledCacheSize int `mapstructure:"non_sampled_cache_size"`
+}
+
+// PolicySourceCfg holds the configurable settings of an external source of
+// policies, replacing the policies of the configuration without a restart.
+type PolicySourceCfg struct {
+	// File is the path of a YAML or JSON document listing the policies under
+	// "policies", like the processor configuration. Its directory is watched,
+	// so the file is read again as soon as it changes.
+	File string `mapstructure:"file"`
+	// Endpoint is the URL of an HTTP endpoint serving the same document, which is
+	// fetched every CheckInterval.
+	Endpoint string `mapstructure:"endpoint"`
+	// CheckInterval is the period at which the endpoint is fetched, or the file
+	// is read when it can't be watched. Default is 10s when zero.
+	CheckInterval time.Duration `mapstructure:"check_interval"`
+	// Timeout limits the duration of a request to the endpoint. Default is 5s
+	// when zero.
+	Timeout time.Duration `mapstructure:"timeout"`
+}
+
 // Config holds the configuration for tail-based sampling.
 type Config struct {
 	config.ProcessorSettings `mapstructure:",squash"` // squash ensures fields are correctly decoded in embedded struct
@@ -136,4 +279,30 @@ type Config struct {
 	// PolicyCfgs sets the tail-based sampling policy which makes a sampling decision
 	// for a given trace when requested.
 	PolicyCfgs []PolicyCfg `mapstructure:"policies"`
+	// DecisionCache keeps the sampling decisions of traces removed from memory, so
+	// that their late spans are sampled or dropped consistently.
+	DecisionCache DecisionCacheCfg `mapstructure:"decision_cache"`
+	// PersistentStorageEnabled keeps the spans of the traces waiting for a decision in
+	// the storage extension instead of memory, so that they are restored on start.
+	PersistentStorageEnabled bool `mapstructure:"persistent_storage_enabled"`
+	// AnnotateSampledSpans adds the names of the policies that sampled a trace and the
+	// probability it had to be sampled as attributes of its spans.
+	AnnotateSampledSpans bool `mapstructure:"annotate_sampled_spans"`
+	// PolicySource optionally loads the policies from a file or HTTP endpoint, replacing
+	// PolicyCfgs whenever a valid new version is found.
+	PolicySource PolicySourceCfg `mapstructure:"policy_source"`
+}
+
+// Validate checks if the processor configuration is valid.
+func (cfg *Config) Validate() error {
+	if cfg.PolicySource.File != "" && cfg.PolicySource.Endpoint != "" {
+		return errors.New("policy_source file and endpoint are mutually exclusive")
+	}
+	if cfg.PolicySource.CheckInterval < 0 {
+		return errors.New("policy_source check_interval must not be negative")
+	}
+	if cfg.PolicySource.Timeout < 0 {
+		return errors.New("policy_source timeout must not be negative")
+	}
+	return nil
 }
@@ -0,0 +1,90 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"sync"
+
+	"github.com/golang/groupcache/lru"
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+// decisionCache remembers the final sampling decision of the most recently
+// decided traces, keeping sampled and not sampled traces in separate LRU
+// caches so that a burst of one kind doesn't evict the other. A nil
+// decisionCache caches nothing.
+type decisionCache struct {
+	mutex sync.Mutex
+	// sampled and notSampled are nil when the respective decision isn't cached.
+	sampled    *lru.Cache
+	notSampled *lru.Cache
+}
+
+func newDecisionCache(cfg DecisionCacheCfg) *decisionCache {
+	c := &decisionCache{}
+	// A zero lru.Cache size means unbounded, so leave the cache disabled instead.
+	if cfg.SampledCacheSize > 0 {
+		c.sampled = lru.New(cfg.SampledCacheSize)
+	}
+	if cfg.NonSampledCacheSize > 0 {
+		c.notSampled = lru.New(cfg.NonSampledCacheSize)
+	}
+	return c
+}
+
+// put records the final decision taken for the trace, along with the
+// annotation of sampled traces if any. Decisions other than Sampled and
+// NotSampled are ignored.
+func (c *decisionCache) put(id pdata.TraceID, decision sampling.Decision, annotation *samplingAnnotation) {
+	if c == nil {
+		return
+	}
+	var cache *lru.Cache
+	switch decision {
+	case sampling.Sampled:
+		cache = c.sampled
+	case sampling.NotSampled:
+		cache = c.notSampled
+	}
+	if cache == nil {
+		return
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	cache.Add(id, annotation)
+}
+
+// get returns the decision recorded for the trace and its annotation, if any.
+func (c *decisionCache) get(id pdata.TraceID) (sampling.Decision, *samplingAnnotation, bool) {
+	if c == nil {
+		return sampling.Unspecified, nil, false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.sampled != nil {
+		if annotation, ok := c.sampled.Get(id); ok {
+			return sampling.Sampled, annotation.(*samplingAnnotation), true
+		}
+	}
+	if c.notSampled != nil {
+		if _, ok := c.notSampled.Get(id); ok {
+			return sampling.NotSampled, nil, true
+		}
+	}
+	return sampling.Unspecified, nil, false
+}
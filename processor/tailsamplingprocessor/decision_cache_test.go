@@ -0,0 +1,70 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+func TestDecisionCache(t *testing.T) {
+	c := newDecisionCache(DecisionCacheCfg{SampledCacheSize: 2, NonSampledCacheSize: 1})
+	ids := []pdata.TraceID{
+		pdata.NewTraceID([16]byte{1}),
+		pdata.NewTraceID([16]byte{2}),
+		pdata.NewTraceID([16]byte{3}),
+		pdata.NewTraceID([16]byte{4}),
+	}
+
+	annotation := &samplingAnnotation{policies: []string{"policy"}, probability: 1}
+	c.put(ids[0], sampling.Sampled, annotation)
+	c.put(ids[1], sampling.NotSampled, nil)
+	c.put(ids[2], sampling.Pending, nil)
+
+	decision, cached, ok := c.get(ids[0])
+	assert.True(t, ok)
+	assert.Equal(t, sampling.Sampled, decision)
+	assert.Equal(t, annotation, cached)
+	decision, _, ok = c.get(ids[1])
+	assert.True(t, ok)
+	assert.Equal(t, sampling.NotSampled, decision)
+	_, _, ok = c.get(ids[2])
+	assert.False(t, ok, "only final decisions are cached")
+
+	// Not sampled traces don't evict sampled ones.
+	c.put(ids[3], sampling.NotSampled, nil)
+	_, _, ok = c.get(ids[1])
+	assert.False(t, ok, "least recently used not sampled trace should be evicted")
+	_, _, ok = c.get(ids[0])
+	assert.True(t, ok)
+}
+
+func TestDecisionCacheDisabled(t *testing.T) {
+	id := pdata.NewTraceID([16]byte{1})
+
+	c := newDecisionCache(DecisionCacheCfg{NonSampledCacheSize: 1})
+	c.put(id, sampling.Sampled, nil)
+	_, _, ok := c.get(id)
+	assert.False(t, ok)
+
+	var nilCache *decisionCache
+	nilCache.put(id, sampling.Sampled, nil)
+	_, _, ok = nilCache.get(id)
+	assert.False(t, ok)
+}
@@ -0,0 +1,68 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+type and struct {
+	subpolicies []PolicyEvaluator
+	logger      *zap.Logger
+}
+
+var _ PolicyEvaluator = (*and)(nil)
+
+// NewAnd creates a policy evaluator that samples traces sampled by all of the
+// given sub-policies. The sub-policies are evaluated in order and the evaluation
+// stops at the first one not sampling the trace, so the sub-policies after it
+// don't see the trace: a rate_limiting sub-policy only counts the spans of the
+// traces all the sub-policies before it sampled.
+func NewAnd(logger *zap.Logger, subpolicies []PolicyEvaluator) PolicyEvaluator {
+	return &and{
+		subpolicies: subpolicies,
+		logger:      logger,
+	}
+}
+
+// OnLateArrivingSpans notifies the evaluator that the given list of spans arrived
+// after the sampling decision was already taken for the trace.
+// This gives the evaluator a chance to log any message/metrics and/or update any
+// related internal state.
+func (c *and) OnLateArrivingSpans(earlyDecision Decision, spans []*pdata.Span) error {
+	c.logger.Debug("Triggering action for late arriving spans in and filter")
+	for _, p := range c.subpolicies {
+		if err := p.OnLateArrivingSpans(earlyDecision, spans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate looks at the trace data and returns a corresponding SamplingDecision.
+func (c *and) Evaluate(traceID pdata.TraceID, trace *TraceData) (Decision, error) {
+	c.logger.Debug("Evaluating spans in and filter")
+	for _, p := range c.subpolicies {
+		decision, err := p.Evaluate(traceID, trace)
+		if err != nil {
+			return NotSampled, err
+		}
+		if decision != Sampled {
+			return NotSampled, nil
+		}
+	}
+	return Sampled, nil
+}
@@ -0,0 +1,80 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func newErrorTrace(service string) *TraceData {
+	trace := newTraceStringAttrs(map[string]pdata.AttributeValue{"service.name": pdata.NewAttributeValueString(service)}, "example", "value")
+	trace.ReceivedBatches[0].ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0).Status().SetCode(pdata.StatusCodeError)
+	return trace
+}
+
+func TestEvaluate_And(t *testing.T) {
+	errors, err := NewStatusCodeFilter(zap.NewNop(), []string{"ERROR"})
+	require.NoError(t, err)
+	checkout := NewStringAttributeFilter(zap.NewNop(), "service.name", []string{"checkout"}, false, 0)
+	and := NewAnd(zap.NewNop(), []PolicyEvaluator{errors, checkout})
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+
+	decision, err := and.Evaluate(traceID, newErrorTrace("checkout"))
+	assert.NoError(t, err)
+	assert.Equal(t, Sampled, decision)
+
+	decision, err = and.Evaluate(traceID, newErrorTrace("cart"))
+	assert.NoError(t, err)
+	assert.Equal(t, NotSampled, decision)
+
+	decision, err = and.Evaluate(traceID, newTraceStringAttrs(map[string]pdata.AttributeValue{"service.name": pdata.NewAttributeValueString("checkout")}, "example", "value"))
+	assert.NoError(t, err)
+	assert.Equal(t, NotSampled, decision)
+}
+
+func TestOnLateArrivingSpans_And(t *testing.T) {
+	and := NewAnd(zap.NewNop(), []PolicyEvaluator{NewAlwaysSample(zap.NewNop()), NewInvert(zap.NewNop(), NewAlwaysSample(zap.NewNop()))})
+	err := and.OnLateArrivingSpans(NotSampled, nil)
+	assert.Nil(t, err)
+}
+
+func TestEvaluate_AndShortCircuitsRateLimiting(t *testing.T) {
+	errors, err := NewStatusCodeFilter(zap.NewNop(), []string{"ERROR"})
+	require.NoError(t, err)
+	rateLimiting := NewRateLimiting(zap.NewNop(), 3)
+	and := NewAnd(zap.NewNop(), []PolicyEvaluator{errors, rateLimiting})
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+
+	// Traces not sampled by an earlier sub-policy don't use the spans of the rate limit.
+	ok := newTraceStringAttrs(map[string]pdata.AttributeValue{"service.name": pdata.NewAttributeValueString("checkout")}, "example", "value")
+	ok.SpanCount = 1
+	for i := 0; i < 5; i++ {
+		decision, err := and.Evaluate(traceID, ok)
+		require.NoError(t, err)
+		assert.Equal(t, NotSampled, decision)
+	}
+	failed := newErrorTrace("checkout")
+	failed.SpanCount = 1
+	for i := 0; i < 2; i++ {
+		decision, err := and.Evaluate(traceID, failed)
+		require.NoError(t, err)
+		assert.Equal(t, Sampled, decision)
+	}
+}
@@ -0,0 +1,87 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func newTraceBoolAttrs(nodeAttrs map[string]pdata.AttributeValue, spanAttrKey string, spanAttrValue pdata.AttributeValue) *TraceData {
+	traces := pdata.NewTraces()
+	rs := traces.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().InitFromMap(nodeAttrs)
+	span := rs.InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty()
+	span.SetTraceID(pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}))
+	span.SetSpanID(pdata.NewSpanID([8]byte{1, 2, 3, 4, 5, 6, 7, 8}))
+	span.Attributes().Insert(spanAttrKey, spanAttrValue)
+	return &TraceData{
+		ReceivedBatches: []pdata.Traces{traces},
+	}
+}
+
+func TestBooleanTagFilter(t *testing.T) {
+	var empty = map[string]pdata.AttributeValue{}
+	filter := NewBooleanAttributeFilter(zap.NewNop(), "example", true)
+
+	cases := []struct {
+		Desc     string
+		Trace    *TraceData
+		Decision Decision
+	}{
+		{
+			Desc:     "nonmatching span attribute",
+			Trace:    newTraceBoolAttrs(empty, "non_matching", pdata.NewAttributeValueBool(true)),
+			Decision: NotSampled,
+		},
+		{
+			Desc:     "span attribute with matching value",
+			Trace:    newTraceBoolAttrs(empty, "example", pdata.NewAttributeValueBool(true)),
+			Decision: Sampled,
+		},
+		{
+			Desc:     "span attribute with non matching value",
+			Trace:    newTraceBoolAttrs(empty, "example", pdata.NewAttributeValueBool(false)),
+			Decision: NotSampled,
+		},
+		{
+			Desc:     "span attribute of another type",
+			Trace:    newTraceBoolAttrs(empty, "example", pdata.NewAttributeValueString("true")),
+			Decision: NotSampled,
+		},
+		{
+			Desc:     "resource attribute with matching value",
+			Trace:    newTraceBoolAttrs(map[string]pdata.AttributeValue{"example": pdata.NewAttributeValueBool(true)}, "other", pdata.NewAttributeValueBool(false)),
+			Decision: Sampled,
+		},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			decision, err := filter.Evaluate(pdata.NewTraceID([16]byte{1}), c.Trace)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Decision, decision)
+		})
+	}
+}
+
+func TestOnLateArrivingSpans_BooleanTagFilter(t *testing.T) {
+	filter := NewBooleanAttributeFilter(zap.NewNop(), "example", true)
+	err := filter.OnLateArrivingSpans(NotSampled, nil)
+	assert.Nil(t, err)
+}
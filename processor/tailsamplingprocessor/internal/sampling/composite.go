@@ -0,0 +1,116 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"time"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// SubPolicyEvalParams defines a sub-policy of a composite policy.
+type SubPolicyEvalParams struct {
+	// Evaluator of the sub-policy.
+	Evaluator PolicyEvaluator
+	// MaxSpansPerSecond is the share of the budget of the composite policy
+	// allocated to the sub-policy.
+	MaxSpansPerSecond int64
+}
+
+type subpolicy struct {
+	evaluator              PolicyEvaluator
+	allocatedSPS           int64
+	sampledInCurrentSecond int64
+}
+
+type composite struct {
+	subpolicies          []*subpolicy
+	maxTotalSPS          int64
+	currentSecond        int64
+	spansInCurrentSecond int64
+	nowFunc              func() time.Time
+	logger               *zap.Logger
+}
+
+var _ PolicyEvaluator = (*composite)(nil)
+
+// NewComposite creates a policy evaluator that samples traces sampled by any of
+// the given sub-policies, as long as the spans sampled by the sub-policy in the
+// current second stay within its allocated share and all sub-policies together
+// stay within maxTotalSPS. The sub-policies are evaluated in order, a trace
+// sampled by a sub-policy exceeding its share is not sampled, so that a noisy
+// sub-policy cannot use up the share of the others.
+func NewComposite(logger *zap.Logger, maxTotalSPS int64, subPolicyParams []SubPolicyEvalParams) PolicyEvaluator {
+	subpolicies := make([]*subpolicy, 0, len(subPolicyParams))
+	for _, params := range subPolicyParams {
+		subpolicies = append(subpolicies, &subpolicy{
+			evaluator:    params.Evaluator,
+			allocatedSPS: params.MaxSpansPerSecond,
+		})
+	}
+	return &composite{
+		subpolicies: subpolicies,
+		maxTotalSPS: maxTotalSPS,
+		nowFunc:     time.Now,
+		logger:      logger,
+	}
+}
+
+// OnLateArrivingSpans notifies the evaluator that the given list of spans arrived
+// after the sampling decision was already taken for the trace.
+// This gives the evaluator a chance to log any message/metrics and/or update any
+// related internal state.
+func (c *composite) OnLateArrivingSpans(earlyDecision Decision, spans []*pdata.Span) error {
+	c.logger.Debug("Triggering action for late arriving spans in composite filter")
+	for _, p := range c.subpolicies {
+		if err := p.evaluator.OnLateArrivingSpans(earlyDecision, spans); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Evaluate looks at the trace data and returns a corresponding SamplingDecision.
+func (c *composite) Evaluate(traceID pdata.TraceID, trace *TraceData) (Decision, error) {
+	c.logger.Debug("Evaluating spans in composite filter")
+	currSecond := c.nowFunc().Unix()
+	if c.currentSecond != currSecond {
+		c.currentSecond = currSecond
+		c.spansInCurrentSecond = 0
+		for _, p := range c.subpolicies {
+			p.sampledInCurrentSecond = 0
+		}
+	}
+
+	for _, p := range c.subpolicies {
+		decision, err := p.evaluator.Evaluate(traceID, trace)
+		if err != nil {
+			return NotSampled, err
+		}
+		if decision != Sampled {
+			continue
+		}
+
+		spanCount := trace.SpanCount
+		if p.sampledInCurrentSecond+spanCount > p.allocatedSPS || c.spansInCurrentSecond+spanCount > c.maxTotalSPS {
+			return NotSampled, nil
+		}
+		p.sampledInCurrentSecond += spanCount
+		c.spansInCurrentSecond += spanCount
+		return Sampled, nil
+	}
+	return NotSampled, nil
+}
@@ -0,0 +1,73 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func TestEvaluate_Composite(t *testing.T) {
+	errors, err := NewStatusCodeFilter(zap.NewNop(), []string{"ERROR"})
+	require.NoError(t, err)
+	c := NewComposite(zap.NewNop(), 10, []SubPolicyEvalParams{
+		{Evaluator: errors, MaxSpansPerSecond: 4},
+		{Evaluator: NewAlwaysSample(zap.NewNop()), MaxSpansPerSecond: 6},
+	})
+	now := time.Unix(1600000000, 0)
+	c.(*composite).nowFunc = func() time.Time { return now }
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+
+	evaluate := func(trace *TraceData, spanCount int64) Decision {
+		trace.SpanCount = spanCount
+		decision, err := c.Evaluate(traceID, trace)
+		require.NoError(t, err)
+		return decision
+	}
+	ok := newTraceStringAttrs(map[string]pdata.AttributeValue{}, "example", "value")
+
+	assert.Equal(t, Sampled, evaluate(newErrorTrace("checkout"), 3))
+	// The error traces exceed their share, they must not use the share of the others.
+	assert.Equal(t, NotSampled, evaluate(newErrorTrace("checkout"), 2))
+	assert.Equal(t, Sampled, evaluate(ok, 6))
+	assert.Equal(t, NotSampled, evaluate(ok, 1))
+	assert.Equal(t, Sampled, evaluate(newErrorTrace("checkout"), 1))
+
+	// The budget is reset every second.
+	now = now.Add(time.Second)
+	assert.Equal(t, Sampled, evaluate(ok, 6))
+}
+
+func TestEvaluate_CompositeMaxTotal(t *testing.T) {
+	c := NewComposite(zap.NewNop(), 5, []SubPolicyEvalParams{
+		{Evaluator: NewAlwaysSample(zap.NewNop()), MaxSpansPerSecond: 10},
+	})
+	trace := newTraceStringAttrs(map[string]pdata.AttributeValue{}, "example", "value")
+	trace.SpanCount = 6
+	decision, err := c.Evaluate(pdata.NewTraceID([16]byte{1}), trace)
+	assert.NoError(t, err)
+	assert.Equal(t, NotSampled, decision)
+}
+
+func TestOnLateArrivingSpans_Composite(t *testing.T) {
+	c := NewComposite(zap.NewNop(), 10, []SubPolicyEvalParams{{Evaluator: NewAlwaysSample(zap.NewNop()), MaxSpansPerSecond: 10}})
+	err := c.OnLateArrivingSpans(Sampled, nil)
+	assert.Nil(t, err)
+}
@@ -0,0 +1,66 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+type invert struct {
+	policy PolicyEvaluator
+	logger *zap.Logger
+}
+
+var _ PolicyEvaluator = (*invert)(nil)
+
+// NewInvert creates a policy evaluator that samples the traces the given policy
+// does not sample and vice versa.
+func NewInvert(logger *zap.Logger, policy PolicyEvaluator) PolicyEvaluator {
+	return &invert{
+		policy: policy,
+		logger: logger,
+	}
+}
+
+// OnLateArrivingSpans notifies the evaluator that the given list of spans arrived
+// after the sampling decision was already taken for the trace.
+// This gives the evaluator a chance to log any message/metrics and/or update any
+// related internal state.
+func (i *invert) OnLateArrivingSpans(earlyDecision Decision, spans []*pdata.Span) error {
+	// The inverted policy took the opposite decision.
+	return i.policy.OnLateArrivingSpans(invertDecision(earlyDecision), spans)
+}
+
+// Evaluate looks at the trace data and returns a corresponding SamplingDecision.
+func (i *invert) Evaluate(traceID pdata.TraceID, trace *TraceData) (Decision, error) {
+	i.logger.Debug("Evaluating spans in invert filter")
+	decision, err := i.policy.Evaluate(traceID, trace)
+	if err != nil {
+		return NotSampled, err
+	}
+	return invertDecision(decision), nil
+}
+
+func invertDecision(decision Decision) Decision {
+	switch decision {
+	case Sampled:
+		return NotSampled
+	case NotSampled:
+		return Sampled
+	default:
+		return decision
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+// fixedEvaluator takes the same decision for every trace and remembers the
+// decision it was given for late spans.
+type fixedEvaluator struct {
+	decision     Decision
+	err          error
+	lateDecision Decision
+}
+
+var _ PolicyEvaluator = (*fixedEvaluator)(nil)
+
+func (f *fixedEvaluator) OnLateArrivingSpans(earlyDecision Decision, _ []*pdata.Span) error {
+	f.lateDecision = earlyDecision
+	return f.err
+}
+
+func (f *fixedEvaluator) Evaluate(pdata.TraceID, *TraceData) (Decision, error) {
+	return f.decision, f.err
+}
+
+func TestEvaluate_Invert(t *testing.T) {
+	errEvaluate := errors.New("evaluation failed")
+	cases := []struct {
+		Desc             string
+		Decision         Decision
+		Err              error
+		ExpectedDecision Decision
+		ExpectedErr      error
+	}{
+		{
+			Desc:             "sampled",
+			Decision:         Sampled,
+			ExpectedDecision: NotSampled,
+		},
+		{
+			Desc:             "not sampled",
+			Decision:         NotSampled,
+			ExpectedDecision: Sampled,
+		},
+		{
+			Desc:             "pending",
+			Decision:         Pending,
+			ExpectedDecision: Pending,
+		},
+		{
+			Desc:             "error is not inverted into sampled",
+			Decision:         Sampled,
+			Err:              errEvaluate,
+			ExpectedDecision: NotSampled,
+			ExpectedErr:      errEvaluate,
+		},
+		{
+			Desc:             "error when not sampled",
+			Decision:         NotSampled,
+			Err:              errEvaluate,
+			ExpectedDecision: NotSampled,
+			ExpectedErr:      errEvaluate,
+		},
+	}
+
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			invert := NewInvert(zap.NewNop(), &fixedEvaluator{decision: c.Decision, err: c.Err})
+			decision, err := invert.Evaluate(traceID, newTraceStringAttrs(nil, "example", "value"))
+			assert.Equal(t, c.ExpectedErr, err)
+			assert.Equal(t, c.ExpectedDecision, decision)
+		})
+	}
+}
+
+func TestEvaluate_InvertStringAttribute(t *testing.T) {
+	checkout := NewInvert(zap.NewNop(), NewStringAttributeFilter(zap.NewNop(), "service.name", []string{"checkout"}, false, 0))
+	traceID := pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16})
+
+	decision, err := checkout.Evaluate(traceID, newErrorTrace("checkout"))
+	assert.NoError(t, err)
+	assert.Equal(t, NotSampled, decision)
+
+	decision, err = checkout.Evaluate(traceID, newErrorTrace("cart"))
+	assert.NoError(t, err)
+	assert.Equal(t, Sampled, decision)
+}
+
+func TestOnLateArrivingSpans_Invert(t *testing.T) {
+	errLate := errors.New("late spans failed")
+	for _, decision := range []Decision{Sampled, NotSampled, Pending} {
+		policy := &fixedEvaluator{}
+		assert.NoError(t, NewInvert(zap.NewNop(), policy).OnLateArrivingSpans(decision, nil))
+		assert.Equal(t, invertDecision(decision), policy.lateDecision, "the inverted policy should be given its own decision")
+	}
+
+	policy := &fixedEvaluator{err: errLate}
+	assert.Equal(t, errLate, NewInvert(zap.NewNop(), policy).OnLateArrivingSpans(Sampled, nil))
+}
@@ -26,6 +26,8 @@ type TraceData struct {
 	sync.Mutex
 	// Decisions gives the current status of the sampling decision for each policy.
 	Decisions []Decision
+	// PolicyGeneration identifies the set of policies the Decisions are for.
+	PolicyGeneration uint64
 	// Arrival time the first span for the trace was received.
 	ArrivalTime time.Time
 	// Decisiontime time when sampling decision was taken.
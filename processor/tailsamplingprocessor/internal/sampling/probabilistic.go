@@ -24,7 +24,8 @@ import (
 )
 
 const (
-	defaultHashSalt = "default-hash-seed"
+	// DefaultHashSalt is the salt of the probabilistic policies without hash_salt.
+	DefaultHashSalt = "default-hash-seed"
 )
 
 type probabilisticSampler struct {
@@ -39,7 +40,7 @@ var _ PolicyEvaluator = (*probabilisticSampler)(nil)
 // traces.
 func NewProbabilisticSampler(logger *zap.Logger, hashSalt string, samplingPercentage float64) PolicyEvaluator {
 	if hashSalt == "" {
-		hashSalt = defaultHashSalt
+		hashSalt = DefaultHashSalt
 	}
 
 	return &probabilisticSampler{
@@ -0,0 +1,58 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"sync/atomic"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+type spanCount struct {
+	logger             *zap.Logger
+	minSpans, maxSpans int64
+}
+
+var _ PolicyEvaluator = (*spanCount)(nil)
+
+// NewSpanCount creates a policy evaluator that samples all traces with at least
+// minSpans spans and, unless maxSpans is zero, at most maxSpans spans.
+func NewSpanCount(logger *zap.Logger, minSpans, maxSpans int64) PolicyEvaluator {
+	return &spanCount{
+		logger:   logger,
+		minSpans: minSpans,
+		maxSpans: maxSpans,
+	}
+}
+
+// OnLateArrivingSpans notifies the evaluator that the given list of spans arrived
+// after the sampling decision was already taken for the trace.
+// This gives the evaluator a chance to log any message/metrics and/or update any
+// related internal state.
+func (c *spanCount) OnLateArrivingSpans(Decision, []*pdata.Span) error {
+	c.logger.Debug("Triggering action for late arriving spans in span count filter")
+	return nil
+}
+
+// Evaluate looks at the trace data and returns a corresponding SamplingDecision.
+func (c *spanCount) Evaluate(_ pdata.TraceID, trace *TraceData) (Decision, error) {
+	c.logger.Debug("Evaluating spans in span count filter")
+	count := atomic.LoadInt64(&trace.SpanCount)
+	if count >= c.minSpans && (c.maxSpans == 0 || count <= c.maxSpans) {
+		return Sampled, nil
+	}
+	return NotSampled, nil
+}
@@ -0,0 +1,77 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+type spanNameFilter struct {
+	patterns []*regexp.Regexp
+	logger   *zap.Logger
+}
+
+var _ PolicyEvaluator = (*spanNameFilter)(nil)
+
+// NewSpanNameFilter creates a policy evaluator that samples all traces with a
+// span whose name matches one of the given regular expressions.
+func NewSpanNameFilter(logger *zap.Logger, patterns []string) (PolicyEvaluator, error) {
+	if len(patterns) == 0 {
+		return nil, errors.New("expected at least one span name pattern to filter on")
+	}
+	compiled := make([]*regexp.Regexp, 0, len(patterns))
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid span name pattern %q: %w", pattern, err)
+		}
+		compiled = append(compiled, re)
+	}
+	return &spanNameFilter{
+		patterns: compiled,
+		logger:   logger,
+	}, nil
+}
+
+// OnLateArrivingSpans notifies the evaluator that the given list of spans arrived
+// after the sampling decision was already taken for the trace.
+// This gives the evaluator a chance to log any message/metrics and/or update any
+// related internal state.
+func (snf *spanNameFilter) OnLateArrivingSpans(Decision, []*pdata.Span) error {
+	snf.logger.Debug("Triggering action for late arriving spans in span name filter")
+	return nil
+}
+
+// Evaluate looks at the trace data and returns a corresponding SamplingDecision.
+func (snf *spanNameFilter) Evaluate(_ pdata.TraceID, trace *TraceData) (Decision, error) {
+	snf.logger.Debug("Evaluating spans in span name filter")
+	trace.Lock()
+	batches := trace.ReceivedBatches
+	trace.Unlock()
+
+	return hasSpanWithCondition(batches, func(span pdata.Span) bool {
+		for _, re := range snf.patterns {
+			if re.MatchString(span.Name()) {
+				return true
+			}
+		}
+		return false
+	}), nil
+}
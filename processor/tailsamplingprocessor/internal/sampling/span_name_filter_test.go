@@ -0,0 +1,76 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+func newTraceWithSpanNames(names ...string) *TraceData {
+	traces := pdata.NewTraces()
+	spans := traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty().Spans()
+	for _, name := range names {
+		span := spans.AppendEmpty()
+		span.SetTraceID(pdata.NewTraceID([16]byte{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}))
+		span.SetName(name)
+	}
+	return &TraceData{
+		ReceivedBatches: []pdata.Traces{traces},
+	}
+}
+
+func TestEvaluate_SpanName(t *testing.T) {
+	filter, err := NewSpanNameFilter(zap.NewNop(), []string{"^POST /orders", "checkout$"})
+	require.NoError(t, err)
+
+	cases := []struct {
+		Desc     string
+		Trace    *TraceData
+		Decision Decision
+	}{
+		{Desc: "no spans", Trace: newTraceWithSpanNames(), Decision: NotSampled},
+		{Desc: "matching first pattern", Trace: newTraceWithSpanNames("GET /health", "POST /orders/42"), Decision: Sampled},
+		{Desc: "matching second pattern", Trace: newTraceWithSpanNames("grpc.Cart/checkout"), Decision: Sampled},
+		{Desc: "non matching", Trace: newTraceWithSpanNames("GET /orders", "checkout.validate"), Decision: NotSampled},
+	}
+
+	for _, c := range cases {
+		t.Run(c.Desc, func(t *testing.T) {
+			decision, err := filter.Evaluate(pdata.NewTraceID([16]byte{1}), c.Trace)
+			assert.NoError(t, err)
+			assert.Equal(t, c.Decision, decision)
+		})
+	}
+}
+
+func TestNewSpanNameFilterErrors(t *testing.T) {
+	_, err := NewSpanNameFilter(zap.NewNop(), nil)
+	assert.EqualError(t, err, "expected at least one span name pattern to filter on")
+
+	_, err = NewSpanNameFilter(zap.NewNop(), []string{"("})
+	assert.Error(t, err)
+}
+
+func TestOnLateArrivingSpans_SpanName(t *testing.T) {
+	filter, err := NewSpanNameFilter(zap.NewNop(), []string{".*"})
+	require.NoError(t, err)
+	err = filter.OnLateArrivingSpans(NotSampled, nil)
+	assert.Nil(t, err)
+}
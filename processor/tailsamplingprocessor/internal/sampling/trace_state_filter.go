@@ -0,0 +1,87 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sampling
+
+import (
+	"strings"
+
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+)
+
+type traceStateFilter struct {
+	key    string
+	values map[string]struct{}
+	logger *zap.Logger
+}
+
+var _ PolicyEvaluator = (*traceStateFilter)(nil)
+
+// NewTraceStateFilter creates a policy evaluator that samples all traces with a
+// span whose W3C tracestate has the given key with one of the given values.
+func NewTraceStateFilter(logger *zap.Logger, key string, values []string) PolicyEvaluator {
+	valuesMap := make(map[string]struct{}, len(values))
+	for _, value := range values {
+		valuesMap[value] = struct{}{}
+	}
+	return &traceStateFilter{
+		key:    key,
+		values: valuesMap,
+		logger: logger,
+	}
+}
+
+// OnLateArrivingSpans notifies the evaluator that the given list of spans arrived
+// after the sampling decision was already taken for the trace.
+// This gives the evaluator a chance to log any message/metrics and/or update any
+// related internal state.
+func (tsf *traceStateFilter) OnLateArrivingSpans(Decision, []*pdata.Span) error {
+	tsf.logger.Debug("Triggering action for late arriving spans in trace state filter")
+	return nil
+}
+
+// Evaluate looks at the trace data and returns a corresponding SamplingDecision.
+func (tsf *traceStateFilter) Evaluate(_ pdata.TraceID, trace *TraceData) (Decision, error) {
+	tsf.logger.Debug("Evaluating spans in trace state filter")
+	trace.Lock()
+	batches := trace.ReceivedBatches
+	trace.Unlock()
+
+	return hasSpanWithCondition(batches, func(span pdata.Span) bool {
+		value, found := traceStateValue(string(span.TraceState()), tsf.key)
+		if !found {
+			return false
+		}
+		_, matched := tsf.values[value]
+		return matched
+	}), nil
+}
+
+// traceStateValue returns the value of the key in a W3C tracestate header,
+// which is a comma separated list of key=value pairs, see
+// https://www.w3.org/TR/trace-context/#tracestate-header
+func traceStateValue(traceState string, key string) (string, bool) {
+	for _, member := range strings.Split(traceState, ",") {
+		member = strings.TrimSpace(member)
+		eq := strings.IndexByte(member, '=')
+		if eq < 0 {
+			continue
+		}
+		if member[:eq] == key {
+			return member[eq+1:], true
+		}
+	}
+	return "", false
+}
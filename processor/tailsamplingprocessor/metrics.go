@@ -24,9 +24,11 @@ import (
 
 // Variables related to metrics specific to tail sampling.
 var (
-	tagPolicyKey, _    = tag.NewKey("policy")
-	tagSampledKey, _   = tag.NewKey("sampled")
-	tagSourceFormat, _ = tag.NewKey("source_format")
+	tagPolicyKey, _        = tag.NewKey("policy")
+	tagSampledKey, _       = tag.NewKey("sampled")
+	tagSourceFormat, _     = tag.NewKey("source_format")
+	tagPolicyVersionKey, _ = tag.NewKey("policy_version")
+	tagSuccessKey, _       = tag.NewKey("success")
 
 	statDecisionLatencyMicroSec  = stats.Int64("sampling_decision_latency", "Latency (in microseconds) of a given sampling policy", "µs")
 	statOverallDecisionLatencyUs = stats.Int64("sampling_decision_timer_latency", "Latency (in microseconds) of each run of the sampling decision timer", "µs")
@@ -34,6 +36,9 @@ var (
 	statTraceRemovalAgeSec           = stats.Int64("sampling_trace_removal_age", "Time (in seconds) from arrival of a new trace until its removal from memory", "s")
 	statLateSpanArrivalAfterDecision = stats.Int64("sampling_late_span_age", "Time (in seconds) from the sampling decision was taken and the arrival of a late span", "s")
 
+	statLateSpanCount         = stats.Int64("sampling_late_spans", "Count of spans arriving after the sampling decision of their trace was taken", stats.UnitDimensionless)
+	statDecisionCacheHitCount = stats.Int64("sampling_decision_cache_hits", "Count of late spans of traces no longer on memory routed by the decision cache", stats.UnitDimensionless)
+
 	statPolicyEvaluationErrorCount = stats.Int64("sampling_policy_evaluation_error", "Count of sampling policy evaluation errors", stats.UnitDimensionless)
 
 	statCountTracesSampled = stats.Int64("count_traces_sampled", "Count of traces that were sampled or not", stats.UnitDimensionless)
@@ -41,6 +46,8 @@ var (
 	statDroppedTooEarlyCount    = stats.Int64("sampling_trace_dropped_too_early", "Count of traces that needed to be dropped the configured wait time", stats.UnitDimensionless)
 	statNewTraceIDReceivedCount = stats.Int64("new_trace_id_received", "Counts the arrival of new traces", stats.UnitDimensionless)
 	statTracesOnMemoryGauge     = stats.Int64("sampling_traces_on_memory", "Tracks the number of traces current on memory", stats.UnitDimensionless)
+
+	statPolicyReloadCount = stats.Int64("sampling_policy_reloads", "Count of attempts to activate the policies of the policy source, by version", stats.UnitDimensionless)
 )
 
 // SamplingProcessorMetricViews return the metrics views according to given telemetry level.
@@ -81,6 +88,22 @@ func SamplingProcessorMetricViews(level configtelemetry.Level) []*view.View {
 		Aggregation: ageDistributionAggregation,
 	}
 
+	sampledOnlyTagKeys := []tag.Key{tagSampledKey}
+	countLateSpanView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statLateSpanCount.Name()),
+		Measure:     statLateSpanCount,
+		Description: statLateSpanCount.Description(),
+		TagKeys:     sampledOnlyTagKeys,
+		Aggregation: view.Sum(),
+	}
+	countDecisionCacheHitView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statDecisionCacheHitCount.Name()),
+		Measure:     statDecisionCacheHitCount,
+		Description: statDecisionCacheHitCount.Description(),
+		TagKeys:     sampledOnlyTagKeys,
+		Aggregation: view.Sum(),
+	}
+
 	countPolicyEvaluationErrorView := &view.View{
 		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statPolicyEvaluationErrorCount.Name()),
 		Measure:     statPolicyEvaluationErrorCount,
@@ -116,12 +139,22 @@ func SamplingProcessorMetricViews(level configtelemetry.Level) []*view.View {
 		Aggregation: view.LastValue(),
 	}
 
+	countPolicyReloadView := &view.View{
+		Name:        obsreport.BuildProcessorCustomMetricName(typeStr, statPolicyReloadCount.Name()),
+		Measure:     statPolicyReloadCount,
+		Description: statPolicyReloadCount.Description(),
+		TagKeys:     []tag.Key{tagPolicyVersionKey, tagSuccessKey},
+		Aggregation: view.Sum(),
+	}
+
 	return []*view.View{
 		decisionLatencyView,
 		overallDecisionLatencyView,
 
 		traceRemovalAgeView,
 		lateSpanArrivalView,
+		countLateSpanView,
+		countDecisionCacheHitView,
 
 		countPolicyEvaluationErrorView,
 
@@ -130,5 +163,7 @@ func SamplingProcessorMetricViews(level configtelemetry.Level) []*view.View {
 		countTraceDroppedTooEarlyView,
 		countTraceIDArrivalView,
 		trackTracesOnMemorylView,
+
+		countPolicyReloadView,
 	}
 }
@@ -0,0 +1,249 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"go.opencensus.io/stats"
+	"go.opencensus.io/tag"
+	"go.opentelemetry.io/collector/config/configparser"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultPolicySourceCheckInterval = 10 * time.Second
+	defaultPolicySourceTimeout       = 5 * time.Second
+)
+
+// policySet is a list of policies activated together.
+type policySet struct {
+	// version identifies the document the policies were loaded from.
+	version string
+	// generation is incremented every time policies are activated, even if
+	// their version didn't change, so that pending traces are evaluated again.
+	generation uint64
+	policies   []*policy
+}
+
+// policyDocument is the content of a policy source.
+type policyDocument struct {
+	// Version identifies the policies in metrics and logs. The hash of the
+	// document is used when it is empty.
+	Version    string      `mapstructure:"version"`
+	PolicyCfgs []PolicyCfg `mapstructure:"policies"`
+}
+
+// policySource loads policies from a watched file or a polled HTTP endpoint.
+type policySource struct {
+	cfg    PolicySourceCfg
+	client *http.Client
+	// mutex serializes the reloads.
+	mutex sync.Mutex
+	// hash of the last document read, to only parse it again when it changes.
+	hash string
+	// generation of the last policies activated.
+	generation uint64
+	stop       chan struct{}
+	done       chan struct{}
+}
+
+func newPolicySource(cfg PolicySourceCfg) *policySource {
+	if cfg.CheckInterval <= 0 {
+		cfg.CheckInterval = defaultPolicySourceCheckInterval
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = defaultPolicySourceTimeout
+	}
+	return &policySource{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+// read returns the content of the source.
+func (ps *policySource) read(ctx context.Context) ([]byte, error) {
+	if ps.cfg.File != "" {
+		return ioutil.ReadFile(ps.cfg.File)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, ps.cfg.Endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := ps.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("policy source %q returned status %q", ps.cfg.Endpoint, res.Status)
+	}
+	return ioutil.ReadAll(res.Body)
+}
+
+// parsePolicyDocument decodes the policies of a YAML or JSON document.
+func parsePolicyDocument(buf []byte) (*policyDocument, error) {
+	cm, err := configparser.NewConfigMapFromBuffer(bytes.NewReader(buf))
+	if err != nil {
+		return nil, err
+	}
+	doc := &policyDocument{}
+	if err := cm.UnmarshalExact(doc); err != nil {
+		return nil, err
+	}
+	if len(doc.PolicyCfgs) == 0 {
+		return nil, errors.New("no policies found")
+	}
+	if doc.Version == "" {
+		sum := sha256.Sum256(buf)
+		doc.Version = hex.EncodeToString(sum[:6])
+	}
+	return doc, nil
+}
+
+// reloadPolicies activates the policies of the source if they changed since
+// the last check. Invalid policies are reported and the active ones are kept.
+func (tsp *tailSamplingSpanProcessor) reloadPolicies(ctx context.Context) {
+	tsp.policySource.mutex.Lock()
+	defer tsp.policySource.mutex.Unlock()
+
+	buf, err := tsp.policySource.read(ctx)
+	if err != nil {
+		tsp.logger.Warn("Failed to read sampling policies", zap.Error(err))
+		recordPolicyReload("", false)
+		return
+	}
+	sum := sha256.Sum256(buf)
+	hash := hex.EncodeToString(sum[:])
+	if hash == tsp.policySource.hash {
+		return
+	}
+	tsp.policySource.hash = hash
+
+	doc, err := parsePolicyDocument(buf)
+	if err != nil {
+		tsp.logger.Error("Invalid sampling policies, keeping the active ones", zap.Error(err))
+		recordPolicyReload("", false)
+		return
+	}
+	policies, err := newPolicies(tsp.logger, doc.PolicyCfgs)
+	if err != nil {
+		tsp.logger.Error("Invalid sampling policies, keeping the active ones",
+			zap.String("version", doc.Version), zap.Error(err))
+		recordPolicyReload(doc.Version, false)
+		return
+	}
+
+	tsp.policySource.generation++
+	tsp.reloadedPolicies.Store(&policySet{version: doc.Version, generation: tsp.policySource.generation, policies: policies})
+	tsp.logger.Info("Activated sampling policies",
+		zap.String("version", doc.Version), zap.Int("policies", len(policies)))
+	recordPolicyReload(doc.Version, true)
+}
+
+func recordPolicyReload(version string, success bool) {
+	_ = stats.RecordWithTags(
+		context.Background(),
+		[]tag.Mutator{tag.Upsert(tagPolicyVersionKey, version), tag.Upsert(tagSuccessKey, strconv.FormatBool(success))},
+		statPolicyReloadCount.M(1),
+	)
+}
+
+// startPolicySource loads the policies of the source and reloads them until
+// stopPolicySource is called, whenever the directory of the file changes or
+// every CheckInterval for an endpoint.
+func (tsp *tailSamplingSpanProcessor) startPolicySource(ctx context.Context) {
+	ps := tsp.policySource
+	var watcher *fsnotify.Watcher
+	if ps.cfg.File != "" {
+		var err error
+		// Watch before the first read, so that no change is missed.
+		if watcher, err = watchDir(ps.cfg.File); err != nil {
+			tsp.logger.Warn("Failed to watch the sampling policies file, checking it periodically instead",
+				zap.String("file", ps.cfg.File), zap.Error(err))
+		}
+	}
+	tsp.reloadPolicies(ctx)
+
+	ps.stop = make(chan struct{})
+	ps.done = make(chan struct{})
+	go func() {
+		defer close(ps.done)
+		var (
+			ticks  <-chan time.Time
+			events <-chan fsnotify.Event
+			errs   <-chan error
+		)
+		if watcher != nil {
+			defer watcher.Close()
+			events, errs = watcher.Events, watcher.Errors
+		} else {
+			ticker := time.NewTicker(ps.cfg.CheckInterval)
+			defer ticker.Stop()
+			ticks = ticker.C
+		}
+		for {
+			select {
+			case <-ticks:
+				tsp.reloadPolicies(context.Background())
+			case <-events:
+				// The hash of the document tells whether the file itself changed.
+				tsp.reloadPolicies(context.Background())
+			case err := <-errs:
+				tsp.logger.Warn("Failed to watch the sampling policies file", zap.Error(err))
+			case <-ps.stop:
+				return
+			}
+		}
+	}()
+}
+
+// watchDir watches the directory of the file rather than the file itself, so
+// that the file is still watched after being replaced, e.g. by renaming another
+// file over it or updating the Kubernetes ConfigMap it is mounted from.
+func watchDir(file string) (*fsnotify.Watcher, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, err
+	}
+	if err := watcher.Add(filepath.Dir(file)); err != nil {
+		_ = watcher.Close()
+		return nil, err
+	}
+	return watcher, nil
+}
+
+func (tsp *tailSamplingSpanProcessor) stopPolicySource() {
+	ps := tsp.policySource
+	if ps == nil || ps.stop == nil {
+		return
+	}
+	close(ps.stop)
+	<-ps.done
+	ps.stop = nil
+}
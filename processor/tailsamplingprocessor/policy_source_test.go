@@ -0,0 +1,303 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+func activePolicyNames(tsp *tailSamplingSpanProcessor) []string {
+	var names []string
+	policies, _ := tsp.activePolicies()
+	for _, p := range policies {
+		names = append(names, p.name)
+	}
+	return names
+}
+
+func TestParsePolicyDocument(t *testing.T) {
+	doc, err := parsePolicyDocument([]byte(`{"version": "v2", "policies": [{"name": "errors", "type": "status_code", "status_code": {"status_codes": ["ERROR"]}}]}`))
+	require.NoError(t, err)
+	assert.Equal(t, "v2", doc.Version)
+	assert.Equal(t, []PolicyCfg{{sharedPolicyCfg: sharedPolicyCfg{
+		Name:          "errors",
+		Type:          StatusCode,
+		StatusCodeCfg: StatusCodeCfg{StatusCodes: []string{"ERROR"}},
+	}}}, doc.PolicyCfgs)
+
+	doc, err = parsePolicyDocument([]byte("policies:\n  - name: all\n    type: always_sample\n"))
+	require.NoError(t, err)
+	assert.Len(t, doc.Version, 12, "the hash of the document should be the version")
+
+	_, err = parsePolicyDocument([]byte("policies: []\n"))
+	assert.Error(t, err)
+	_, err = parsePolicyDocument([]byte("policies:\n  - name: all\n    typo: always_sample\n"))
+	assert.Error(t, err)
+}
+
+func TestReloadPoliciesFromFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	write := func(content string) {
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0600))
+	}
+
+	cfg := Config{
+		DecisionWait: defaultTestDecisionWait,
+		NumTraces:    10,
+		PolicyCfgs:   testPolicy,
+		PolicySource: PolicySourceCfg{File: path},
+	}
+	sp, err := newTracesProcessor(zap.NewNop(), consumertest.NewNop(), cfg)
+	require.NoError(t, err)
+	tsp := sp.(*tailSamplingSpanProcessor)
+
+	// The policies of the configuration are kept until the source is valid.
+	require.NoError(t, tsp.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() { require.NoError(t, tsp.Shutdown(context.Background())) }()
+	assert.Equal(t, []string{"test-policy"}, activePolicyNames(tsp))
+
+	write("version: v1\npolicies:\n  - name: all\n    type: always_sample\n  - name: slow\n    type: latency\n    latency: {threshold_ms: 100}\n")
+	tsp.reloadPolicies(context.Background())
+	assert.Equal(t, []string{"all", "slow"}, activePolicyNames(tsp))
+	assert.Equal(t, "v1", tsp.reloadedPolicies.Load().(*policySet).version)
+
+	write("version: v2\npolicies:\n  - name: bad\n    type: status_code\n    status_code: {status_codes: [NOPE]}\n")
+	tsp.reloadPolicies(context.Background())
+	assert.Equal(t, []string{"all", "slow"}, activePolicyNames(tsp), "invalid policies should not be activated")
+
+	write("version: v3\npolicies:\n  - name: errors\n    type: status_code\n    status_code: {status_codes: [ERROR]}\n")
+	tsp.reloadPolicies(context.Background())
+	assert.Equal(t, []string{"errors"}, activePolicyNames(tsp))
+	assert.Equal(t, "v3", tsp.reloadedPolicies.Load().(*policySet).version)
+}
+
+func TestReloadPoliciesFromEndpoint(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"version": "v1", "policies": [{"name": "all", "type": "always_sample"}]}`))
+	}))
+	defer server.Close()
+
+	tsp := &tailSamplingSpanProcessor{
+		logger:       zap.NewNop(),
+		policies:     []*policy{{name: "mock-policy"}},
+		policySource: newPolicySource(PolicySourceCfg{Endpoint: server.URL}),
+		policyTicker: &manualTTicker{},
+	}
+	require.NoError(t, tsp.Start(context.Background(), componenttest.NewNopHost()))
+	require.NoError(t, tsp.Shutdown(context.Background()))
+	assert.Equal(t, []string{"all"}, activePolicyNames(tsp))
+
+	tsp.policySource.cfg.Endpoint = server.URL + "/%"
+	tsp.reloadPolicies(context.Background())
+	assert.Equal(t, []string{"all"}, activePolicyNames(tsp), "unreachable source should keep the active policies")
+}
+
+func TestWatchPoliciesFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "policies.yaml")
+	require.NoError(t, ioutil.WriteFile(path, []byte("policies:\n  - name: all\n    type: always_sample\n"), 0600))
+
+	tsp := &tailSamplingSpanProcessor{
+		logger:       zap.NewNop(),
+		policySource: newPolicySource(PolicySourceCfg{File: path, CheckInterval: time.Hour}),
+		policyTicker: &manualTTicker{},
+	}
+	require.NoError(t, tsp.Start(context.Background(), componenttest.NewNopHost()))
+	defer func() { require.NoError(t, tsp.Shutdown(context.Background())) }()
+	assert.Equal(t, []string{"all"}, activePolicyNames(tsp))
+
+	// Replace the file like editors and ConfigMap updates do, long before the check interval.
+	tmp := filepath.Join(dir, "policies.yaml.tmp")
+	require.NoError(t, ioutil.WriteFile(tmp, []byte("policies:\n  - name: errors\n    type: status_code\n    status_code: {status_codes: [ERROR]}\n"), 0600))
+	require.NoError(t, os.Rename(tmp, path))
+	assert.Eventually(t, func() bool {
+		names := activePolicyNames(tsp)
+		return len(names) == 1 && names[0] == "errors"
+	}, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestPolicySourceTimeout(t *testing.T) {
+	assert.Equal(t, defaultPolicySourceTimeout, newPolicySource(PolicySourceCfg{Endpoint: "http://localhost"}).client.Timeout)
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	tsp := &tailSamplingSpanProcessor{
+		logger:       zap.NewNop(),
+		policies:     []*policy{{name: "mock-policy"}},
+		policySource: newPolicySource(PolicySourceCfg{Endpoint: server.URL, CheckInterval: time.Hour, Timeout: 10 * time.Millisecond}),
+		policyTicker: &manualTTicker{},
+	}
+	start := time.Now()
+	tsp.reloadPolicies(context.Background())
+	assert.Less(t, time.Since(start), defaultPolicySourceTimeout, "the request should be canceled after the configured timeout")
+	assert.Equal(t, []string{"mock-policy"}, activePolicyNames(tsp))
+}
+
+func TestPendingTraceDecidedByReloadedPolicies(t *testing.T) {
+	msp := new(consumertest.TracesSink)
+	tsp := &tailSamplingSpanProcessor{
+		ctx:             context.Background(),
+		nextConsumer:    msp,
+		maxNumTraces:    10,
+		logger:          zap.NewNop(),
+		decisionBatcher: newSyncIDBatcher(1),
+		policies: []*policy{
+			{name: "policy-1", evaluator: &mockPolicyEvaluator{NextDecision: sampling.NotSampled}, ctx: context.TODO()},
+			{name: "policy-2", evaluator: &mockPolicyEvaluator{NextDecision: sampling.NotSampled}, ctx: context.TODO()},
+		},
+		deleteChan:   make(chan pdata.TraceID, 10),
+		policyTicker: &manualTTicker{},
+	}
+
+	id := pdata.NewTraceID([16]byte{1})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+
+	mpe := &mockPolicyEvaluator{NextDecision: sampling.Sampled}
+	tsp.reloadedPolicies.Store(&policySet{version: "v2", generation: 1, policies: []*policy{{name: "reloaded", evaluator: mpe, ctx: context.TODO()}}})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	assert.Equal(t, 1, mpe.EvaluationCount)
+	assert.Equal(t, 2, msp.SpanCount())
+
+	// Late spans follow the decision of the reloaded policies.
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	assert.Equal(t, 3, msp.SpanCount())
+	assert.Equal(t, 1, mpe.LateArrivingSpanCount)
+}
+
+func TestPendingTraceDecidedBySameLengthReloadedPolicies(t *testing.T) {
+	msp := new(consumertest.TracesSink)
+	configured := &mockPolicyEvaluator{NextDecision: sampling.NotSampled}
+	tsp := &tailSamplingSpanProcessor{
+		ctx:             context.Background(),
+		nextConsumer:    msp,
+		maxNumTraces:    10,
+		logger:          zap.NewNop(),
+		decisionBatcher: newSyncIDBatcher(1),
+		policies:        []*policy{{name: "policy-1", evaluator: configured, ctx: context.TODO()}},
+		deleteChan:      make(chan pdata.TraceID, 10),
+		policyTicker:    &manualTTicker{},
+	}
+
+	// The trace is decided by the policies of the configuration.
+	decided := pdata.NewTraceID([16]byte{1})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(decided)))
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	assert.Equal(t, 1, configured.EvaluationCount)
+	assert.Equal(t, 0, msp.SpanCount())
+
+	// A pending trace is evaluated by the reloaded policies, which have as many
+	// policies as the configuration.
+	pending := pdata.NewTraceID([16]byte{2})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(pending)))
+	reloaded := &mockPolicyEvaluator{NextDecision: sampling.Sampled}
+	tsp.reloadedPolicies.Store(&policySet{version: "v2", generation: 1, policies: []*policy{{name: "reloaded", evaluator: reloaded, ctx: context.TODO()}}})
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	assert.Equal(t, 1, configured.EvaluationCount)
+	assert.Equal(t, 1, reloaded.EvaluationCount)
+	assert.Equal(t, 1, msp.SpanCount())
+
+	// Late spans of the trace decided before the reload follow its decision,
+	// without reaching the evaluator of the policy replacing the one that decided it.
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(decided)))
+	assert.Equal(t, 1, msp.SpanCount())
+	assert.Equal(t, 0, reloaded.LateArrivingSpanCount)
+	assert.Equal(t, 0, configured.LateArrivingSpanCount)
+}
+
+// blockingPolicyEvaluator samples the traces it evaluates once it is released.
+type blockingPolicyEvaluator struct {
+	evaluating chan struct{}
+	release    chan struct{}
+}
+
+var _ sampling.PolicyEvaluator = (*blockingPolicyEvaluator)(nil)
+
+func (b *blockingPolicyEvaluator) OnLateArrivingSpans(sampling.Decision, []*pdata.Span) error {
+	return nil
+}
+
+func (b *blockingPolicyEvaluator) Evaluate(pdata.TraceID, *sampling.TraceData) (sampling.Decision, error) {
+	close(b.evaluating)
+	<-b.release
+	return sampling.Sampled, nil
+}
+
+func TestPoliciesReloadedDuringDecision(t *testing.T) {
+	msp := new(consumertest.TracesSink)
+	blocking := &blockingPolicyEvaluator{evaluating: make(chan struct{}), release: make(chan struct{})}
+	tsp := &tailSamplingSpanProcessor{
+		ctx:             context.Background(),
+		nextConsumer:    msp,
+		maxNumTraces:    10,
+		logger:          zap.NewNop(),
+		decisionBatcher: newSyncIDBatcher(1),
+		policies: []*policy{
+			{name: "policy-1", evaluator: blocking, ctx: context.TODO()},
+			{name: "policy-2", evaluator: &mockPolicyEvaluator{NextDecision: sampling.NotSampled}, ctx: context.TODO()},
+		},
+		deleteChan:   make(chan pdata.TraceID, 10),
+		policyTicker: &manualTTicker{},
+	}
+
+	id := pdata.NewTraceID([16]byte{1})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	tsp.samplingPolicyOnTick()
+	ticked := make(chan struct{})
+	go func() {
+		tsp.samplingPolicyOnTick()
+		close(ticked)
+	}()
+
+	// The policies are replaced by fewer ones while the trace is being decided,
+	// and more spans of the trace arrive meanwhile.
+	<-blocking.evaluating
+	reloaded := &mockPolicyEvaluator{NextDecision: sampling.NotSampled}
+	tsp.reloadedPolicies.Store(&policySet{version: "v2", generation: 1, policies: []*policy{{name: "reloaded", evaluator: reloaded, ctx: context.TODO()}}})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	close(blocking.release)
+	<-ticked
+
+	// The spans that arrived during the decision follow it, and so do later ones.
+	assert.Equal(t, 2, msp.SpanCount())
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	assert.Equal(t, 3, msp.SpanCount())
+	assert.Equal(t, 0, reloaded.EvaluationCount)
+	assert.Equal(t, 0, reloaded.LateArrivingSpanCount)
+}
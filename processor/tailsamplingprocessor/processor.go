@@ -18,6 +18,8 @@ import (
 	"context"
 	"fmt"
 	"runtime"
+	"sort"
+	"strconv"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -26,10 +28,12 @@ import (
 	"go.opencensus.io/tag"
 	"go.opentelemetry.io/collector/component"
 	"go.opentelemetry.io/collector/component/componenterror"
+	"go.opentelemetry.io/collector/config"
 	"go.opentelemetry.io/collector/consumer"
 	"go.opentelemetry.io/collector/model/pdata"
 	"go.uber.org/zap"
 
+	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/tracestorage"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/idbatcher"
 	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
 )
@@ -43,22 +47,39 @@ type policy struct {
 	evaluator sampling.PolicyEvaluator
 	// ctx used to carry metric tags of each policy.
 	ctx context.Context
+	// probability of a trace matched by this policy to be sampled.
+	probability float64
+	// hashRange is the range of trace ID hashes sampled by the policy, nil if
+	// it doesn't sample by hash.
+	hashRange *hashRange
 }
 
 // tailSamplingSpanProcessor handles the incoming trace data and uses the given sampling
 // policy to sample traces.
 type tailSamplingSpanProcessor struct {
-	ctx             context.Context
-	nextConsumer    consumer.Traces
-	start           sync.Once
-	maxNumTraces    uint64
-	policies        []*policy
-	logger          *zap.Logger
-	idToTrace       sync.Map
-	policyTicker    tTicker
-	decisionBatcher idbatcher.Batcher
-	deleteChan      chan pdata.TraceID
-	numTracesOnMap  uint64
+	ctx          context.Context
+	id           config.ComponentID
+	nextConsumer consumer.Traces
+	start        sync.Once
+	maxNumTraces uint64
+	// policies are the policies of the configuration, replaced by the
+	// *policySet stored in reloadedPolicies when a policySource is set.
+	policies         []*policy
+	policySource     *policySource
+	reloadedPolicies atomic.Value
+	logger           *zap.Logger
+	idToTrace        sync.Map
+	policyTicker     tTicker
+	decisionBatcher  idbatcher.Batcher
+	deleteChan       chan pdata.TraceID
+	numTracesOnMap   uint64
+	// decisionCache routes the late spans of traces no longer on idToTrace.
+	decisionCache *decisionCache
+	// buffer keeps the batches of pending traces when persistentStorage is
+	// enabled, it is nil otherwise.
+	persistentStorage bool
+	buffer            *traceBuffer
+	annotateSpans     bool
 }
 
 const (
@@ -79,10 +100,40 @@ func newTracesProcessor(logger *zap.Logger, nextConsumer consumer.Traces, cfg Co
 	}
 
 	ctx := context.Background()
+	policies, err := newPolicies(logger, cfg.PolicyCfgs)
+	if err != nil {
+		return nil, err
+	}
+
+	tsp := &tailSamplingSpanProcessor{
+		ctx:               ctx,
+		id:                cfg.ID(),
+		nextConsumer:      nextConsumer,
+		maxNumTraces:      cfg.NumTraces,
+		logger:            logger,
+		decisionBatcher:   inBatcher,
+		policies:          policies,
+		decisionCache:     newDecisionCache(cfg.DecisionCache),
+		persistentStorage: cfg.PersistentStorageEnabled,
+		annotateSpans:     cfg.AnnotateSampledSpans,
+	}
+
+	if cfg.PolicySource.File != "" || cfg.PolicySource.Endpoint != "" {
+		tsp.policySource = newPolicySource(cfg.PolicySource)
+	}
+
+	tsp.policyTicker = &policyTicker{onTickFunc: tsp.samplingPolicyOnTick}
+	tsp.deleteChan = make(chan pdata.TraceID, cfg.NumTraces)
+
+	return tsp, nil
+}
+
+// newPolicies creates the policies of the given configurations.
+func newPolicies(logger *zap.Logger, cfgs []PolicyCfg) ([]*policy, error) {
 	var policies []*policy
-	for i := range cfg.PolicyCfgs {
-		policyCfg := &cfg.PolicyCfgs[i]
-		policyCtx, err := tag.New(ctx, tag.Upsert(tagPolicyKey, policyCfg.Name), tag.Upsert(tagSourceFormat, sourceFormat))
+	for i := range cfgs {
+		policyCfg := &cfgs[i]
+		policyCtx, err := tag.New(context.Background(), tag.Upsert(tagPolicyKey, policyCfg.Name), tag.Upsert(tagSourceFormat, sourceFormat))
 		if err != nil {
 			return nil, err
 		}
@@ -90,30 +141,77 @@ func newTracesProcessor(logger *zap.Logger, nextConsumer consumer.Traces, cfg Co
 		if err != nil {
 			return nil, err
 		}
+		probability, hashRange := getPolicyProbability(policyCfg)
 		p := &policy{
-			name:      policyCfg.Name,
-			evaluator: eval,
-			ctx:       policyCtx,
+			name:        policyCfg.Name,
+			evaluator:   eval,
+			ctx:         policyCtx,
+			probability: probability,
+			hashRange:   hashRange,
 		}
 		policies = append(policies, p)
 	}
+	return policies, nil
+}
 
-	tsp := &tailSamplingSpanProcessor{
-		ctx:             ctx,
-		nextConsumer:    nextConsumer,
-		maxNumTraces:    cfg.NumTraces,
-		logger:          logger,
-		decisionBatcher: inBatcher,
-		policies:        policies,
+// activePolicies returns the policies of the policy source once some were
+// activated, the policies of the configuration otherwise, along with their
+// generation. The policies of the configuration are generation zero.
+func (tsp *tailSamplingSpanProcessor) activePolicies() ([]*policy, uint64) {
+	if set, ok := tsp.reloadedPolicies.Load().(*policySet); ok {
+		return set.policies, set.generation
 	}
+	return tsp.policies, 0
+}
 
-	tsp.policyTicker = &policyTicker{onTickFunc: tsp.samplingPolicyOnTick}
-	tsp.deleteChan = make(chan pdata.TraceID, cfg.NumTraces)
+// resetDecisions marks the trace as not evaluated yet by the given policies.
+// It must be called with the trace locked.
+func resetDecisions(trace *sampling.TraceData, policies []*policy, generation uint64) {
+	trace.Decisions = make([]sampling.Decision, len(policies))
+	for i := range trace.Decisions {
+		trace.Decisions[i] = sampling.Pending
+	}
+	trace.PolicyGeneration = generation
+}
 
-	return tsp, nil
+// isDecided returns whether the policies already evaluated the trace. It must
+// be called with the trace locked.
+func isDecided(trace *sampling.TraceData) bool {
+	for _, decision := range trace.Decisions {
+		if decision != sampling.Pending {
+			return true
+		}
+	}
+	return false
 }
 
 func getPolicyEvaluator(logger *zap.Logger, cfg *PolicyCfg) (sampling.PolicyEvaluator, error) {
+	switch cfg.Type {
+	case And:
+		return withInvert(logger, cfg.Invert)(getNewAndPolicy(logger, &cfg.AndCfg))
+	case Composite:
+		return withInvert(logger, cfg.Invert)(getNewCompositePolicy(logger, &cfg.CompositeCfg))
+	default:
+		return getSharedPolicyEvaluator(logger, &cfg.sharedPolicyCfg)
+	}
+}
+
+// withInvert returns a function inverting the decisions of the evaluator it
+// is passed, if invert is set.
+func withInvert(logger *zap.Logger, invert bool) func(sampling.PolicyEvaluator, error) (sampling.PolicyEvaluator, error) {
+	return func(eval sampling.PolicyEvaluator, err error) (sampling.PolicyEvaluator, error) {
+		if err != nil || !invert {
+			return eval, err
+		}
+		return sampling.NewInvert(logger, eval), nil
+	}
+}
+
+func getSharedPolicyEvaluator(logger *zap.Logger, cfg *sharedPolicyCfg) (sampling.PolicyEvaluator, error) {
+	return withInvert(logger, cfg.Invert)(getBasePolicyEvaluator(logger, cfg))
+}
+
+func getBasePolicyEvaluator(logger *zap.Logger, cfg *sharedPolicyCfg) (sampling.PolicyEvaluator, error) {
 	switch cfg.Type {
 	case AlwaysSample:
 		return sampling.NewAlwaysSample(logger), nil
@@ -135,6 +233,18 @@ func getPolicyEvaluator(logger *zap.Logger, cfg *PolicyCfg) (sampling.PolicyEval
 	case RateLimiting:
 		rlfCfg := cfg.RateLimitingCfg
 		return sampling.NewRateLimiting(logger, rlfCfg.SpansPerSecond), nil
+	case SpanCount:
+		spCfg := cfg.SpanCountCfg
+		return sampling.NewSpanCount(logger, spCfg.MinSpans, spCfg.MaxSpans), nil
+	case TraceState:
+		tsfCfg := cfg.TraceStateCfg
+		return sampling.NewTraceStateFilter(logger, tsfCfg.Key, tsfCfg.Values), nil
+	case SpanName:
+		snfCfg := cfg.SpanNameCfg
+		return sampling.NewSpanNameFilter(logger, snfCfg.Patterns)
+	case BooleanAttribute:
+		bafCfg := cfg.BooleanAttributeCfg
+		return sampling.NewBooleanAttributeFilter(logger, bafCfg.Key, bafCfg.Value), nil
 	default:
 		return nil, fmt.Errorf("unknown sampling policy type %s", cfg.Type)
 	}
@@ -150,6 +260,7 @@ func (tsp *tailSamplingSpanProcessor) samplingPolicyOnTick() {
 	startTime := time.Now()
 	batch, _ := tsp.decisionBatcher.CloseCurrentAndTakeFirstBatch()
 	batchLen := len(batch)
+	policies, generation := tsp.activePolicies()
 	tsp.logger.Debug("Sampling Policy Evaluation ticked")
 	for _, id := range batch {
 		d, ok := tsp.idToTrace.Load(id)
@@ -158,12 +269,38 @@ func (tsp *tailSamplingSpanProcessor) samplingPolicyOnTick() {
 			continue
 		}
 		trace := d.(*sampling.TraceData)
+
+		trace.Lock()
 		trace.DecisionTime = time.Now()
+		if trace.PolicyGeneration != generation {
+			// The trace arrived before the policies were replaced.
+			resetDecisions(trace, policies, generation)
+		}
+		if tsp.buffer != nil {
+			tsp.loadBufferedBatches(id, trace, tsp.buffer.load)
+		}
+		// The policies decide on a copy, since processTraces may reset the
+		// decisions of the trace if the policies are replaced meanwhile.
+		decisions := append([]sampling.Decision(nil), trace.Decisions...)
+		trace.Unlock()
 
-		decision, policy := tsp.makeDecision(id, trace, &metrics)
+		decision, policy := tsp.makeDecision(id, trace, policies, decisions, &metrics)
+		var annotation *samplingAnnotation
+		if decision == sampling.Sampled && tsp.annotateSpans {
+			annotation = newSamplingAnnotation(policies, decisions)
+		}
+		tsp.decisionCache.put(id, decision, annotation)
 
 		// Sampled or not, remove the batches
 		trace.Lock()
+		// The decisions are kept with the generation of the policies that took
+		// them, even if those were replaced meanwhile, so that late spans follow
+		// them instead of waiting for a decision that will never be taken.
+		trace.Decisions = decisions
+		trace.PolicyGeneration = generation
+		if tsp.buffer != nil {
+			tsp.loadBufferedBatches(id, trace, tsp.buffer.release)
+		}
 		traceBatches := trace.ReceivedBatches
 		trace.ReceivedBatches = nil
 		trace.Unlock()
@@ -177,11 +314,20 @@ func (tsp *tailSamplingSpanProcessor) samplingPolicyOnTick() {
 				batch := traceBatches[j]
 				batch.ResourceSpans().MoveAndAppendTo(allSpans.ResourceSpans())
 			}
+			if annotation != nil {
+				annotation.apply(allSpans)
+			}
 
 			_ = tsp.nextConsumer.ConsumeTraces(policy.ctx, allSpans)
 		}
 	}
 
+	if tsp.buffer != nil {
+		if err := tsp.buffer.persistReadIndex(tsp.ctx); err != nil {
+			tsp.logger.Warn("Failed to persist the index of pending traces", zap.Error(err))
+		}
+	}
+
 	stats.Record(tsp.ctx,
 		statOverallDecisionLatencyUs.M(int64(time.Since(startTime)/time.Microsecond)),
 		statDroppedTooEarlyCount.M(metrics.idNotFoundOnMapCount),
@@ -197,11 +343,13 @@ func (tsp *tailSamplingSpanProcessor) samplingPolicyOnTick() {
 	)
 }
 
-func (tsp *tailSamplingSpanProcessor) makeDecision(id pdata.TraceID, trace *sampling.TraceData, metrics *policyMetrics) (sampling.Decision, *policy) {
+// makeDecision evaluates the trace with the policies, writing the decision of
+// each of them to decisions.
+func (tsp *tailSamplingSpanProcessor) makeDecision(id pdata.TraceID, trace *sampling.TraceData, policies []*policy, decisions []sampling.Decision, metrics *policyMetrics) (sampling.Decision, *policy) {
 	finalDecision := sampling.NotSampled
 	var matchingPolicy *policy
 
-	for i, p := range tsp.policies {
+	for i, p := range policies {
 		policyEvaluateStartTime := time.Now()
 		decision, err := p.evaluator.Evaluate(id, trace)
 		stats.Record(
@@ -209,11 +357,11 @@ func (tsp *tailSamplingSpanProcessor) makeDecision(id pdata.TraceID, trace *samp
 			statDecisionLatencyMicroSec.M(int64(time.Since(policyEvaluateStartTime)/time.Microsecond)))
 
 		if err != nil {
-			trace.Decisions[i] = sampling.NotSampled
+			decisions[i] = sampling.NotSampled
 			metrics.evaluateErrorCount++
 			tsp.logger.Debug("Sampling policy error", zap.Error(err))
 		} else {
-			trace.Decisions[i] = decision
+			decisions[i] = decision
 
 			switch decision {
 			case sampling.Sampled:
@@ -245,12 +393,32 @@ func (tsp *tailSamplingSpanProcessor) makeDecision(id pdata.TraceID, trace *samp
 	return finalDecision, matchingPolicy
 }
 
+// loadBufferedBatches appends the batches of the trace taken from the buffer
+// to its received batches. It must be called with the trace locked.
+func (tsp *tailSamplingSpanProcessor) loadBufferedBatches(id pdata.TraceID, trace *sampling.TraceData, take func(context.Context, pdata.TraceID) ([]pdata.Traces, error)) {
+	batches, err := take(tsp.ctx, id)
+	if err != nil {
+		tsp.logger.Warn("Failed to load spans of pending trace from storage", zap.Error(err))
+	}
+	trace.ReceivedBatches = append(trace.ReceivedBatches, batches...)
+}
+
+// bufferBatch adds a batch to the pending trace. It must be called with the
+// trace locked.
+func (tsp *tailSamplingSpanProcessor) bufferBatch(id pdata.TraceID, trace *sampling.TraceData, td pdata.Traces) {
+	if tsp.buffer != nil {
+		err := tsp.buffer.add(tsp.ctx, id, trace.ArrivalTime, td)
+		if err == nil {
+			return
+		}
+		tsp.logger.Warn("Failed to store spans of pending trace, keeping them on memory", zap.Error(err))
+	}
+	trace.ReceivedBatches = append(trace.ReceivedBatches, td)
+}
+
 // ConsumeTraceData is required by the SpanProcessor interface.
 func (tsp *tailSamplingSpanProcessor) ConsumeTraces(ctx context.Context, td pdata.Traces) error {
-	tsp.start.Do(func() {
-		tsp.logger.Info("First trace data arrived, starting tail_sampling timers")
-		tsp.policyTicker.start(1 * time.Second)
-	})
+	tsp.startPolicyTicker("First trace data arrived, starting tail_sampling timers")
 	resourceSpans := td.ResourceSpans()
 	for i := 0; i < resourceSpans.Len(); i++ {
 		tsp.processTraces(resourceSpans.At(i))
@@ -258,6 +426,14 @@ func (tsp *tailSamplingSpanProcessor) ConsumeTraces(ctx context.Context, td pdat
 	return nil
 }
 
+// startPolicyTicker starts the sampling decision timer, unless it was already started.
+func (tsp *tailSamplingSpanProcessor) startPolicyTicker(reason string) {
+	tsp.start.Do(func() {
+		tsp.logger.Info(reason)
+		tsp.policyTicker.start(1 * time.Second)
+	})
+}
+
 func (tsp *tailSamplingSpanProcessor) groupSpansByTraceKey(resourceSpans pdata.ResourceSpans) map[pdata.TraceID][]*pdata.Span {
 	idToSpans := make(map[pdata.TraceID][]*pdata.Span)
 	ilss := resourceSpans.InstrumentationLibrarySpans()
@@ -276,19 +452,19 @@ func (tsp *tailSamplingSpanProcessor) groupSpansByTraceKey(resourceSpans pdata.R
 func (tsp *tailSamplingSpanProcessor) processTraces(resourceSpans pdata.ResourceSpans) {
 	// Group spans per their traceId to minimize contention on idToTrace
 	idToSpans := tsp.groupSpansByTraceKey(resourceSpans)
+	policies, generation := tsp.activePolicies()
 	var newTraceIDs int64
 	for id, spans := range idToSpans {
-		lenSpans := int64(len(spans))
-		lenPolicies := len(tsp.policies)
-		initialDecisions := make([]sampling.Decision, lenPolicies)
-		for i := 0; i < lenPolicies; i++ {
-			initialDecisions[i] = sampling.Pending
+		if tsp.routeCachedDecision(id, resourceSpans, spans) {
+			continue
 		}
+
+		lenSpans := int64(len(spans))
 		initialTraceData := &sampling.TraceData{
-			Decisions:   initialDecisions,
 			ArrivalTime: time.Now(),
 			SpanCount:   lenSpans,
 		}
+		resetDecisions(initialTraceData, policies, generation)
 		d, loaded := tsp.idToTrace.LoadOrStore(id, initialTraceData)
 
 		actualData := d.(*sampling.TraceData)
@@ -296,32 +472,35 @@ func (tsp *tailSamplingSpanProcessor) processTraces(resourceSpans pdata.Resource
 			atomic.AddInt64(&actualData.SpanCount, lenSpans)
 		} else {
 			newTraceIDs++
-			tsp.decisionBatcher.AddToCurrentBatch(id)
-			atomic.AddUint64(&tsp.numTracesOnMap, 1)
-			postDeletion := false
-			currTime := time.Now()
-			for !postDeletion {
-				select {
-				case tsp.deleteChan <- id:
-					postDeletion = true
-				default:
-					traceKeyToDrop := <-tsp.deleteChan
-					tsp.dropTrace(traceKeyToDrop, currTime)
-				}
-			}
+			tsp.addNewTrace(id)
 		}
 
-		for i, p := range tsp.policies {
+		actualData.Lock()
+		replaced := actualData.PolicyGeneration != generation
+		if replaced && !isDecided(actualData) {
+			// The pending trace will be evaluated by the current policies.
+			resetDecisions(actualData, policies, generation)
+			replaced = false
+		}
+		actualData.Unlock()
+		if replaced {
+			tsp.routeReplacedDecision(id, actualData, resourceSpans, spans)
+			continue
+		}
+
+		lateDecision := sampling.Pending
+		for i, p := range policies {
 			var traceTd pdata.Traces
 			actualData.Lock()
 			actualDecision := actualData.Decisions[i]
+			decisionTime := actualData.DecisionTime
 			// If decision is pending, we want to add the new spans still under the lock, so the decision doesn't happen
 			// in between the transition from pending.
 			if actualDecision == sampling.Pending {
 				// Add the spans to the trace, but only once for all policy, otherwise same spans will
 				// be duplicated in the final trace.
 				traceTd = prepareTraceBatch(resourceSpans, spans)
-				actualData.ReceivedBatches = append(actualData.ReceivedBatches, traceTd)
+				tsp.bufferBatch(id, actualData, traceTd)
 				actualData.Unlock()
 				break
 			}
@@ -331,6 +510,12 @@ func (tsp *tailSamplingSpanProcessor) processTraces(resourceSpans pdata.Resource
 			case sampling.Sampled:
 				// Forward the spans to the policy destinations
 				traceTd := prepareTraceBatch(resourceSpans, spans)
+				if tsp.annotateSpans {
+					actualData.Lock()
+					annotation := newSamplingAnnotation(policies, actualData.Decisions)
+					actualData.Unlock()
+					annotation.apply(traceTd)
+				}
 				if err := tsp.nextConsumer.ConsumeTraces(p.ctx, traceTd); err != nil {
 					tsp.logger.Warn("Error sending late arrived spans to destination",
 						zap.String("policy", p.name),
@@ -338,8 +523,11 @@ func (tsp *tailSamplingSpanProcessor) processTraces(resourceSpans pdata.Resource
 				}
 				fallthrough // so OnLateArrivingSpans is also called for decision Sampled.
 			case sampling.NotSampled:
+				if lateDecision != sampling.Sampled {
+					lateDecision = actualDecision
+				}
 				p.evaluator.OnLateArrivingSpans(actualDecision, spans)
-				stats.Record(tsp.ctx, statLateSpanArrivalAfterDecision.M(int64(time.Since(actualData.DecisionTime)/time.Second)))
+				stats.Record(tsp.ctx, statLateSpanArrivalAfterDecision.M(int64(time.Since(decisionTime)/time.Second)))
 
 			default:
 				tsp.logger.Warn("Encountered unexpected sampling decision",
@@ -353,23 +541,161 @@ func (tsp *tailSamplingSpanProcessor) processTraces(resourceSpans pdata.Resource
 				break
 			}
 		}
+		if lateDecision != sampling.Pending {
+			recordLateSpans(tsp.ctx, lateDecision, statLateSpanCount.M(lenSpans))
+		}
 	}
 
 	stats.Record(tsp.ctx, statNewTraceIDReceivedCount.M(newTraceIDs))
 }
 
+// addNewTrace schedules the sampling decision of a trace just stored on
+// idToTrace, dropping the oldest traces if there are too many on memory.
+func (tsp *tailSamplingSpanProcessor) addNewTrace(id pdata.TraceID) {
+	tsp.decisionBatcher.AddToCurrentBatch(id)
+	atomic.AddUint64(&tsp.numTracesOnMap, 1)
+	postDeletion := false
+	currTime := time.Now()
+	for !postDeletion {
+		select {
+		case tsp.deleteChan <- id:
+			postDeletion = true
+		default:
+			traceKeyToDrop := <-tsp.deleteChan
+			tsp.dropTrace(traceKeyToDrop, currTime)
+		}
+	}
+}
+
+// routeCachedDecision forwards or drops the spans of a trace that is no longer
+// on memory according to the decision cached for it. It returns false if the
+// trace is on memory or its decision is unknown, in which case the spans are
+// handled as usual.
+func (tsp *tailSamplingSpanProcessor) routeCachedDecision(id pdata.TraceID, resourceSpans pdata.ResourceSpans, spans []*pdata.Span) bool {
+	if _, ok := tsp.idToTrace.Load(id); ok {
+		return false
+	}
+	decision, annotation, ok := tsp.decisionCache.get(id)
+	if !ok {
+		return false
+	}
+
+	lenSpans := int64(len(spans))
+	recordLateSpans(tsp.ctx, decision, statLateSpanCount.M(lenSpans), statDecisionCacheHitCount.M(lenSpans))
+	if decision == sampling.Sampled {
+		traceTd := prepareTraceBatch(resourceSpans, spans)
+		if annotation != nil {
+			annotation.apply(traceTd)
+		}
+		if err := tsp.nextConsumer.ConsumeTraces(tsp.ctx, traceTd); err != nil {
+			tsp.logger.Warn("Error sending late arrived spans to destination", zap.Error(err))
+		}
+	}
+	return true
+}
+
+// routeReplacedDecision forwards or drops the late spans of a trace decided by
+// policies that were replaced since. The spans follow the final decision of the
+// trace, with the annotation of the decision cache if any, since the evaluators
+// that decided it are no longer active.
+func (tsp *tailSamplingSpanProcessor) routeReplacedDecision(id pdata.TraceID, trace *sampling.TraceData, resourceSpans pdata.ResourceSpans, spans []*pdata.Span) {
+	decision := sampling.NotSampled
+	trace.Lock()
+	for _, d := range trace.Decisions {
+		if d == sampling.Sampled {
+			decision = sampling.Sampled
+			break
+		}
+	}
+	decisionTime := trace.DecisionTime
+	trace.Unlock()
+
+	lenSpans := int64(len(spans))
+	recordLateSpans(tsp.ctx, decision, statLateSpanCount.M(lenSpans))
+	stats.Record(tsp.ctx, statLateSpanArrivalAfterDecision.M(int64(time.Since(decisionTime)/time.Second)))
+	if decision != sampling.Sampled {
+		return
+	}
+	traceTd := prepareTraceBatch(resourceSpans, spans)
+	if _, annotation, ok := tsp.decisionCache.get(id); ok && annotation != nil {
+		annotation.apply(traceTd)
+	}
+	if err := tsp.nextConsumer.ConsumeTraces(tsp.ctx, traceTd); err != nil {
+		tsp.logger.Warn("Error sending late arrived spans to destination", zap.Error(err))
+	}
+}
+
+// recordLateSpans records the measurements tagged with whether the late spans
+// were sampled.
+func recordLateSpans(ctx context.Context, decision sampling.Decision, ms ...stats.Measurement) {
+	_ = stats.RecordWithTags(
+		ctx,
+		[]tag.Mutator{tag.Upsert(tagSampledKey, strconv.FormatBool(decision == sampling.Sampled))},
+		ms...,
+	)
+}
+
 func (tsp *tailSamplingSpanProcessor) Capabilities() consumer.Capabilities {
 	return consumer.Capabilities{MutatesData: false}
 }
 
 // Start is invoked during service startup.
-func (tsp *tailSamplingSpanProcessor) Start(context.Context, component.Host) error {
+func (tsp *tailSamplingSpanProcessor) Start(ctx context.Context, host component.Host) error {
+	if tsp.policySource != nil {
+		tsp.startPolicySource(ctx)
+	}
+	if !tsp.persistentStorage {
+		return nil
+	}
+
+	client, err := tracestorage.GetStorageClient(ctx, host, tsp.id)
+	if err != nil {
+		return err
+	}
+	buffer, restored, err := newTraceBuffer(ctx, client, tsp.logger)
+	if err != nil {
+		_ = client.Close(ctx)
+		return err
+	}
+	tsp.buffer = buffer
+	tsp.restoreTraces(restored)
 	return nil
 }
 
+// restoreTraces puts the pending traces found in storage back on memory. Their
+// decision is taken once decision_wait has passed again.
+func (tsp *tailSamplingSpanProcessor) restoreTraces(restored []restoredTrace) {
+	if len(restored) == 0 {
+		return
+	}
+	// Respect the arrival order, so the oldest traces are dropped first.
+	sort.Slice(restored, func(i, j int) bool {
+		return restored[i].arrivalTime.Before(restored[j].arrivalTime)
+	})
+	policies, generation := tsp.activePolicies()
+	for _, trace := range restored {
+		data := &sampling.TraceData{
+			ArrivalTime: trace.arrivalTime,
+			SpanCount:   trace.spanCount,
+		}
+		resetDecisions(data, policies, generation)
+		tsp.idToTrace.Store(trace.id, data)
+		tsp.addNewTrace(trace.id)
+	}
+	tsp.logger.Info("Restored pending traces from storage", zap.Int("traces", len(restored)))
+	tsp.startPolicyTicker("Pending traces restored, starting tail_sampling timers")
+}
+
 // Shutdown is invoked during service shutdown.
-func (tsp *tailSamplingSpanProcessor) Shutdown(context.Context) error {
-	return nil
+func (tsp *tailSamplingSpanProcessor) Shutdown(ctx context.Context) error {
+	tsp.stopPolicySource()
+	// Stopping the ticker waits for the decisions in progress, so that the
+	// buffer isn't closed under them.
+	tsp.policyTicker.stop()
+	if tsp.buffer == nil {
+		return nil
+	}
+	return tsp.buffer.close(ctx)
 }
 
 func (tsp *tailSamplingSpanProcessor) dropTrace(traceID pdata.TraceID, deletionTime time.Time) {
@@ -384,6 +710,12 @@ func (tsp *tailSamplingSpanProcessor) dropTrace(traceID pdata.TraceID, deletionT
 		tsp.logger.Error("Attempt to delete traceID not on table")
 		return
 	}
+	if tsp.buffer != nil {
+		// Only traces dropped before their decision are still stored.
+		if err := tsp.buffer.discard(tsp.ctx, traceID); err != nil {
+			tsp.logger.Warn("Failed to delete spans of dropped trace from storage", zap.Error(err))
+		}
+	}
 
 	stats.Record(tsp.ctx, statTraceRemovalAgeSec.M(int64(deletionTime.Sub(trace.ArrivalTime)/time.Second)))
 }
@@ -411,23 +743,46 @@ type tTicker interface {
 }
 
 type policyTicker struct {
+	mutex      sync.Mutex
 	ticker     *time.Ticker
 	onTickFunc func()
+	stopCh     chan struct{}
+	done       chan struct{}
 }
 
 func (pt *policyTicker) start(d time.Duration) {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
 	pt.ticker = time.NewTicker(d)
-	go func() {
-		for range pt.ticker.C {
-			pt.onTick()
+	pt.stopCh = make(chan struct{})
+	pt.done = make(chan struct{})
+	go func(ticker *time.Ticker, stopCh <-chan struct{}, done chan<- struct{}) {
+		defer close(done)
+		for {
+			select {
+			case <-ticker.C:
+				pt.onTick()
+			case <-stopCh:
+				return
+			}
 		}
-	}()
+	}(pt.ticker, pt.stopCh, pt.done)
 }
 func (pt *policyTicker) onTick() {
 	pt.onTickFunc()
 }
+
+// stop stops the ticker and waits for the tick in progress, if any.
 func (pt *policyTicker) stop() {
+	pt.mutex.Lock()
+	defer pt.mutex.Unlock()
+	if pt.ticker == nil {
+		return
+	}
 	pt.ticker.Stop()
+	close(pt.stopCh)
+	<-pt.done
+	pt.ticker = nil
 }
 
 var _ tTicker = (*policyTicker)(nil)
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"sort"
 	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -36,7 +37,7 @@ const (
 	defaultTestDecisionWait = 30 * time.Second
 )
 
-var testPolicy = []PolicyCfg{{Name: "test-policy", Type: AlwaysSample}}
+var testPolicy = []PolicyCfg{{sharedPolicyCfg: sharedPolicyCfg{Name: "test-policy", Type: AlwaysSample}}}
 
 func TestSequentialTraceArrival(t *testing.T) {
 	traceIds, batches := generateIdsAndBatches(128)
@@ -536,3 +537,88 @@ func simpleTracesWithID(traceID pdata.TraceID) pdata.Traces {
 	traces.ResourceSpans().AppendEmpty().InstrumentationLibrarySpans().AppendEmpty().Spans().AppendEmpty().SetTraceID(traceID)
 	return traces
 }
+
+func TestLateSpansOfDroppedTraceUseCachedDecision(t *testing.T) {
+	const maxSize = 1
+	msp := new(consumertest.TracesSink)
+	mpe := &mockPolicyEvaluator{NextDecision: sampling.Sampled}
+	tsp := &tailSamplingSpanProcessor{
+		ctx:             context.Background(),
+		nextConsumer:    msp,
+		maxNumTraces:    maxSize,
+		logger:          zap.NewNop(),
+		decisionBatcher: newSyncIDBatcher(1),
+		policies:        []*policy{{name: "mock-policy", evaluator: mpe, ctx: context.TODO()}},
+		deleteChan:      make(chan pdata.TraceID, maxSize),
+		policyTicker:    &manualTTicker{},
+		decisionCache:   newDecisionCache(DecisionCacheCfg{SampledCacheSize: 10, NonSampledCacheSize: 10}),
+	}
+
+	sampledID := pdata.NewTraceID([16]byte{1})
+	notSampledID := pdata.NewTraceID([16]byte{2})
+	otherID := pdata.NewTraceID([16]byte{3})
+
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(sampledID)))
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	require.Equal(t, 1, msp.SpanCount())
+
+	// The next trace evicts the sampled one from memory.
+	mpe.NextDecision = sampling.NotSampled
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(notSampledID)))
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	require.Equal(t, 2, mpe.EvaluationCount)
+	require.Equal(t, 1, msp.SpanCount())
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(otherID)))
+	_, ok := tsp.idToTrace.Load(sampledID)
+	require.False(t, ok)
+	_, ok = tsp.idToTrace.Load(notSampledID)
+	require.False(t, ok)
+
+	// Late spans follow the decisions taken before the traces were dropped,
+	// without being evaluated again.
+	evaluations := mpe.EvaluationCount
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(sampledID)))
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(notSampledID)))
+	require.Equal(t, 2, msp.SpanCount(), "only the late span of the sampled trace should be forwarded")
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	require.Equal(t, evaluations+1, mpe.EvaluationCount, "only the new trace should be evaluated")
+	_, ok = tsp.idToTrace.Load(sampledID)
+	require.False(t, ok, "late span of a cached trace should not be kept on memory")
+}
+
+func TestPolicyTickerStopWaitsForTick(t *testing.T) {
+	var ticking sync.Once
+	tickStarted := make(chan struct{})
+	release := make(chan struct{})
+	var ticks int32
+	pt := &policyTicker{onTickFunc: func() {
+		ticking.Do(func() { close(tickStarted) })
+		<-release
+		atomic.AddInt32(&ticks, 1)
+	}}
+	pt.start(time.Millisecond)
+	<-tickStarted
+
+	stopped := make(chan struct{})
+	go func() {
+		pt.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+		t.Fatal("the ticker stopped during a tick")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	<-stopped
+	ticked := atomic.LoadInt32(&ticks)
+	require.GreaterOrEqual(t, ticked, int32(1))
+
+	// No more ticks happen once stopped, and stopping again is harmless.
+	time.Sleep(10 * time.Millisecond)
+	require.Equal(t, ticked, atomic.LoadInt32(&ticks))
+	pt.stop()
+}
@@ -0,0 +1,274 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"math"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/collector/model/pdata"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+// Attributes added to the spans of sampled traces when annotate_sampled_spans is set.
+const (
+	// policiesAttributeKey lists the names of the policies that sampled the trace.
+	policiesAttributeKey = "tailsampling.policies"
+	// probabilityAttributeKey is the probability the trace had to be sampled.
+	probabilityAttributeKey = "tailsampling.probability"
+)
+
+// The probability of sampled traces is also written to the OpenTelemetry entry
+// of their W3C tracestate as a p-value, the negative base-2 logarithm of the
+// probability.
+const (
+	otelTraceStateKey = "ot"
+	pValueField       = "p:"
+	maxPValue         = 62
+	// zeroPValue is the p-value of a zero probability.
+	zeroPValue = 63
+)
+
+// hashRange is the range of trace ID hashes sampled by a probabilistic policy:
+// the lowest hashes, or the highest ones when inverted. The policies with the
+// same salt hash a trace ID alike, so their decisions aren't independent.
+type hashRange struct {
+	salt     string
+	inverted bool
+}
+
+// hashBounds are the fractions of the lowest and highest hashes sampled by
+// policies with the same salt.
+type hashBounds struct {
+	low, high       float64
+	hasLow, hasHigh bool
+}
+
+// policyProbability returns the probability a trace matched by the policy has
+// to be sampled by it, i.e. its sampling percentage for probabilistic
+// policies, along with their hash range. Other policies sample all the traces
+// they match.
+func policyProbability(cfg *sharedPolicyCfg) (float64, *hashRange) {
+	if cfg.Type != Probabilistic {
+		return 1, nil
+	}
+	p := cfg.ProbabilisticCfg.SamplingPercentage / 100
+	if p > 1 {
+		p = 1
+	} else if p < 0 {
+		p = 0
+	}
+	salt := cfg.ProbabilisticCfg.HashSalt
+	if salt == "" {
+		salt = sampling.DefaultHashSalt
+	}
+	r := &hashRange{salt: salt, inverted: cfg.Invert}
+	if cfg.Invert {
+		return 1 - p, r
+	}
+	return p, r
+}
+
+// getPolicyProbability returns the sampling probability of a top-level policy,
+// along with its hash range if it samples one. A composite policy is accounted
+// as sampling all the traces it matches since its rate limits don't depend on
+// the trace.
+func getPolicyProbability(cfg *PolicyCfg) (float64, *hashRange) {
+	switch cfg.Type {
+	case And:
+		return andPolicyProbability(cfg.AndCfg.SubPolicyCfg)
+	case Composite:
+		return 1, nil
+	default:
+		return policyProbability(&cfg.sharedPolicyCfg)
+	}
+}
+
+// andPolicyProbability returns the probability of a trace to be sampled by all
+// the sub-policies of an and policy: the intersection of the hash ranges of its
+// probabilistic sub-policies with the same salt, the product of those with
+// different salts. The and policy samples a hash range when its probabilistic
+// sub-policies all sample the same end of the hashes of a single salt.
+func andPolicyProbability(cfgs []AndSubPolicyCfg) (float64, *hashRange) {
+	bounds := make(map[string]*hashBounds)
+	var r *hashRange
+	for i := range cfgs {
+		p, sr := policyProbability(&cfgs[i].sharedPolicyCfg)
+		if sr == nil {
+			continue
+		}
+		b, ok := bounds[sr.salt]
+		if !ok {
+			b = &hashBounds{low: 1, high: 1}
+			bounds[sr.salt] = b
+		}
+		if sr.inverted {
+			b.high = math.Min(b.high, p)
+			b.hasHigh = true
+		} else {
+			b.low = math.Min(b.low, p)
+			b.hasLow = true
+		}
+		r = sr
+	}
+
+	p := 1.0
+	for _, b := range bounds {
+		switch {
+		case b.hasLow && b.hasHigh:
+			p *= math.Max(0, b.low+b.high-1)
+			r = nil
+		case b.hasLow:
+			p *= b.low
+		default:
+			p *= b.high
+		}
+	}
+	if len(bounds) != 1 {
+		r = nil
+	}
+	return p, r
+}
+
+// samplingAnnotation describes why a trace was sampled.
+type samplingAnnotation struct {
+	policies    []string
+	probability float64
+}
+
+// newSamplingAnnotation returns the annotation of a trace given the decisions
+// of the policies. The probability of the trace is the probability of it
+// being sampled by at least one of the policies. The probabilistic policies
+// count whatever their decision, since they would have sampled another trace
+// matched alike, while the other policies only count when they sampled the
+// trace, and then make it certain. Among the policies sampling a hash range
+// with the same salt, that is the largest range at each end of the hashes,
+// other policies are independent.
+func newSamplingAnnotation(policies []*policy, decisions []sampling.Decision) *samplingAnnotation {
+	a := &samplingAnnotation{}
+	notSampled := 1.0
+	bounds := make(map[string]*hashBounds)
+	for i, p := range policies {
+		if i >= len(decisions) || decisions[i] == sampling.Pending {
+			continue
+		}
+		if decisions[i] == sampling.Sampled {
+			a.policies = append(a.policies, p.name)
+		} else if p.hashRange == nil && p.probability >= 1 {
+			continue
+		}
+		if p.hashRange == nil {
+			notSampled *= 1 - p.probability
+			continue
+		}
+		b, ok := bounds[p.hashRange.salt]
+		if !ok {
+			b = &hashBounds{}
+			bounds[p.hashRange.salt] = b
+		}
+		if p.hashRange.inverted {
+			b.high = math.Max(b.high, p.probability)
+		} else {
+			b.low = math.Max(b.low, p.probability)
+		}
+	}
+	for _, b := range bounds {
+		notSampled *= 1 - math.Min(1, b.low+b.high)
+	}
+	a.probability = 1 - notSampled
+	return a
+}
+
+// pValue returns the p-value of the probability. Only powers of two can be
+// represented, so the logarithm is rounded down: the p-value stands for the
+// next power of two above the probability, never for a smaller one, and may
+// differ from the probability attribute.
+func pValue(probability float64) int {
+	if probability <= 0 {
+		return zeroPValue
+	}
+	p := int(math.Floor(-math.Log2(probability)))
+	if p > maxPValue {
+		return maxPValue
+	}
+	return p
+}
+
+// withPValue returns the tracestate with the p-value of its OpenTelemetry entry
+// set to p. A p-value already there comes from an independent sampling stage,
+// e.g. head sampling, so both probabilities are multiplied by adding the
+// p-values. The updated entry is moved first, as the W3C specification requires.
+func withPValue(traceState string, p int) string {
+	var members, fields []string
+	for _, member := range strings.Split(traceState, ",") {
+		member = strings.TrimSpace(member)
+		if member == "" {
+			continue
+		}
+		if !strings.HasPrefix(member, otelTraceStateKey+"=") {
+			members = append(members, member)
+			continue
+		}
+		for _, field := range strings.Split(strings.TrimPrefix(member, otelTraceStateKey+"="), ";") {
+			if strings.HasPrefix(field, pValueField) {
+				if prev, err := strconv.Atoi(strings.TrimPrefix(field, pValueField)); err == nil && prev >= 0 && prev <= zeroPValue {
+					p = addPValues(p, prev)
+				}
+			} else if field != "" {
+				fields = append(fields, field)
+			}
+		}
+	}
+	fields = append([]string{pValueField + strconv.Itoa(p)}, fields...)
+	members = append([]string{otelTraceStateKey + "=" + strings.Join(fields, ";")}, members...)
+	return strings.Join(members, ",")
+}
+
+// addPValues returns the p-value of the product of the probabilities.
+func addPValues(p1, p2 int) int {
+	if p1 == zeroPValue || p2 == zeroPValue {
+		return zeroPValue
+	}
+	if p1+p2 > maxPValue {
+		return maxPValue
+	}
+	return p1 + p2
+}
+
+// apply adds the annotation attributes to all the spans and writes the
+// p-value of the probability to their tracestate.
+func (a *samplingAnnotation) apply(td pdata.Traces) {
+	p := pValue(a.probability)
+	rss := td.ResourceSpans()
+	for i := 0; i < rss.Len(); i++ {
+		ilss := rss.At(i).InstrumentationLibrarySpans()
+		for j := 0; j < ilss.Len(); j++ {
+			spans := ilss.At(j).Spans()
+			for k := 0; k < spans.Len(); k++ {
+				span := spans.At(k)
+				attrs := span.Attributes()
+				policies := pdata.NewAttributeValueArray()
+				for _, name := range a.policies {
+					policies.ArrayVal().AppendEmpty().SetStringVal(name)
+				}
+				attrs.Upsert(policiesAttributeKey, policies)
+				attrs.UpsertDouble(probabilityAttributeKey, a.probability)
+				span.SetTraceState(pdata.TraceState(withPValue(string(span.TraceState()), p)))
+			}
+		}
+	}
+}
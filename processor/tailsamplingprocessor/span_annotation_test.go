@@ -0,0 +1,213 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+func TestGetPolicyProbability(t *testing.T) {
+	probabilistic := func(percentage float64, invert bool, salt string) sharedPolicyCfg {
+		return sharedPolicyCfg{Type: Probabilistic, Invert: invert, ProbabilisticCfg: ProbabilisticCfg{HashSalt: salt, SamplingPercentage: percentage}}
+	}
+	and := func(cfgs ...sharedPolicyCfg) PolicyCfg {
+		cfg := PolicyCfg{sharedPolicyCfg: sharedPolicyCfg{Type: And}}
+		for _, sub := range cfgs {
+			cfg.AndCfg.SubPolicyCfg = append(cfg.AndCfg.SubPolicyCfg, AndSubPolicyCfg{sharedPolicyCfg: sub})
+		}
+		return cfg
+	}
+	defaultLow := &hashRange{salt: sampling.DefaultHashSalt}
+	tests := []struct {
+		name      string
+		cfg       PolicyCfg
+		want      float64
+		wantRange *hashRange
+	}{
+		{"always_sample", PolicyCfg{sharedPolicyCfg: sharedPolicyCfg{Type: AlwaysSample}}, 1, nil},
+		{"probabilistic", PolicyCfg{sharedPolicyCfg: probabilistic(25, false, "")}, 0.25, defaultLow},
+		{"inverted probabilistic", PolicyCfg{sharedPolicyCfg: probabilistic(25, true, "salt")}, 0.75, &hashRange{salt: "salt", inverted: true}},
+		{"probabilistic over 100", PolicyCfg{sharedPolicyCfg: probabilistic(150, false, sampling.DefaultHashSalt)}, 1, defaultLow},
+		{"and with the same salt", and(probabilistic(50, false, ""), sharedPolicyCfg{Type: Latency}, probabilistic(20, false, "")), 0.2, defaultLow},
+		{"and with different salts", and(probabilistic(50, false, "a"), probabilistic(20, false, "b")), 0.1, nil},
+		{"and with both ends of the hashes", and(probabilistic(70, false, ""), probabilistic(40, true, "")), 0.3, nil},
+		{"composite", PolicyCfg{sharedPolicyCfg: sharedPolicyCfg{Type: Composite}}, 1, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, r := getPolicyProbability(&tt.cfg)
+			assert.InDelta(t, tt.want, p, 1e-9)
+			assert.Equal(t, tt.wantRange, r)
+		})
+	}
+}
+
+func TestSamplingAnnotation(t *testing.T) {
+	policies := []*policy{
+		{name: "ten-percent", probability: 0.1},
+		{name: "errors", probability: 1},
+		{name: "half", probability: 0.5},
+	}
+
+	a := newSamplingAnnotation(policies, []sampling.Decision{sampling.Sampled, sampling.NotSampled, sampling.Sampled})
+	assert.Equal(t, []string{"ten-percent", "half"}, a.policies)
+	assert.InDelta(t, 0.55, a.probability, 1e-9)
+
+	// Probabilistic policies count even when they didn't sample the trace.
+	a = newSamplingAnnotation(policies, []sampling.Decision{sampling.NotSampled, sampling.NotSampled, sampling.Sampled})
+	assert.Equal(t, []string{"half"}, a.policies)
+	assert.InDelta(t, 0.55, a.probability, 1e-9)
+
+	a = newSamplingAnnotation(policies, []sampling.Decision{sampling.Sampled, sampling.Sampled})
+	assert.Equal(t, []string{"ten-percent", "errors"}, a.policies)
+	assert.Equal(t, 1.0, a.probability)
+
+	td := simpleTraces()
+	a.apply(td)
+	span := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+	assertAnnotation(t, span.Attributes(), []string{"ten-percent", "errors"}, 1)
+	assert.Equal(t, pdata.TraceState("ot=p:0"), span.TraceState())
+}
+
+func TestSamplingAnnotationHashRanges(t *testing.T) {
+	low := &hashRange{salt: sampling.DefaultHashSalt}
+	policies := []*policy{
+		{name: "ten-percent", probability: 0.1, hashRange: low},
+		{name: "quarter", probability: 0.25, hashRange: low},
+		{name: "top-half", probability: 0.5, hashRange: &hashRange{salt: sampling.DefaultHashSalt, inverted: true}},
+		{name: "other-salt", probability: 0.2, hashRange: &hashRange{salt: "other"}},
+		{name: "errors", probability: 1},
+	}
+	sampled := func(names ...string) []sampling.Decision {
+		decisions := make([]sampling.Decision, len(policies))
+		for i, p := range policies {
+			decisions[i] = sampling.NotSampled
+			for _, name := range names {
+				if p.name == name {
+					decisions[i] = sampling.Sampled
+				}
+			}
+		}
+		return decisions
+	}
+
+	// Every hash range counts whatever the decision: the largest at each end of
+	// the hashes of a salt, different salts being independent.
+	a := newSamplingAnnotation(policies, sampled("ten-percent", "quarter"))
+	assert.Equal(t, []string{"ten-percent", "quarter"}, a.policies)
+	assert.InDelta(t, 0.8, a.probability, 1e-9)
+	a = newSamplingAnnotation(policies, sampled("top-half"))
+	assert.InDelta(t, 0.8, a.probability, 1e-9)
+	a = newSamplingAnnotation(policies, sampled("other-salt"))
+	assert.InDelta(t, 0.8, a.probability, 1e-9)
+	// A deterministic policy sampling the trace makes it certain.
+	a = newSamplingAnnotation(policies, sampled("quarter", "errors"))
+	assert.Equal(t, 1.0, a.probability)
+
+	// The policies hash the trace ID alike, the smaller range is within the larger one.
+	a = newSamplingAnnotation(policies[:2], sampled("ten-percent"))
+	assert.InDelta(t, 0.25, a.probability, 1e-9)
+	// The ranges at both ends of the hashes add up.
+	a = newSamplingAnnotation(policies[:3], sampled("quarter"))
+	assert.InDelta(t, 0.75, a.probability, 1e-9)
+}
+
+func TestPValue(t *testing.T) {
+	assert.Equal(t, 0, pValue(1))
+	assert.Equal(t, 2, pValue(0.25))
+	assert.Equal(t, 3, pValue(0.1), "0.1 should be rounded up to 1/8")
+	assert.Equal(t, 2, pValue(0.2), "0.2 should be rounded up to 1/4, not down to 1/8")
+	assert.Equal(t, maxPValue, pValue(1e-30))
+	assert.Equal(t, zeroPValue, pValue(0))
+}
+
+func TestWithPValue(t *testing.T) {
+	tests := []struct {
+		name       string
+		traceState string
+		want       string
+	}{
+		{"empty", "", "ot=p:2"},
+		{"other vendors", "vendor=value,other=x", "ot=p:2,vendor=value,other=x"},
+		{"existing entry", "vendor=value,ot=r:10", "ot=p:2;r:10,vendor=value"},
+		{"head sampled", "ot=p:1;r:10", "ot=p:3;r:10"},
+		{"zero probability", "ot=p:63", "ot=p:63"},
+		{"invalid p-value", "ot=p:x", "ot=p:2"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, withPValue(tt.traceState, 2))
+		})
+	}
+}
+
+func assertAnnotation(t *testing.T, attrs pdata.AttributeMap, policies []string, probability float64) {
+	value, ok := attrs.Get(policiesAttributeKey)
+	require.True(t, ok)
+	var names []string
+	for i := 0; i < value.ArrayVal().Len(); i++ {
+		names = append(names, value.ArrayVal().At(i).StringVal())
+	}
+	assert.Equal(t, policies, names)
+	value, ok = attrs.Get(probabilityAttributeKey)
+	require.True(t, ok)
+	assert.InDelta(t, probability, value.DoubleVal(), 1e-9)
+}
+
+func TestSampledSpansAreAnnotated(t *testing.T) {
+	const maxSize = 1
+	msp := new(consumertest.TracesSink)
+	tsp := &tailSamplingSpanProcessor{
+		ctx:             context.Background(),
+		nextConsumer:    msp,
+		maxNumTraces:    maxSize,
+		logger:          zap.NewNop(),
+		decisionBatcher: newSyncIDBatcher(1),
+		policies: []*policy{
+			{name: "sampled", evaluator: &mockPolicyEvaluator{NextDecision: sampling.Sampled}, ctx: context.TODO(), probability: 0.2},
+			{name: "not-sampled", evaluator: &mockPolicyEvaluator{NextDecision: sampling.NotSampled}, ctx: context.TODO(), probability: 1},
+		},
+		deleteChan:    make(chan pdata.TraceID, maxSize),
+		policyTicker:  &manualTTicker{},
+		decisionCache: newDecisionCache(DecisionCacheCfg{SampledCacheSize: 10}),
+		annotateSpans: true,
+	}
+
+	id := pdata.NewTraceID([16]byte{1})
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	// A late span of the trace on memory.
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+	// A late span of the trace routed by the decision cache.
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(pdata.NewTraceID([16]byte{2}))))
+	require.NoError(t, tsp.ConsumeTraces(context.Background(), simpleTracesWithID(id)))
+
+	require.Len(t, msp.AllTraces(), 3)
+	for _, td := range msp.AllTraces() {
+		span := td.ResourceSpans().At(0).InstrumentationLibrarySpans().At(0).Spans().At(0)
+		assertAnnotation(t, span.Attributes(), []string{"sampled"}, 0.2)
+		assert.Equal(t, pdata.TraceState("ot=p:2"), span.TraceState())
+	}
+}
@@ -0,0 +1,217 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/extension/storage"
+	"go.opentelemetry.io/collector/model/otlp"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/tracestorage"
+)
+
+// traceBuffer keeps the batches of the traces waiting for a sampling decision
+// in a storage client instead of memory, so that they survive a restart. The
+// traces are stored with the layout of the tracestorage package.
+type traceBuffer struct {
+	client      storage.Client
+	logger      *zap.Logger
+	marshaler   pdata.TracesMarshaler
+	unmarshaler pdata.TracesUnmarshaler
+
+	mutex     sync.Mutex
+	pending   map[pdata.TraceID]*bufferedTrace
+	readIndex uint64
+	nextIndex uint64
+}
+
+// bufferedTrace is a pending trace whose batches are stored.
+type bufferedTrace struct {
+	index uint64
+	// batches is the number of stored batches, of which the first loaded ones
+	// were already handed to the sampling decision.
+	batches int
+	loaded  int
+}
+
+// restoredTrace is a pending trace found in storage on start.
+type restoredTrace struct {
+	id          pdata.TraceID
+	arrivalTime time.Time
+	spanCount   int64
+}
+
+// newTraceBuffer returns a buffer storing batches with the client, along with
+// the pending traces that were left in storage.
+func newTraceBuffer(ctx context.Context, client storage.Client, logger *zap.Logger) (*traceBuffer, []restoredTrace, error) {
+	tb := &traceBuffer{
+		client:      client,
+		logger:      logger,
+		marshaler:   otlp.NewProtobufTracesMarshaler(),
+		unmarshaler: otlp.NewProtobufTracesUnmarshaler(),
+		pending:     make(map[pdata.TraceID]*bufferedTrace),
+	}
+	restored, err := tb.restore(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	return tb, restored, nil
+}
+
+// restore loads the index of the pending traces left in storage and returns them.
+func (tb *traceBuffer) restore(ctx context.Context) ([]restoredTrace, error) {
+	readIndex, nextIndex, traces, err := tracestorage.Restore(ctx, tb.client)
+	if err != nil {
+		return nil, err
+	}
+	tb.readIndex = readIndex
+	tb.nextIndex = nextIndex
+
+	restored := make([]restoredTrace, 0, len(traces))
+	for _, trace := range traces {
+		rt := restoredTrace{id: trace.ID, arrivalTime: trace.ArrivalTime}
+		for i := 0; i < trace.Batches; i++ {
+			buf, err := tb.client.Get(ctx, tracestorage.BatchKey(trace.Index, i))
+			if err != nil {
+				return nil, err
+			}
+			td, err := tb.unmarshaler.UnmarshalTraces(buf)
+			if err != nil {
+				return nil, err
+			}
+			rt.spanCount += int64(td.SpanCount())
+		}
+		tb.pending[trace.ID] = &bufferedTrace{index: trace.Index, batches: trace.Batches}
+		restored = append(restored, rt)
+	}
+	return restored, nil
+}
+
+// add stores a batch of a pending trace.
+func (tb *traceBuffer) add(ctx context.Context, id pdata.TraceID, arrivalTime time.Time, td pdata.Traces) error {
+	buf, err := tb.marshaler.MarshalTraces(td)
+	if err != nil {
+		return err
+	}
+
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	trace, ok := tb.pending[id]
+	if !ok {
+		trace = &bufferedTrace{index: tb.nextIndex}
+		if err := tb.client.Batch(ctx, tracestorage.AddTraceOperations(trace.index, id, arrivalTime)...); err != nil {
+			return err
+		}
+		tb.nextIndex++
+		tb.pending[id] = trace
+	}
+
+	if err := tb.client.Set(ctx, tracestorage.BatchKey(trace.index, trace.batches), buf); err != nil {
+		return err
+	}
+	trace.batches++
+	return nil
+}
+
+// load returns the batches of the trace stored since the last load.
+func (tb *traceBuffer) load(ctx context.Context, id pdata.TraceID) ([]pdata.Traces, error) {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	trace, ok := tb.pending[id]
+	if !ok {
+		return nil, nil
+	}
+	var batches []pdata.Traces
+	for ; trace.loaded < trace.batches; trace.loaded++ {
+		buf, err := tb.client.Get(ctx, tracestorage.BatchKey(trace.index, trace.loaded))
+		if err != nil {
+			return batches, err
+		}
+		if buf == nil {
+			continue
+		}
+		td, err := tb.unmarshaler.UnmarshalTraces(buf)
+		if err != nil {
+			return batches, err
+		}
+		batches = append(batches, td)
+	}
+	return batches, nil
+}
+
+// release returns the batches of the trace stored since the last load and
+// removes the trace from storage.
+func (tb *traceBuffer) release(ctx context.Context, id pdata.TraceID) ([]pdata.Traces, error) {
+	batches, err := tb.load(ctx, id)
+	if err != nil {
+		return batches, err
+	}
+	return batches, tb.discard(ctx, id)
+}
+
+// discard removes the trace from storage, if it is still pending.
+func (tb *traceBuffer) discard(ctx context.Context, id pdata.TraceID) error {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	trace, ok := tb.pending[id]
+	if !ok {
+		return nil
+	}
+	delete(tb.pending, id)
+	return tb.deleteKeys(ctx, trace)
+}
+
+func (tb *traceBuffer) deleteKeys(ctx context.Context, trace *bufferedTrace) error {
+	return tb.client.Batch(ctx, tracestorage.DeleteTraceOperations(trace.index, trace.batches)...)
+}
+
+// persistReadIndex moves the stored read index to the oldest pending trace, so
+// that the traces released since are no longer looked up on restore.
+func (tb *traceBuffer) persistReadIndex(ctx context.Context) error {
+	tb.mutex.Lock()
+	defer tb.mutex.Unlock()
+
+	readIndex := tb.nextIndex
+	for _, trace := range tb.pending {
+		if trace.index < readIndex {
+			readIndex = trace.index
+		}
+	}
+	if readIndex == tb.readIndex {
+		return nil
+	}
+	if err := tb.client.Set(ctx, tracestorage.ReadIndexKey, tracestorage.EncodeIndex(readIndex)); err != nil {
+		return err
+	}
+	tb.readIndex = readIndex
+	return nil
+}
+
+// close persists the read index and closes the client.
+func (tb *traceBuffer) close(ctx context.Context) error {
+	err := tb.persistReadIndex(ctx)
+	if closeErr := tb.client.Close(ctx); err == nil {
+		err = closeErr
+	}
+	return err
+}
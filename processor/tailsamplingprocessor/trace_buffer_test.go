@@ -0,0 +1,239 @@
+// Copyright The OpenTelemetry Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//       http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tailsamplingprocessor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/collector/component"
+	"go.opentelemetry.io/collector/component/componenttest"
+	"go.opentelemetry.io/collector/config"
+	"go.opentelemetry.io/collector/consumer/consumertest"
+	"go.opentelemetry.io/collector/extension/storage"
+	"go.opentelemetry.io/collector/model/pdata"
+	"go.uber.org/zap"
+
+	"github.com/open-telemetry/opentelemetry-collector-contrib/internal/coreinternal/tracestorage"
+	"github.com/open-telemetry/opentelemetry-collector-contrib/processor/tailsamplingprocessor/internal/sampling"
+)
+
+// mapClient is a storage client keeping its data in a map that outlives it.
+type mapClient struct {
+	mutex sync.Mutex
+	data  map[string][]byte
+}
+
+var _ storage.Client = (*mapClient)(nil)
+
+func newMapClient() *mapClient {
+	return &mapClient{data: make(map[string][]byte)}
+}
+
+func (c *mapClient) Get(_ context.Context, key string) ([]byte, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.data[key], nil
+}
+
+func (c *mapClient) Set(_ context.Context, key string, value []byte) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.data[key] = value
+	return nil
+}
+
+func (c *mapClient) Delete(_ context.Context, key string) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	delete(c.data, key)
+	return nil
+}
+
+func (c *mapClient) Batch(ctx context.Context, ops ...storage.Operation) error {
+	for _, op := range ops {
+		var err error
+		switch op.Type {
+		case storage.Get:
+			op.Value, err = c.Get(ctx, op.Key)
+		case storage.Set:
+			err = c.Set(ctx, op.Key, op.Value)
+		case storage.Delete:
+			err = c.Delete(ctx, op.Key)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *mapClient) Close(context.Context) error {
+	return nil
+}
+
+type mapStorageExtension struct {
+	client *mapClient
+}
+
+var _ storage.Extension = (*mapStorageExtension)(nil)
+
+func (e *mapStorageExtension) Start(context.Context, component.Host) error {
+	return nil
+}
+
+func (e *mapStorageExtension) Shutdown(context.Context) error {
+	return nil
+}
+
+func (e *mapStorageExtension) GetClient(context.Context, component.Kind, config.ComponentID, string) (storage.Client, error) {
+	return e.client, nil
+}
+
+type storageHost struct {
+	component.Host
+	extensions map[config.ComponentID]component.Extension
+}
+
+func (h storageHost) GetExtensions() map[config.ComponentID]component.Extension {
+	return h.extensions
+}
+
+func newStorageHost(clients ...*mapClient) component.Host {
+	h := storageHost{
+		Host:       componenttest.NewNopHost(),
+		extensions: make(map[config.ComponentID]component.Extension),
+	}
+	for i, client := range clients {
+		h.extensions[config.NewIDWithName("map_storage", string(rune('a'+i)))] = &mapStorageExtension{client: client}
+	}
+	return h
+}
+
+func TestTraceBufferRestore(t *testing.T) {
+	ctx := context.Background()
+	client := newMapClient()
+	tb, restored, err := newTraceBuffer(ctx, client, zap.NewNop())
+	require.NoError(t, err)
+	assert.Empty(t, restored)
+
+	pendingID := pdata.NewTraceID([16]byte{1})
+	releasedID := pdata.NewTraceID([16]byte{2})
+	arrival := time.Unix(1600000000, 0)
+	require.NoError(t, tb.add(ctx, releasedID, arrival, simpleTracesWithID(releasedID)))
+	require.NoError(t, tb.add(ctx, pendingID, arrival.Add(time.Second), simpleTracesWithID(pendingID)))
+	require.NoError(t, tb.add(ctx, pendingID, arrival.Add(time.Second), simpleTracesWithID(pendingID)))
+
+	batches, err := tb.load(ctx, releasedID)
+	require.NoError(t, err)
+	assert.Len(t, batches, 1)
+	require.NoError(t, tb.add(ctx, releasedID, arrival, simpleTracesWithID(releasedID)))
+	batches, err = tb.release(ctx, releasedID)
+	require.NoError(t, err)
+	assert.Len(t, batches, 1, "only the batches stored since the last load are released")
+	require.NoError(t, tb.close(ctx))
+
+	tb, restored, err = newTraceBuffer(ctx, client, zap.NewNop())
+	require.NoError(t, err)
+	assert.Equal(t, []restoredTrace{{id: pendingID, arrivalTime: arrival.Add(time.Second), spanCount: 2}}, restored)
+	assert.Equal(t, uint64(1), tb.readIndex, "the released trace should be skipped")
+
+	batches, err = tb.release(ctx, pendingID)
+	require.NoError(t, err)
+	assert.Len(t, batches, 2)
+	require.NoError(t, tb.close(ctx))
+	assert.Len(t, client.data, 2, "only the indexes should be left")
+}
+
+func TestTraceBufferDiscard(t *testing.T) {
+	ctx := context.Background()
+	client := newMapClient()
+	tb, _, err := newTraceBuffer(ctx, client, zap.NewNop())
+	require.NoError(t, err)
+
+	id := pdata.NewTraceID([16]byte{1})
+	require.NoError(t, tb.add(ctx, id, time.Now(), simpleTracesWithID(id)))
+	require.NoError(t, tb.discard(ctx, id))
+	batches, err := tb.release(ctx, id)
+	require.NoError(t, err)
+	assert.Empty(t, batches)
+	assert.Len(t, client.data, 1, "only the write index should be left")
+}
+
+func TestGetStorageClient(t *testing.T) {
+	id := config.NewID(typeStr)
+	_, err := tracestorage.GetStorageClient(context.Background(), componenttest.NewNopHost(), id)
+	assert.Equal(t, tracestorage.ErrNoStorageClient, err)
+	_, err = tracestorage.GetStorageClient(context.Background(), newStorageHost(newMapClient(), newMapClient()), id)
+	assert.Equal(t, tracestorage.ErrMultipleStorageClients, err)
+	client := newMapClient()
+	got, err := tracestorage.GetStorageClient(context.Background(), newStorageHost(client), id)
+	require.NoError(t, err)
+	assert.Equal(t, client, got)
+}
+
+func TestPendingTracesSurviveRestart(t *testing.T) {
+	ctx := context.Background()
+	client := newMapClient()
+	host := newStorageHost(client)
+	newProcessor := func(next *consumertest.TracesSink) (*tailSamplingSpanProcessor, *mockPolicyEvaluator) {
+		mpe := &mockPolicyEvaluator{NextDecision: sampling.Sampled}
+		tsp := &tailSamplingSpanProcessor{
+			ctx:               ctx,
+			nextConsumer:      next,
+			maxNumTraces:      10,
+			logger:            zap.NewNop(),
+			decisionBatcher:   newSyncIDBatcher(1),
+			policies:          []*policy{{name: "mock-policy", evaluator: mpe, ctx: context.TODO()}},
+			deleteChan:        make(chan pdata.TraceID, 10),
+			policyTicker:      &manualTTicker{},
+			persistentStorage: true,
+		}
+		require.NoError(t, tsp.Start(ctx, host))
+		return tsp, mpe
+	}
+
+	msp := new(consumertest.TracesSink)
+	tsp, _ := newProcessor(msp)
+	id := pdata.NewTraceID([16]byte{1})
+	require.NoError(t, tsp.ConsumeTraces(ctx, simpleTracesWithID(id)))
+	require.NoError(t, tsp.ConsumeTraces(ctx, simpleTracesWithID(id)))
+	d, ok := tsp.idToTrace.Load(id)
+	require.True(t, ok)
+	arrival := d.(*sampling.TraceData).ArrivalTime
+	assert.Empty(t, d.(*sampling.TraceData).ReceivedBatches, "spans should be kept in storage")
+	require.NoError(t, tsp.Shutdown(ctx))
+	assert.Equal(t, 0, msp.SpanCount())
+
+	msp = new(consumertest.TracesSink)
+	tsp, mpe := newProcessor(msp)
+	d, ok = tsp.idToTrace.Load(id)
+	require.True(t, ok, "pending trace should be restored")
+	trace := d.(*sampling.TraceData)
+	assert.True(t, arrival.Equal(trace.ArrivalTime))
+	assert.Equal(t, int64(2), trace.SpanCount)
+	assert.True(t, tsp.policyTicker.(*manualTTicker).Started)
+
+	tsp.samplingPolicyOnTick()
+	tsp.samplingPolicyOnTick()
+	assert.Equal(t, 1, mpe.EvaluationCount)
+	assert.Equal(t, 2, msp.SpanCount())
+	require.NoError(t, tsp.Shutdown(ctx))
+	assert.Len(t, client.data, 2, "only the indexes should be left")
+}